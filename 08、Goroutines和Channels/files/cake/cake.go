@@ -1,9 +1,12 @@
 package cake
 
 import (
+	"context"
 	"fmt"
 	"math/rand"
 	"time"
+
+	"gostudy/08、Goroutines和Channels/files/pipeline"
 )
 
 // Shop *
@@ -23,58 +26,107 @@ type Shop struct {
 
 type cake int
 
-func (s *Shop) baker(baked chan<- cake) {
-	for i := 0; i < s.Cakes; i++ {
-		c := cake(i)
-		if s.Verbose {
-			fmt.Println("烘焙中……", c)
-		}
-		work(s.BakeTime, s.BakeStdDev)
-		baked <- c
+// 蛋糕店是一条三个阶段的流水线，以下是各个阶段的处理函数
+
+func (s *Shop) bake(ctx context.Context, c cake) (cake, error) {
+	if s.Verbose {
+		fmt.Println("烘焙中……", c)
+	}
+	if err := work(ctx, s.BakeTime, s.BakeStdDev); err != nil {
+		return 0, err
 	}
-	close(baked)
+	return c, nil
 }
 
-func (s *Shop) icer(iced chan<- cake, baked <-chan cake) {
-	for c := range baked {
-		if s.Verbose {
-			fmt.Println("上糖中……", c)
-		}
-		work(s.IceTime, s.IceStdDev)
-		iced <- c
+func (s *Shop) ice(ctx context.Context, c cake) (cake, error) {
+	if s.Verbose {
+		fmt.Println("上糖中……", c)
 	}
+	if err := work(ctx, s.IceTime, s.IceStdDev); err != nil {
+		return 0, err
+	}
+	return c, nil
 }
 
-func (s *Shop) inscriber(iced <-chan cake) {
-	for i := 0; i < s.Cakes; i++ {
-		c := <-iced
-		if s.Verbose {
-			fmt.Println("雕花中……", c)
-		}
-		work(s.InscribeTime, s.InscribeStdDev)
+func (s *Shop) inscribe(ctx context.Context, c cake) (cake, error) {
+	if s.Verbose {
+		fmt.Println("雕花中……", c)
+	}
+	if err := work(ctx, s.InscribeTime, s.InscribeStdDev); err != nil {
+		return 0, err
+	}
+	return c, nil
+}
+
+// Funcs 返回各个阶段的处理函数，用于 pipeline.Build
+func (s *Shop) Funcs() pipeline.Funcs {
+	return pipeline.Funcs{"bake": pipeline.F(s.bake), "ice": pipeline.F(s.ice), "inscribe": pipeline.F(s.inscribe)}
+}
+
+// Config 返回 s 对应的流水线配置：一位烘焙师、NumIcers 位上糖师和一位雕花师，
+// 烘焙和上糖之间有 BakeBuf 个缓冲槽，上糖和雕花之间有 IceBuf 个
+func (s *Shop) Config() *pipeline.Config {
+	return &pipeline.Config{Stages: []pipeline.StageConfig{
+		{Name: "bake", Workers: 1, Buffer: s.BakeBuf},
+		{Name: "ice", Workers: s.NumIcers, Buffer: s.IceBuf},
+		{Name: "inscribe", Workers: 1},
+	}}
+}
+
+// Run 用流水线烘焙 Cakes 个蛋糕，返回每个阶段的统计
+// ctx 被取消时，正在进行的工作立即停止，Run 返回 ctx.Err()
+func (s *Shop) Run(ctx context.Context) ([]pipeline.Metrics, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+	return s.RunConfig(ctx, s.Config())
+}
+
+// RunConfig 与 Run 相同，但是使用 c 描述的流水线，例如从 shop.json 读取的配置
+func (s *Shop) RunConfig(ctx context.Context, c *pipeline.Config) ([]pipeline.Metrics, error) {
+	p, err := pipeline.Build[cake, cake](c, s.Funcs())
+	if err != nil {
+		return nil, err
+	}
+	return p.Run(ctx, s.Source, func(c cake) error {
 		if s.Verbose {
 			fmt.Println("完成", c)
 		}
+		return nil
+	})
+}
+
+// Source 依次送出 Cakes 个要烘焙的蛋糕，它的类型是 pipeline.Source[cake]
+func (s *Shop) Source(ctx context.Context, emit func(cake) error) error {
+	for i := 0; i < s.Cakes; i++ {
+		if err := emit(cake(i)); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // Work 方法模拟运行时间
 func (s *Shop) Work(runs int) {
 	for run := 0; run < runs; run++ {
-		baked := make(chan cake, s.BakeBuf)
-		iced := make(chan cake, s.IceBuf)
-		go s.baker(baked)
-		for i := 0; i < s.NumIcers; i++ {
-			go s.icer(iced, baked)
+		if _, err := s.Run(context.Background()); err != nil {
+			panic(err) // 参数错误；各个阶段都不会出错
 		}
-		s.inscriber(iced)
 	}
 }
 
 // work 方法会阻止调用 goroutine 一段时间
 // 通常分布在 d 周围
 // 标准差为 stddev
-func work(d, stddev time.Duration) {
+// ctx 被取消时它提前返回 ctx.Err()
+func work(ctx context.Context, d, stddev time.Duration) error {
 	delay := d + time.Duration(rand.NormFloat64()*float64(stddev))
-	time.Sleep(delay)
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
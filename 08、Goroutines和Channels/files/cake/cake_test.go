@@ -1,14 +1,18 @@
 package cake_test
 
 import (
+	"context"
+	"flag"
 	"gostudy/08、Goroutines和Channels/files/cake"
+	"gostudy/08、Goroutines和Channels/files/pipeline"
+	"os"
+	"strings"
 
 	"testing"
 	"time"
 )
 
 var defaults = cake.Shop{
-	Verbose:      testing.Verbose(),
 	Cakes:        20,
 	BakeTime:     10 * time.Millisecond,
 	NumIcers:     1,
@@ -16,6 +20,13 @@ var defaults = cake.Shop{
 	InscribeTime: 10 * time.Millisecond,
 }
 
+// testing.Verbose 只能在解析命令行参数之后调用，不能用在包级变量的初始化中
+func TestMain(m *testing.M) {
+	flag.Parse()
+	defaults.Verbose = testing.Verbose()
+	os.Exit(m.Run())
+}
+
 func Benchmark(b *testing.B) {
 	// 基线：一位烘焙师，一位上糖师，一位雕花师
 	// 每步仅 10ms，无缓冲区
@@ -69,3 +80,55 @@ func BenchmarkSlowIcingManyIcers(b *testing.B) {
 	cakeshop.NumIcers = 5
 	cakeshop.Work(b.N) // 288ms
 }
+
+func TestRun(t *testing.T) {
+	shop := defaults
+	shop.NumIcers, shop.BakeBuf = 3, 5
+	metrics, err := shop.Run(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(metrics) != 3 || metrics[1].Stage != "ice" || metrics[1].Workers != 3 {
+		t.Fatalf("metrics = %+v", metrics)
+	}
+	for _, m := range metrics {
+		if m.Out != int64(shop.Cakes) {
+			t.Errorf("%s: %d cakes, want %d", m.Stage, m.Out, shop.Cakes)
+		}
+	}
+
+	// shop.json 是同一条流水线的配置文件
+	c, err := pipeline.LoadConfig("shop.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	shop.Cakes = 10
+	metrics, err = shop.RunConfig(context.Background(), c)
+	if err != nil || metrics[2].Out != 10 || metrics[1].Workers != 5 {
+		t.Errorf("shop.json: error %v, metrics %+v", err, metrics)
+	}
+}
+
+// 取消时正在烘焙的蛋糕立即停止，而不是等到 work 结束
+func TestRunCancel(t *testing.T) {
+	shop := defaults
+	shop.BakeTime, shop.IceTime, shop.InscribeTime = time.Minute, time.Minute, time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, err := shop.Run(ctx); err != context.DeadlineExceeded {
+		t.Errorf("Run = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("Run took %v after cancellation", d)
+	}
+}
+
+// 没有上糖师的蛋糕店被拒绝，模拟中的检查见 TestSimulateInvalid
+func TestNoIcers(t *testing.T) {
+	shop := defaults
+	shop.NumIcers = 0
+	if _, err := shop.Run(context.Background()); err == nil || !strings.Contains(err.Error(), "NumIcers") {
+		t.Errorf("Run = %v, want NumIcers error", err)
+	}
+}
@@ -0,0 +1,388 @@
+package cake
+
+import (
+	"container/heap"
+	"fmt"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Stats 是 Simulate 的结果，所有时间都是虚拟时间
+type Stats struct {
+	Runs       int
+	Cakes      int           // 完成的蛋糕总数
+	Elapsed    time.Duration // 所有运行的总时间
+	Throughput float64       // 每秒完成的蛋糕数
+
+	Bakers, Icers, Inscribers StageStats
+	BakeBuf, IceBuf           BufferStats
+}
+
+// StageStats 是一个阶段所有工人的统计，时间是所有工人的总和
+// Busy + Starved + Blocked 等于 Workers × Elapsed
+type StageStats struct {
+	Workers     int
+	Done        int           // 处理的蛋糕数
+	Throughput  float64       // 每秒处理的蛋糕数
+	Utilization float64       // Busy 占总时间的比例
+	Busy        time.Duration // 工作的时间
+	Starved     time.Duration // 等待上一阶段的时间，包括全部完成之后等待这次运行结束的时间
+	Blocked     time.Duration // 等待下一阶段接收的时间
+}
+
+// Idle 返回工人空闲的总时间
+func (s StageStats) Idle() time.Duration { return s.Starved + s.Blocked }
+
+// BufferStats 是蛋糕在一个缓冲槽中的等待时间：从上一阶段完成到下一阶段开始
+// 缓冲槽满时上一阶段的工人拿着蛋糕等待，这段时间也计算在内
+type BufferStats struct {
+	Cap                      int
+	Mean, P50, P90, P99, Max time.Duration
+}
+
+// validate 检查 s 的参数，Simulate、Sweep 和 Run 都使用它
+// 没有上糖师时蛋糕永远做不完：流水线会把 0 个 worker 当作 1 个，模拟则会死锁
+func (s *Shop) validate() error {
+	if s.NumIcers < 1 {
+		return fmt.Errorf("cake: NumIcers is %d, want at least 1", s.NumIcers)
+	}
+	if s.BakeBuf < 0 || s.IceBuf < 0 {
+		return fmt.Errorf("cake: negative buffer (BakeBuf %d, IceBuf %d)", s.BakeBuf, s.IceBuf)
+	}
+	return nil
+}
+
+// Simulate 与 Work 一样运行 runs 次，但是使用虚拟时钟和以 seed 为种子的随机数，
+// 所以它立即返回，而且结果只取决于 s、runs 和 seed
+// 它按照 channel 的语义模拟：无缓冲时发送方等待接收方，有缓冲时缓冲满了才等待
+// s 的参数不合法（如 NumIcers 小于 1）时 Simulate 会 panic，与 Work 相同
+func (s *Shop) Simulate(runs int, seed int64) Stats {
+	if err := s.validate(); err != nil {
+		panic(err)
+	}
+	m := &sim{shop: s, rng: rand.New(rand.NewSource(seed))}
+	m.bake = stage{name: "烘焙", workers: 1, mean: s.BakeTime, stddev: s.BakeStdDev}
+	m.ice = stage{name: "上糖", workers: s.NumIcers, mean: s.IceTime, stddev: s.IceStdDev}
+	m.inscribe = stage{name: "雕花", workers: 1, mean: s.InscribeTime, stddev: s.InscribeStdDev}
+	m.baked = buffer{cap: s.BakeBuf}
+	m.iced = buffer{cap: s.IceBuf}
+	m.bake.out, m.ice.in, m.ice.out, m.inscribe.in = &m.baked, &m.baked, &m.iced, &m.iced
+
+	for run := 0; run < runs; run++ {
+		m.run()
+	}
+
+	st := Stats{
+		Runs:       runs,
+		Cakes:      m.inscribe.done,
+		Elapsed:    m.now,
+		Bakers:     m.bake.stats(m.now),
+		Icers:      m.ice.stats(m.now),
+		Inscribers: m.inscribe.stats(m.now),
+		BakeBuf:    m.baked.stats(),
+		IceBuf:     m.iced.stats(),
+	}
+	if m.now > 0 {
+		st.Throughput = float64(st.Cakes) / m.now.Seconds()
+	}
+	return st
+}
+
+// sim 是一次模拟的状态，它是离散事件模拟：唯一的事件是工人完成一个蛋糕，
+// 其他的一切（接收、发送、开始下一个蛋糕）都在事件发生的同一时刻完成
+type sim struct {
+	shop   *Shop
+	rng    *rand.Rand
+	now    time.Duration // 虚拟时钟
+	events events
+
+	bake, ice, inscribe stage
+	baked, iced         buffer
+	next                int // 下一个要烘焙的蛋糕
+}
+
+type stage struct {
+	name            string
+	workers         int
+	mean, stddev    time.Duration
+	in, out         *buffer // 烘焙没有 in，雕花没有 out
+	done            int
+	busy, blocked   time.Duration
+	starved         time.Duration
+	runBusy, runBlk time.Duration // 本次运行中的 busy 和 blocked，starved 在运行结束时才能算出
+}
+
+// worker 是一个工人，c 是正在处理或等待发送的蛋糕
+type worker struct {
+	st    *stage
+	c     cake
+	since time.Duration // 完成 c 的时间
+}
+
+// item 是缓冲槽中的一个蛋糕
+type item struct {
+	c     cake
+	ready time.Duration // 上一阶段完成它的时间
+}
+
+type buffer struct {
+	cap       int
+	items     []item
+	senders   []*worker // 缓冲满时等待发送的工人
+	receivers []*worker // 缓冲空时等待接收的工人
+	waits     []time.Duration
+}
+
+func (m *sim) run() {
+	start := m.now
+	m.next = 0
+	m.baked.items, m.baked.senders, m.baked.receivers = nil, nil, nil
+	m.iced.items, m.iced.senders, m.iced.receivers = nil, nil, nil
+	for _, st := range []*stage{&m.bake, &m.ice, &m.inscribe} {
+		st.runBusy, st.runBlk = 0, 0
+		for i := 0; i < st.workers; i++ {
+			m.free(&worker{st: st})
+		}
+	}
+	for done := 0; done < m.shop.Cakes; {
+		if m.events.Len() == 0 {
+			panic("cake: all workers are blocked - deadlock!") // validate 保证了不会发生
+		}
+		e := heap.Pop(&m.events).(event)
+		m.now = e.t
+		if e.w.st == &m.inscribe {
+			done++
+		}
+		m.finish(e.w)
+	}
+	// 剩下的工人都在等待接收，其余的时间都算作等待上一阶段
+	elapsed := m.now - start
+	for _, st := range []*stage{&m.bake, &m.ice, &m.inscribe} {
+		st.starved += time.Duration(st.workers)*elapsed - st.runBusy - st.runBlk
+		st.busy += st.runBusy
+		st.blocked += st.runBlk
+	}
+}
+
+// free 让空闲的工人开始下一个蛋糕，没有蛋糕时等待
+func (m *sim) free(w *worker) {
+	if w.st.in == nil {
+		if m.next < m.shop.Cakes {
+			m.start(w, cake(m.next))
+			m.next++
+		}
+		return // 全部烘焙完了，工人退出
+	}
+	if c, ok := m.take(w.st.in); ok {
+		m.start(w, c)
+		return
+	}
+	w.st.in.receivers = append(w.st.in.receivers, w)
+}
+
+func (m *sim) start(w *worker, c cake) {
+	if m.shop.Verbose {
+		fmt.Printf("%8v %s中…… %d\n", m.now, w.st.name, c)
+	}
+	d := w.st.mean + time.Duration(m.rng.NormFloat64()*float64(w.st.stddev))
+	if d < 0 {
+		d = 0 // 与 time.Sleep 一样
+	}
+	w.c = c
+	w.st.runBusy += d
+	m.events.push(event{t: m.now + d, w: w})
+}
+
+// finish 处理工人完成一个蛋糕的事件
+func (m *sim) finish(w *worker) {
+	w.st.done++
+	w.since = m.now
+	b := w.st.out
+	switch {
+	case b == nil:
+		if m.shop.Verbose {
+			fmt.Printf("%8v 完成 %d\n", m.now, w.c)
+		}
+		m.free(w)
+	case len(b.receivers) > 0: // 缓冲一定是空的，直接交给等待的工人
+		r := b.receivers[0]
+		b.receivers = b.receivers[1:]
+		b.waits = append(b.waits, 0)
+		m.start(r, w.c)
+		m.free(w)
+	case len(b.items) < b.cap:
+		b.items = append(b.items, item{w.c, m.now})
+		m.free(w)
+	default:
+		b.senders = append(b.senders, w)
+	}
+}
+
+// take 从 b 中接收一个蛋糕，如果有工人在等待发送，就让这个工人继续
+func (m *sim) take(b *buffer) (cake, bool) {
+	var it item
+	var sender *worker
+	if len(b.senders) > 0 {
+		sender = b.senders[0]
+		b.senders = b.senders[1:]
+	}
+	switch {
+	case len(b.items) > 0:
+		it = b.items[0]
+		b.items = b.items[1:]
+		if sender != nil {
+			b.items = append(b.items, item{sender.c, sender.since})
+		}
+	case sender != nil: // 无缓冲
+		it = item{sender.c, sender.since}
+	default:
+		return 0, false
+	}
+	b.waits = append(b.waits, m.now-it.ready)
+	if sender != nil {
+		sender.st.runBlk += m.now - sender.since
+		m.free(sender)
+	}
+	return it.c, true
+}
+
+func (st *stage) stats(elapsed time.Duration) StageStats {
+	s := StageStats{
+		Workers: st.workers,
+		Done:    st.done,
+		Busy:    st.busy,
+		Starved: st.starved,
+		Blocked: st.blocked,
+	}
+	if elapsed > 0 {
+		s.Throughput = float64(st.done) / elapsed.Seconds()
+		s.Utilization = float64(st.busy) / float64(time.Duration(st.workers)*elapsed)
+	}
+	return s
+}
+
+func (b *buffer) stats() BufferStats {
+	s := BufferStats{Cap: b.cap}
+	if len(b.waits) == 0 {
+		return s
+	}
+	sort.Slice(b.waits, func(i, j int) bool { return b.waits[i] < b.waits[j] })
+	var sum time.Duration
+	for _, w := range b.waits {
+		sum += w
+	}
+	s.Mean = sum / time.Duration(len(b.waits))
+	s.P50 = percentile(b.waits, 50)
+	s.P90 = percentile(b.waits, 90)
+	s.P99 = percentile(b.waits, 99)
+	s.Max = b.waits[len(b.waits)-1]
+	return s
+}
+
+// percentile 返回排好序的 sorted 的第 p 百分位数（nearest-rank）
+func percentile(sorted []time.Duration, p int) time.Duration {
+	i := (p*len(sorted)+99)/100 - 1
+	if i < 0 {
+		i = 0
+	}
+	return sorted[i]
+}
+
+// event 是工人 w 在 t 时刻完成一个蛋糕，seq 使同时发生的事件按加入的顺序处理
+type event struct {
+	t   time.Duration
+	seq int
+	w   *worker
+}
+
+// events 是以 t 排序的最小堆
+type events struct {
+	heap []event
+	seq  int
+}
+
+func (q *events) push(e event) {
+	q.seq++
+	e.seq = q.seq
+	heap.Push(q, e)
+}
+
+// 以下方法实现 heap.Interface
+
+func (q *events) Len() int { return len(q.heap) }
+func (q *events) Less(i, j int) bool {
+	a, b := q.heap[i], q.heap[j]
+	return a.t < b.t || a.t == b.t && a.seq < b.seq
+}
+func (q *events) Swap(i, j int)      { q.heap[i], q.heap[j] = q.heap[j], q.heap[i] }
+func (q *events) Push(x interface{}) { q.heap = append(q.heap, x.(event)) }
+
+func (q *events) Pop() interface{} {
+	e := q.heap[len(q.heap)-1]
+	q.heap = q.heap[:len(q.heap)-1]
+	return e
+}
+
+// Fprint 将 st 以表格的形式写入 w
+func (st Stats) Fprint(w io.Writer) {
+	fmt.Fprintf(w, "%d 次运行，%d 个蛋糕，用时 %v，每秒 %.1f 个\n", st.Runs, st.Cakes, st.Elapsed, st.Throughput)
+	tw := new(tabwriter.Writer).Init(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintf(tw, "stage\tworkers\tdone\tthroughput/s\tutilization\tbusy\tstarved\tblocked\n")
+	for _, s := range []struct {
+		name string
+		StageStats
+	}{{"bake", st.Bakers}, {"ice", st.Icers}, {"inscribe", st.Inscribers}} {
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%.1f\t%.0f%%\t%v\t%v\t%v\n", s.name, s.Workers, s.Done,
+			s.Throughput, 100*s.Utilization, s.Busy, s.Starved, s.Blocked)
+	}
+	fmt.Fprintf(tw, "\nbuffer\tcap\tmean\tp50\tp90\tp99\tmax\n")
+	for _, b := range []struct {
+		name string
+		BufferStats
+	}{{"baked", st.BakeBuf}, {"iced", st.IceBuf}} {
+		fmt.Fprintf(tw, "%s\t%d\t%v\t%v\t%v\t%v\t%v\n", b.name, b.Cap, b.Mean, b.P50, b.P90, b.P99, b.Max)
+	}
+	tw.Flush()
+}
+
+// SweepResult 是 Sweep 中一组参数的模拟结果
+type SweepResult struct {
+	BakeBuf, IceBuf, NumIcers int
+	Stats                     Stats
+}
+
+// Sweep 对 bakeBufs、iceBufs 和 numIcers 的每种组合模拟 s，其他参数不变
+// 每种组合使用同一个 seed，所以结果之间的差别只来自参数
+// 各组合在不同的 goroutine 中模拟，结果按 bakeBufs、iceBufs、numIcers 的嵌套顺序排列
+func (s Shop) Sweep(bakeBufs, iceBufs, numIcers []int, runs int, seed int64) []SweepResult {
+	s.Verbose = false
+	var results []SweepResult
+	for _, bb := range bakeBufs {
+		for _, ib := range iceBufs {
+			for _, n := range numIcers {
+				shop := s
+				shop.BakeBuf, shop.IceBuf, shop.NumIcers = bb, ib, n
+				if err := shop.validate(); err != nil {
+					panic(err) // 在调用方的 goroutine 中 panic，而不是在下面的 goroutine 中
+				}
+				results = append(results, SweepResult{BakeBuf: bb, IceBuf: ib, NumIcers: n})
+			}
+		}
+	}
+	var wg sync.WaitGroup
+	for i := range results {
+		wg.Add(1)
+		go func(r *SweepResult) {
+			defer wg.Done()
+			shop := s
+			shop.BakeBuf, shop.IceBuf, shop.NumIcers = r.BakeBuf, r.IceBuf, r.NumIcers
+			r.Stats = shop.Simulate(runs, seed)
+		}(&results[i])
+	}
+	wg.Wait()
+	return results
+}
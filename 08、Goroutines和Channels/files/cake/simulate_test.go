@@ -0,0 +1,147 @@
+package cake_test
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gostudy/08、Goroutines和Channels/files/cake"
+)
+
+// 没有随机性时，模拟的时间可以直接算出来，与上面的基准测试中注释的时间相近
+func TestSimulate(t *testing.T) {
+	ms := time.Millisecond
+	for _, test := range []struct {
+		name    string
+		shop    cake.Shop
+		elapsed time.Duration
+	}{
+		// 流水线：第一个蛋糕需要 30ms，之后每 10ms 完成一个
+		{"baseline", defaults, 220 * ms},
+		{"buffers", with(defaults, func(s *cake.Shop) { s.BakeBuf, s.IceBuf = 10, 10 }), 220 * ms},
+		// 上糖是瓶颈：10ms + 20×50ms + 10ms
+		{"slow icing", with(defaults, func(s *cake.Shop) { s.IceTime = 50 * ms }), 1020 * ms},
+		// 5 位上糖师跟得上烘焙，最后一个蛋糕 200ms 烤好
+		{"many icers", with(defaults, func(s *cake.Shop) { s.IceTime, s.NumIcers = 50*ms, 5 }), 260 * ms},
+	} {
+		test.shop.Verbose = false
+		st := test.shop.Simulate(2, 1)
+		if st.Elapsed != 2*test.elapsed || st.Cakes != 40 {
+			t.Errorf("%s: %d cakes in %v, want 40 in %v", test.name, st.Cakes, st.Elapsed, 2*test.elapsed)
+		}
+	}
+
+	// 上糖慢时烘焙师大部分时间在等待上糖师接收：除了第一个蛋糕，每个蛋糕都要等 40ms
+	slow := with(defaults, func(s *cake.Shop) { s.IceTime = 50 * ms })
+	st := slow.Simulate(1, 1)
+	if st.Bakers.Busy != 200*ms || st.Bakers.Blocked != 19*40*ms || st.Icers.Utilization < 0.98 {
+		t.Errorf("slow icing: bakers %+v, icers %+v", st.Bakers, st.Icers)
+	}
+	if st.BakeBuf.Max != 40*ms || st.BakeBuf.P50 != 40*ms || st.IceBuf.Max != 0 {
+		t.Errorf("slow icing: buffers %+v %+v", st.BakeBuf, st.IceBuf)
+	}
+}
+
+func with(s cake.Shop, f func(s *cake.Shop)) cake.Shop {
+	f(&s)
+	return s
+}
+
+func variable() cake.Shop {
+	s := defaults
+	s.Verbose = false
+	s.BakeStdDev = s.BakeTime / 4
+	s.IceStdDev = s.IceTime / 4
+	s.InscribeStdDev = s.InscribeTime / 4
+	return s
+}
+
+func TestSimulateStats(t *testing.T) {
+	s := variable()
+	s.NumIcers, s.BakeBuf = 2, 3
+	st := s.Simulate(5, 42)
+	if !reflect.DeepEqual(st, s.Simulate(5, 42)) {
+		t.Error("same seed, different results")
+	}
+	if reflect.DeepEqual(st, s.Simulate(5, 43)) {
+		t.Error("different seeds, same results")
+	}
+	for _, stage := range []cake.StageStats{st.Bakers, st.Icers, st.Inscribers} {
+		if stage.Done != 100 {
+			t.Errorf("%+v: done %d, want 100", stage, stage.Done)
+		}
+		if total := stage.Busy + stage.Idle(); total != time.Duration(stage.Workers)*st.Elapsed {
+			t.Errorf("%+v: busy + idle = %v, want %d × %v", stage, total, stage.Workers, st.Elapsed)
+		}
+	}
+	for _, b := range []cake.BufferStats{st.BakeBuf, st.IceBuf} {
+		if !(b.P50 <= b.P90 && b.P90 <= b.P99 && b.P99 <= b.Max && b.Mean <= b.Max) {
+			t.Errorf("buffer stats out of order: %+v", b)
+		}
+	}
+}
+
+// 与 BenchmarkVariable 和 BenchmarkVariableBuffers 相同的结论：缓冲区减少了变异性造成的延误
+func TestSweep(t *testing.T) {
+	shop := variable()
+	results := shop.Sweep([]int{0, 10}, []int{0, 10}, []int{1, 2}, 20, 1)
+	if len(results) != 8 {
+		t.Fatalf("%d results, want 8", len(results))
+	}
+	if r := results[5]; r.BakeBuf != 10 || r.IceBuf != 0 || r.NumIcers != 2 {
+		t.Errorf("results[5] = %d, %d, %d; want 10, 0, 2", r.BakeBuf, r.IceBuf, r.NumIcers)
+	}
+	unbuffered, buffered := results[0], results[6]
+	if buffered.Stats.Elapsed >= unbuffered.Stats.Elapsed {
+		t.Errorf("buffered %v, unbuffered %v: buffers did not help", buffered.Stats.Elapsed, unbuffered.Stats.Elapsed)
+	}
+	if buffered.Stats.Bakers.Blocked >= unbuffered.Stats.Bakers.Blocked {
+		t.Errorf("bakers blocked %v with buffers, %v without", buffered.Stats.Bakers.Blocked, unbuffered.Stats.Bakers.Blocked)
+	}
+	for _, r := range results {
+		s := with(variable(), func(s *cake.Shop) { s.BakeBuf, s.IceBuf, s.NumIcers = r.BakeBuf, r.IceBuf, r.NumIcers })
+		if r.Stats != s.Simulate(20, 1) {
+			t.Errorf("%d/%d/%d: Sweep differs from Simulate", r.BakeBuf, r.IceBuf, r.NumIcers)
+		}
+	}
+}
+
+// 参数不合法时 Simulate 和 Sweep 在调用方的 goroutine 中 panic，而不是死锁或者在别的 goroutine 中 panic
+func TestSimulateInvalid(t *testing.T) {
+	for _, test := range []struct {
+		name string
+		f    func(s cake.Shop)
+		want string
+	}{
+		{"Simulate", func(s cake.Shop) { s.NumIcers = 0; s.Simulate(1, 1) }, "NumIcers"},
+		{"Simulate", func(s cake.Shop) { s.IceBuf = -1; s.Simulate(1, 1) }, "negative buffer"},
+		{"Sweep", func(s cake.Shop) { s.Sweep([]int{0}, []int{0}, []int{1, 0}, 1, 1) }, "NumIcers"},
+		{"Sweep", func(s cake.Shop) { s.Sweep([]int{-1}, []int{0}, []int{1}, 1, 1) }, "negative buffer"},
+	} {
+		func() {
+			defer func() {
+				if err, _ := recover().(error); err == nil || !strings.Contains(err.Error(), test.want) {
+					t.Errorf("%s panicked with %v, want %q", test.name, err, test.want)
+				}
+			}()
+			test.f(variable())
+		}()
+	}
+}
+
+func ExampleStats_Fprint() {
+	s := cake.Shop{Cakes: 20, BakeTime: 10 * time.Millisecond, NumIcers: 5, IceTime: 50 * time.Millisecond, InscribeTime: 10 * time.Millisecond}
+	s.Simulate(1, 1).Fprint(os.Stdout)
+	// Output:
+	// 1 次运行，20 个蛋糕，用时 260ms，每秒 76.9 个
+	// stage     workers  done  throughput/s  utilization  busy   starved  blocked
+	// bake      1        20    76.9          77%          200ms  60ms     0s
+	// ice       5        20    76.9          77%          1s     300ms    0s
+	// inscribe  1        20    76.9          77%          200ms  60ms     0s
+	//
+	// buffer  cap  mean  p50  p90  p99  max
+	// baked   0    0s    0s   0s   0s   0s
+	// iced    0    0s    0s   0s   0s   0s
+}
@@ -0,0 +1,122 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+)
+
+// Config 是流水线的配置文件，例如：
+//
+//	{
+//		"ordered": true,
+//		"stages": [
+//			{"name": "bake", "workers": 1, "buffer": 10},
+//			{"name": "ice", "workers": 5, "buffer": 10},
+//			{"name": "inscribe"}
+//		]
+//	}
+//
+// 处理函数不能写在配置文件中，Func 是它在 Funcs 中的名字，为空时与 Name 相同
+type Config struct {
+	Ordered bool          `json:"ordered"`
+	Stages  []StageConfig `json:"stages"`
+}
+
+// StageConfig 是配置文件中的一个阶段
+type StageConfig struct {
+	Name    string `json:"name"`
+	Func    string `json:"func,omitempty"`
+	Workers int    `json:"workers,omitempty"`
+	Buffer  int    `json:"buffer,omitempty"`
+}
+
+// StageFunc 是可以在配置文件中按名字引用的处理函数，用 F 构造
+// 配置文件在运行时才读取，所以阶段之间的类型由 Build 在运行时检查
+type StageFunc struct {
+	in, out reflect.Type
+	stage   func(i int, name string, workers, buffer int) stage
+}
+
+// F 把 fn 包装成 StageFunc
+func F[In, Out any](fn Func[In, Out]) StageFunc {
+	return StageFunc{
+		in:  typeOf[In](),
+		out: typeOf[Out](),
+		stage: func(i int, name string, workers, buffer int) stage {
+			return newStage(i, Stage[In, Out]{Name: name, Func: fn, Workers: workers, Buffer: buffer})
+		},
+	}
+}
+
+// typeOf 返回 T 的类型，T 是接口类型时也是如此
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+// Funcs 把配置文件中的名字映射为处理函数
+type Funcs map[string]StageFunc
+
+// LoadConfig 读取配置文件
+func LoadConfig(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return c, nil
+}
+
+// ParseConfig 从 r 中读取配置，未知的字段是错误
+func ParseConfig(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	return &c, nil
+}
+
+// Build 用 funcs 中的处理函数构造 c 描述的输入为 In、输出为 Out 的流水线
+// 前一个阶段的输出类型必须与后一个阶段的输入类型相同
+func Build[In, Out any](c *Config, funcs Funcs) (*Pipeline[In, Out], error) {
+	if len(c.Stages) == 0 {
+		return nil, errors.New("pipeline: no stages")
+	}
+	p := &Pipeline[In, Out]{ordered: c.Ordered}
+	var prev string
+	out := typeOf[In]()
+	for i, s := range c.Stages {
+		name := s.Func
+		if name == "" {
+			name = s.Name
+		}
+		fn, ok := funcs[name]
+		if !ok || fn.stage == nil {
+			return nil, fmt.Errorf("pipeline: %s: unknown func %q", s.Name, name)
+		}
+		if s.Workers < 0 || s.Buffer < 0 {
+			return nil, fmt.Errorf("pipeline: %s: negative workers or buffer", s.Name)
+		}
+		if fn.in != out && i == 0 {
+			return nil, fmt.Errorf("pipeline: the input is %v, but %s wants %v", out, s.Name, fn.in)
+		}
+		if fn.in != out {
+			return nil, fmt.Errorf("pipeline: %s outputs %v, but %s wants %v", prev, out, s.Name, fn.in)
+		}
+		p.stages = append(p.stages, fn.stage(i, s.Name, s.Workers, s.Buffer))
+		prev, out = p.stages[i].name, fn.out
+	}
+	if want := typeOf[Out](); out != want {
+		return nil, fmt.Errorf("pipeline: %s outputs %v, but the output is %v", prev, out, want)
+	}
+	return p, nil
+}
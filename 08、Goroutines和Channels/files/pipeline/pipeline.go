@@ -0,0 +1,295 @@
+// Package pipeline 是 cake.Shop 的一般化：若干个阶段用 channel 串联，每个阶段有自己的 worker 数和缓冲槽
+// 每个阶段的处理函数的类型是 Func[In, Out]，New 和 Then 用类型参数把阶段串联起来，
+// 前一个阶段的 Out 必须与后一个阶段的 In 相同，所以类型错误在编译时就会发现，而不是在运行中
+// 阶段之间的 channel 也是有类型的，值在阶段之间传递时不需要装箱
+// 任何一个阶段出错时，整个流水线被取消，上游的阶段也不再继续
+package pipeline
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Func 是一个阶段的处理函数，它应当在 ctx 被取消时尽快返回
+type Func[In, Out any] func(ctx context.Context, in In) (Out, error)
+
+// Stage 描述流水线的一个阶段
+type Stage[In, Out any] struct {
+	Name    string
+	Func    Func[In, Out]
+	Workers int // 同时运行 Func 的 goroutine 数，0 表示 1
+	Buffer  int // 输出 channel 的容量
+}
+
+// Pipeline 是输入为 In、输出为 Out 的流水线，它可以多次运行，也可以被多个 goroutine 同时使用
+type Pipeline[In, Out any] struct {
+	stages  []stage
+	ordered bool
+}
+
+// stage 是去掉了类型参数的阶段，start 的 in 是 <-chan item[In]，返回 <-chan item[Out]
+type stage struct {
+	name    string
+	workers int
+	buffer  int
+	start   func(r *run, in interface{}, m *Metrics) interface{}
+}
+
+// New 返回只有一个阶段 s 的流水线，ordered 为 true 时输出的顺序与输入相同
+// 与 make 相同，s.Workers 或 s.Buffer 为负数时 panic；s.Func 为 nil 时也会 panic
+func New[In, Out any](ordered bool, s Stage[In, Out]) *Pipeline[In, Out] {
+	return &Pipeline[In, Out]{stages: []stage{newStage(0, s)}, ordered: ordered}
+}
+
+// Then 返回在 p 的最后加上阶段 s 的新流水线，p 本身不变
+// s 的输入类型必须是 p 的输出类型，这由编译器检查
+func Then[In, Mid, Out any](p *Pipeline[In, Mid], s Stage[Mid, Out]) *Pipeline[In, Out] {
+	n := len(p.stages)
+	stages := append(p.stages[:n:n], newStage(n, s)) // 不与 p 共用底层数组
+	return &Pipeline[In, Out]{stages: stages, ordered: p.ordered}
+}
+
+// newStage 检查 s，返回去掉了类型参数的阶段，i 是它在流水线中的位置
+func newStage[In, Out any](i int, s Stage[In, Out]) stage {
+	if s.Name == "" {
+		s.Name = fmt.Sprintf("stage %d", i)
+	}
+	if s.Func == nil {
+		panic(fmt.Sprintf("pipeline: %s: nil Func", s.Name))
+	}
+	if s.Workers < 0 || s.Buffer < 0 {
+		panic(fmt.Sprintf("pipeline: %s: negative workers or buffer", s.Name))
+	}
+	if s.Workers == 0 {
+		s.Workers = 1
+	}
+	return stage{
+		name:    s.Name,
+		workers: s.Workers,
+		buffer:  s.Buffer,
+		start: func(r *run, in interface{}, m *Metrics) interface{} {
+			return runStage(r, in.(<-chan item[In]), &s, m)
+		},
+	}
+}
+
+// Source 通过 emit 把输入送入流水线，emit 在流水线被取消后返回非 nil 的错误，此时 Source 应当返回
+type Source[T any] func(ctx context.Context, emit func(v T) error) error
+
+// Slice 返回依次发送 values 中各个元素的 Source
+func Slice[T any](values []T) Source[T] {
+	return func(ctx context.Context, emit func(T) error) error {
+		for _, v := range values {
+			if err := emit(v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Metrics 是一次运行中一个阶段的统计，时间是所有 worker 的总和
+type Metrics struct {
+	Stage   string
+	Workers int
+	In      int64         // 开始处理的值的数量
+	Out     int64         // 成功处理的值的数量
+	Errors  int64         // Func 返回错误的次数
+	Busy    time.Duration // 运行 Func 的时间
+	Idle    time.Duration // 等待上一阶段的时间
+	Blocked time.Duration // 等待下一阶段接收的时间
+}
+
+// StageError 是一个阶段处理某个值时返回的错误
+type StageError struct {
+	Stage string
+	Value interface{}
+	Err   error
+}
+
+func (e *StageError) Error() string {
+	return fmt.Sprintf("pipeline: %s(%v): %v", e.Stage, e.Value, e.Err)
+}
+
+func (e *StageError) Unwrap() error { return e.Err }
+
+// item 是在 channel 之间传递的值，seq 是它在输入中的序号
+type item[T any] struct {
+	seq int64
+	v   T
+}
+
+// run 是一次运行的状态
+type run struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	once    sync.Once
+	err     error         // 第一个错误，由 once 守护
+	window  chan struct{} // ordered 时限制输入和输出之间的值的数量
+	metrics []Metrics     // 用 atomic 访问
+}
+
+// fail 记录第一个错误，并取消整个流水线
+func (r *run) fail(err error) {
+	r.once.Do(func() {
+		r.err = err
+		r.cancel()
+	})
+}
+
+// abort 在取消使某个值没有被处理完时调用：外部的取消没有经过 fail，在这里记录它
+// 所有的值都已经交给 sink 之后的取消不会调用 abort，所以不算失败
+func (r *run) abort() {
+	r.fail(r.ctx.Err())
+}
+
+// Run 从 src 读取输入，送入各个阶段，并把最后一个阶段的每个输出交给 sink
+// sink 总是在调用 Run 的 goroutine 中被调用；ordered 时按输入的顺序，否则按完成的顺序
+// Source、某个阶段或 sink 返回错误，或者 ctx 被取消时，其他阶段都会停止，Run 返回第一个错误；
+// ctx 在所有的值都交给 sink 之后才被取消时，Run 返回 nil
+// Run 返回时它启动的 goroutine 都已经退出
+func (p *Pipeline[In, Out]) Run(ctx context.Context, src Source[In], sink func(v Out) error) ([]Metrics, error) {
+	r := &run{metrics: make([]Metrics, len(p.stages))}
+	r.ctx, r.cancel = context.WithCancel(ctx)
+	defer r.cancel()
+	if p.ordered {
+		// 窗口的大小是流水线中最多能容纳的值的数量，所以它不会限制吞吐量，
+		// 但是保证了等待重排的值不会无限增长
+		n := 1
+		for _, s := range p.stages {
+			n += s.workers + s.buffer
+		}
+		r.window = make(chan struct{}, n)
+	}
+	for i, s := range p.stages {
+		r.metrics[i].Stage, r.metrics[i].Workers = s.name, s.workers
+	}
+
+	in := make(chan item[In])
+	go source(r, in, src)
+	var ch interface{} = (<-chan item[In])(in)
+	for i, s := range p.stages {
+		ch = s.start(r, ch, &r.metrics[i])
+	}
+	out := ch.(<-chan item[Out])
+
+	// 重排缓冲区：ordered 时，提前完成的值在这里等待前面的值
+	pending := make(map[int64]Out)
+	var next int64
+	deliver := func(v Out) {
+		if r.ctx.Err() != nil {
+			r.abort() // 已经失败或被取消，丢弃剩下的值
+			return
+		}
+		if err := sink(v); err != nil {
+			r.fail(err)
+		}
+	}
+	for it := range out {
+		if !p.ordered {
+			deliver(it.v)
+			continue
+		}
+		pending[it.seq] = it.v
+		for v, ok := pending[next]; ok; v, ok = pending[next] {
+			delete(pending, next)
+			next++
+			deliver(v)
+			<-r.window
+		}
+	}
+
+	// 所有的 channel 都已经关闭，所有 goroutine 都已经退出
+	return r.metrics, r.err
+}
+
+// source 在一个新的 goroutine 中运行 src，把它的输出发送到 out
+func source[T any](r *run, out chan<- item[T], src Source[T]) {
+	defer close(out)
+	var seq int64
+	emit := func(v T) error {
+		if r.window != nil {
+			select {
+			case r.window <- struct{}{}:
+			case <-r.ctx.Done():
+				r.abort()
+				return r.ctx.Err()
+			}
+		}
+		select {
+		case out <- item[T]{seq, v}:
+			seq++
+			return nil
+		case <-r.ctx.Done():
+			r.abort()
+			return r.ctx.Err()
+		}
+	}
+	if err := src(r.ctx, emit); err != nil {
+		if r.ctx.Err() != nil {
+			r.abort() // src 因为取消而返回，它的错误通常就是 ctx.Err()
+		} else {
+			r.fail(err)
+		}
+	}
+}
+
+// runStage 启动 s 的 worker，返回它的输出 channel；所有 worker 退出后输出 channel 被关闭
+func runStage[In, Out any](r *run, in <-chan item[In], s *Stage[In, Out], m *Metrics) <-chan item[Out] {
+	out := make(chan item[Out], s.Buffer)
+	var wg sync.WaitGroup
+	for i := 0; i < s.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// 取消之后上游也会停止并关闭 in；等到 in 关闭再退出，
+			// 这样最后一个 channel 关闭时所有的 goroutine 都已经退出
+			defer func() {
+				for range in {
+				}
+			}()
+			for {
+				t0 := time.Now()
+				it, ok := <-in
+				t1 := time.Now()
+				atomic.AddInt64((*int64)(&m.Idle), int64(t1.Sub(t0)))
+				if !ok {
+					return // 上一阶段结束了
+				}
+				if r.ctx.Err() != nil {
+					r.abort() // 流水线被取消了，丢弃 it
+					return
+				}
+				atomic.AddInt64(&m.In, 1)
+				v, err := s.Func(r.ctx, it.v)
+				t2 := time.Now()
+				atomic.AddInt64((*int64)(&m.Busy), int64(t2.Sub(t1)))
+				if err != nil {
+					atomic.AddInt64(&m.Errors, 1)
+					if r.ctx.Err() != nil {
+						r.abort() // Func 因为取消而返回，它的错误不是失败的原因
+					} else {
+						r.fail(&StageError{s.Name, it.v, err})
+					}
+					return
+				}
+				atomic.AddInt64(&m.Out, 1)
+				select {
+				case out <- item[Out]{it.seq, v}:
+				case <-r.ctx.Done():
+					r.abort()
+					return
+				}
+				atomic.AddInt64((*int64)(&m.Blocked), int64(time.Since(t2)))
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
@@ -0,0 +1,284 @@
+package pipeline_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"gostudy/08、Goroutines和Channels/files/pipeline"
+)
+
+func square(ctx context.Context, x int) (int, error)  { return x * x, nil }
+func itoa(ctx context.Context, x int) (string, error) { return strconv.Itoa(x), nil }
+
+// sleepy 按 x 的大小倒序睡眠，使较早的输入较晚完成
+func sleepy(ctx context.Context, x int) (int, error) {
+	time.Sleep(time.Duration(10-x%10) * time.Millisecond)
+	return x, nil
+}
+
+func ints(n int) []int {
+	var s []int
+	for i := 0; i < n; i++ {
+		s = append(s, i)
+	}
+	return s
+}
+
+func TestNew(t *testing.T) {
+	for _, test := range []struct {
+		stage pipeline.Stage[int, int]
+		panic string
+	}{
+		{pipeline.Stage[int, int]{Name: "nil"}, "nil: nil Func"},
+		{pipeline.Stage[int, int]{Func: square, Workers: -1}, "stage 0: negative workers"},
+		{pipeline.Stage[int, int]{Name: "sq", Func: square, Buffer: -1}, "sq: negative workers or buffer"},
+	} {
+		func() {
+			defer func() {
+				if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), test.panic) {
+					t.Errorf("New(%+v) panic = %v, want %q", test.stage, r, test.panic)
+				}
+			}()
+			pipeline.New(false, test.stage)
+		}()
+	}
+
+	// Then 不修改原来的流水线，它还可以单独运行，也可以接上其他阶段
+	p := pipeline.New(false, pipeline.Stage[int, int]{Func: square})
+	s := pipeline.Then(p, pipeline.Stage[int, string]{Func: itoa})
+	q := pipeline.Then(p, pipeline.Stage[int, int]{Func: square})
+	var got []string
+	if _, err := s.Run(context.Background(), pipeline.Slice([]int{3}), func(v string) error {
+		got = append(got, v)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Run(context.Background(), pipeline.Slice([]int{3}), func(v int) error {
+		got = append(got, strconv.Itoa(v))
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if metrics, err := p.Run(context.Background(), pipeline.Slice([]int{3}), func(v int) error {
+		got = append(got, strconv.Itoa(v))
+		return nil
+	}); err != nil || len(metrics) != 1 {
+		t.Fatalf("Run = %d stages, %v", len(metrics), err)
+	}
+	if strings.Join(got, " ") != "9 81 9" {
+		t.Errorf("got %v, want [9 81 9]", got)
+	}
+}
+
+func TestRun(t *testing.T) {
+	for _, ordered := range []bool{false, true} {
+		p := pipeline.Then(pipeline.Then(
+			pipeline.New(ordered, pipeline.Stage[int, int]{Name: "sleep", Func: sleepy, Workers: 8, Buffer: 2}),
+			pipeline.Stage[int, int]{Name: "square", Func: square, Workers: 3}),
+			pipeline.Stage[int, string]{Name: "itoa", Func: itoa})
+		var got []string
+		metrics, err := p.Run(context.Background(), pipeline.Slice(ints(50)), func(v string) error {
+			got = append(got, v)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var want []string
+		for i := 0; i < 50; i++ {
+			want = append(want, strconv.Itoa(i*i))
+		}
+		inOrder := fmt.Sprint(got) == fmt.Sprint(want)
+		if ordered && !inOrder {
+			t.Errorf("ordered output: %v", got)
+		}
+		if !ordered && inOrder {
+			t.Errorf("unordered output is in order, sleepy did not reorder it")
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("output %v, want %v", got, want)
+		}
+		for _, m := range metrics {
+			if m.In != 50 || m.Out != 50 || m.Errors != 0 {
+				t.Errorf("%s: in %d, out %d, errors %d", m.Stage, m.In, m.Out, m.Errors)
+			}
+		}
+		if m := metrics[0]; m.Workers != 8 || m.Busy < 50*time.Millisecond {
+			t.Errorf("sleep: %+v", m)
+		}
+	}
+}
+
+// 一个阶段出错时上游停止：无限的 Source 也会返回，Run 返回时没有留下 goroutine
+func TestStageError(t *testing.T) {
+	before := runtime.NumGoroutine()
+	errBad := errors.New("bad value")
+	p := pipeline.Then(
+		pipeline.New(true, pipeline.Stage[int, int]{Name: "square", Func: square, Workers: 4, Buffer: 4}),
+		pipeline.Stage[int, int]{Name: "check", Func: func(ctx context.Context, x int) (int, error) {
+			if x == 25 {
+				return 0, errBad
+			}
+			return x, nil
+		}, Workers: 2})
+	emitted := 0
+	infinite := func(ctx context.Context, emit func(int) error) error {
+		for i := 0; ; i++ {
+			if err := emit(i); err != nil {
+				return err
+			}
+			emitted++
+		}
+	}
+	var delivered []int
+	metrics, err := p.Run(context.Background(), infinite, func(v int) error {
+		delivered = append(delivered, v)
+		return nil
+	})
+	var se *pipeline.StageError
+	if !errors.As(err, &se) || se.Stage != "check" || se.Value != 25 || !errors.Is(err, errBad) {
+		t.Fatalf("Run = %v, want check(25) error", err)
+	}
+	if emitted > 100 {
+		t.Errorf("source emitted %d values after the error", emitted)
+	}
+	for i, v := range delivered { // ordered：出错之前的值按顺序交付，之后的都被丢弃
+		if i >= 5 || v != i*i {
+			t.Errorf("delivered %v", delivered)
+			break
+		}
+	}
+	if metrics[1].Errors != 1 {
+		t.Errorf("check: %d errors, want 1", metrics[1].Errors)
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left, want %d", n, before)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	p := pipeline.New(false, pipeline.Stage[int, int]{Func: square, Workers: 2})
+	discard := func(int) error { return nil }
+
+	// sink 出错
+	errFull := errors.New("full")
+	n := 0
+	_, err := p.Run(context.Background(), pipeline.Slice(ints(100)), func(int) error {
+		if n++; n == 3 {
+			return errFull
+		}
+		return nil
+	})
+	if err != errFull || n != 3 {
+		t.Errorf("sink error: Run = %v after %d values", err, n)
+	}
+
+	// Source 出错
+	errSource := errors.New("source")
+	_, err = p.Run(context.Background(), func(ctx context.Context, emit func(int) error) error {
+		emit(1)
+		return errSource
+	}, discard)
+	if err != errSource {
+		t.Errorf("source error: Run = %v", err)
+	}
+
+	// 外部取消
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = p.Run(ctx, pipeline.Slice(ints(100)), func(int) error {
+		cancel()
+		return nil
+	})
+	if err != context.Canceled {
+		t.Errorf("cancelled: Run = %v", err)
+	}
+
+	// 所有的值都已经交给 sink 之后才取消，运行仍然是成功的
+	ctx, cancel = context.WithCancel(context.Background())
+	n = 0
+	_, err = p.Run(ctx, pipeline.Slice(ints(10)), func(int) error {
+		if n++; n == 10 {
+			cancel()
+		}
+		return nil
+	})
+	if err != nil || n != 10 {
+		t.Errorf("cancelled after the last value: Run = %v after %d values", err, n)
+	}
+
+	// 取消时正在运行的 Func 返回 ctx.Err()，Run 报告取消，而不是 StageError
+	wait := func(ctx context.Context, x int) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	}
+	p = pipeline.New(false, pipeline.Stage[int, int]{Func: wait})
+	ctx, cancel = context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err = p.Run(ctx, pipeline.Slice(ints(3)), discard)
+	if err != context.DeadlineExceeded {
+		t.Errorf("cancelled in stage: Run = %v", err)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	funcs := pipeline.Funcs{"square": pipeline.F(square), "itoa": pipeline.F(itoa)}
+	c, err := pipeline.ParseConfig(strings.NewReader(`{
+		"ordered": true,
+		"stages": [{"name": "square", "workers": 4, "buffer": 8}, {"name": "string", "func": "itoa"}]
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := pipeline.Build[int, string](c, funcs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	metrics, err := p.Run(context.Background(), pipeline.Slice([]int{1, 2, 3}), func(v string) error {
+		got = append(got, v)
+		return nil
+	})
+	if err != nil || strings.Join(got, " ") != "1 4 9" {
+		t.Errorf("Run = %v, %v", got, err)
+	}
+	if metrics[0].Workers != 4 || metrics[1].Stage != "string" {
+		t.Errorf("metrics = %+v", metrics)
+	}
+	if _, err := pipeline.Build[int, int](c, funcs); err == nil || !strings.Contains(err.Error(), "string outputs string, but the output is int") {
+		t.Errorf("Build[int, int] = %v", err)
+	}
+	if _, err := pipeline.Build[string, string](c, funcs); err == nil || !strings.Contains(err.Error(), "the input is string, but square wants int") {
+		t.Errorf("Build[string, string] = %v", err)
+	}
+
+	if _, err := pipeline.ParseConfig(strings.NewReader(`{"stages": [{"name": "square", "threads": 2}]}`)); err == nil {
+		t.Errorf("ParseConfig with an unknown field succeeded")
+	}
+	for _, config := range []string{
+		`{"stages": []}`,
+		`{"stages": [{"name": "cube"}]}`,
+		`{"stages": [{"name": "square", "workers": -1}]}`,
+		`{"stages": [{"name": "itoa"}, {"name": "square"}]}`,
+	} {
+		c, err := pipeline.ParseConfig(strings.NewReader(config))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := pipeline.Build[int, int](c, funcs); err == nil {
+			t.Errorf("Build(%s) succeeded", config)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package thumbnail
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+)
+
+// BatchOptions 配置 Batch
+type BatchOptions struct {
+	Options        // 每个缩略图的选项
+	Workers int    // 同时处理的文件数，0 表示 runtime.NumCPU()
+	Dir     string // 缩略图写入的目录，空字符串表示与原图相同的目录
+	Force   bool   // 即使缩略图比原图新也重新生成
+	// Progress 不为 nil 时，每处理完一个文件就发送一个 Progress；Batch 返回之前会关闭它
+	Progress chan<- Progress
+}
+
+// Progress 报告一个文件的处理结果
+type Progress struct {
+	File    string // 原图
+	Thumb   string // 缩略图
+	Skipped bool   // 缩略图比原图新，没有重新生成
+	Err     error
+	Done    int // 已处理的文件数，包括这一个
+	Total   int
+}
+
+// FileError 是处理一个文件时的错误
+type FileError struct {
+	File string
+	Err  error
+}
+
+func (e *FileError) Error() string { return e.File + ": " + e.Err.Error() }
+func (e *FileError) Unwrap() error { return e.Err }
+
+// Errors 是 Batch 中所有出错的文件，按 files 中的顺序排列
+type Errors []*FileError
+
+func (e Errors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%v（以及另外 %d 个错误）", e[0], len(e)-1)
+}
+
+// CanceledError 是 Batch 被取消、并且取消之前完成的文件中有出错的时返回的错误
+// 它的 Unwrap 返回 ctx.Err()，所以可以用 errors.Is 判断取消
+type CanceledError struct {
+	Err    error  // ctx.Err()
+	Errors Errors // 取消之前完成的文件中出错的
+}
+
+func (e *CanceledError) Error() string { return e.Err.Error() + "; " + e.Errors.Error() }
+func (e *CanceledError) Unwrap() error { return e.Err }
+
+// Batch 用最多 Workers 个 goroutine 为 files 生成缩略图
+// 与 makeThumbnails4 不同，一个文件出错不会影响其他文件，所有的错误以 Errors 返回
+// 它返回成功生成或无需重新生成的缩略图，按 files 中的顺序排列
+// 两个文件的缩略图路径相同时（例如 Dir 不为空，而两个文件的名字相同），Batch 什么也不做，直接返回错误
+// ctx 被取消时不再开始新的文件，等待正在处理的文件完成后返回已经完成的缩略图和 ctx.Err()，
+// 已经完成的文件中有出错的时返回 *CanceledError；返回时所有 goroutine 都已退出
+func Batch(ctx context.Context, files []string, opts BatchOptions) ([]string, error) {
+	if opts.Progress != nil {
+		defer close(opts.Progress)
+	}
+	workers := opts.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+
+	type result struct {
+		thumb   string
+		done    bool // 已经处理，取消时没有开始的文件为 false
+		skipped bool
+		err     error
+	}
+	results := make([]result, len(files)) // 每个 worker 只写自己的下标
+	seen := make(map[string]int)          // 缩略图 -> 原图的下标
+	for i, file := range files {
+		thumb := opts.thumbPath(file)
+		if j, ok := seen[thumb]; ok {
+			return nil, fmt.Errorf("thumbnail: %s 和 %s 的缩略图都是 %s", files[j], file, thumb)
+		}
+		seen[thumb] = i
+		results[i].thumb = thumb
+	}
+	jobs := make(chan int)
+	// mu 守护 done，并且在发送 Progress 时一直持有，使收到的 Done 依次递增
+	var mu sync.Mutex
+	done := 0
+
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				r := &results[i]
+				r.skipped, r.err = opts.generate(r.thumb, files[i])
+				r.done = true
+				if opts.Progress == nil {
+					continue
+				}
+				mu.Lock()
+				done++
+				select {
+				case opts.Progress <- Progress{files[i], r.thumb, r.skipped, r.err, done, len(files)}:
+				case <-ctx.Done():
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	// 分发任务，取消时停止
+loop:
+	for i := range files {
+		if ctx.Err() != nil {
+			break // 已经取消时 select 仍可能选中发送
+		}
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	var thumbs []string
+	var errs Errors
+	for i, r := range results {
+		switch {
+		case !r.done:
+		case r.err != nil:
+			errs = append(errs, &FileError{files[i], r.err})
+		default:
+			thumbs = append(thumbs, r.thumb)
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		if errs != nil {
+			return thumbs, &CanceledError{err, errs}
+		}
+		return thumbs, err
+	}
+	if errs != nil {
+		return thumbs, errs
+	}
+	return thumbs, nil
+}
+
+// thumbPath 返回 infile 的缩略图的路径
+func (opts BatchOptions) thumbPath(infile string) string {
+	thumb := thumbName(infile)
+	if opts.Dir != "" {
+		thumb = filepath.Join(opts.Dir, filepath.Base(thumb))
+	}
+	return thumb
+}
+
+// generate 生成一个缩略图，缩略图已经比原图新时跳过
+func (opts BatchOptions) generate(thumb, infile string) (skipped bool, err error) {
+	in, err := os.Stat(infile)
+	if err != nil {
+		return false, err
+	}
+	if !opts.Force {
+		if out, err := os.Stat(thumb); err == nil && !out.ModTime().Before(in.ModTime()) {
+			return true, nil
+		}
+	}
+	return false, opts.File(thumb, infile)
+}
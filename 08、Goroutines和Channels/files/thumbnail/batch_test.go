@@ -0,0 +1,205 @@
+package thumbnail_test
+
+import (
+	"context"
+	"errors"
+	"image/png"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"gostudy/08、Goroutines和Channels/files/thumbnail"
+)
+
+// makeImages 在 dir 中生成 n 个 PNG 文件
+func makeImages(t *testing.T, dir string, n int) []string {
+	t.Helper()
+	var files []string
+	for i := 0; i < n; i++ {
+		name := filepath.Join(dir, string(rune('a'+i))+".png")
+		f, err := os.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(f, quadrants(300, 200))
+		f.Close()
+		files = append(files, name)
+	}
+	return files
+}
+
+// collect 在后台接收进度，返回的函数在 Batch 返回后调用，得到收到的所有进度
+func collect() (chan thumbnail.Progress, func() []thumbnail.Progress) {
+	ch := make(chan thumbnail.Progress)
+	done := make(chan []thumbnail.Progress)
+	go func() {
+		var ps []thumbnail.Progress
+		for p := range ch {
+			ps = append(ps, p)
+		}
+		done <- ps
+	}()
+	return ch, func() []thumbnail.Progress { return <-done }
+}
+
+func TestBatch(t *testing.T) {
+	dir := t.TempDir()
+	files := makeImages(t, dir, 6)
+	bad := filepath.Join(dir, "bad.png")
+	ioutil.WriteFile(bad, []byte("not an image"), 0644)
+	missing := filepath.Join(dir, "missing.png")
+	files = append([]string{bad}, append(files, missing)...)
+
+	ch, progress := collect()
+	opts := thumbnail.BatchOptions{Options: thumbnail.Options{Width: 30}, Workers: 3, Progress: ch}
+	thumbs, err := thumbnail.Batch(context.Background(), files, opts)
+	errs, ok := err.(thumbnail.Errors)
+	if !ok || len(errs) != 2 || errs[0].File != bad || errs[1].File != missing {
+		t.Fatalf("Batch error = %v, want errors for bad.png and missing.png", err)
+	}
+	if len(thumbs) != 6 || thumbs[0] != filepath.Join(dir, "a.thumb.png") {
+		t.Errorf("thumbs = %v", thumbs)
+	}
+	ps := progress()
+	if len(ps) != len(files) || ps[0].Total != len(files) {
+		t.Errorf("got %d progress reports, want %d", len(ps), len(files))
+	}
+	for i, p := range ps {
+		if p.Done != i+1 {
+			t.Errorf("progress %d: Done = %d, want %d", i, p.Done, i+1)
+		}
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(dir, ".*tmp*")); len(leftover) > 0 {
+		t.Errorf("temporary files left behind: %v", leftover)
+	}
+
+	// 再次运行：缩略图都比原图新，全部跳过；原图更新之后重新生成
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(files[1], future, future)
+	ch, progress = collect()
+	opts.Progress = ch
+	thumbnail.Batch(context.Background(), files[1:len(files)-1], opts)
+	var skipped int
+	for _, p := range progress() {
+		if p.Skipped {
+			skipped++
+		} else if p.File != files[1] {
+			t.Errorf("%s regenerated", p.File)
+		}
+	}
+	if skipped != 5 {
+		t.Errorf("skipped %d files, want 5", skipped)
+	}
+}
+
+func TestBatchDir(t *testing.T) {
+	src, out := t.TempDir(), t.TempDir()
+	files := makeImages(t, src, 2)
+	thumbs, err := thumbnail.Batch(context.Background(), files, thumbnail.BatchOptions{Dir: out})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, thumb := range thumbs {
+		if filepath.Dir(thumb) != out || !strings.HasSuffix(thumb, ".thumb.png") {
+			t.Errorf("thumbnail %s not in %s", thumb, out)
+		}
+		if _, err := os.Stat(thumb); err != nil {
+			t.Error(err)
+		}
+	}
+
+	// 不同目录中同名的文件会写入同一个缩略图，Batch 拒绝它们
+	other := makeImages(t, t.TempDir(), 1)
+	_, err = thumbnail.Batch(context.Background(), append(files, other...), thumbnail.BatchOptions{Dir: out})
+	if err == nil || !strings.Contains(err.Error(), "a.thumb.png") {
+		t.Errorf("Batch with clashing names = %v, want an error", err)
+	}
+}
+
+// 取消后 Batch 等待正在处理的文件完成，不留下 goroutine 和不完整的文件
+func TestBatchCancel(t *testing.T) {
+	dir := t.TempDir()
+	files := makeImages(t, dir, 20)
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan thumbnail.Progress)
+	go func() {
+		<-ch // 第一个文件完成后取消
+		cancel()
+		for range ch {
+		}
+	}()
+	made, err := thumbnail.Batch(ctx, files, thumbnail.BatchOptions{Workers: 2, Progress: ch})
+	if err != context.Canceled {
+		t.Fatalf("Batch = %v, want context.Canceled", err)
+	}
+	thumbs, _ := filepath.Glob(filepath.Join(dir, "*.thumb.png"))
+	if len(thumbs) == 0 || len(thumbs) >= len(files) {
+		t.Errorf("%d thumbnails made before cancel, want between 1 and %d", len(thumbs), len(files)-1)
+	}
+	// 取消之前完成的缩略图也被返回
+	if len(made) != len(thumbs) {
+		t.Errorf("Batch returned %d thumbnails, %d were made", len(made), len(thumbs))
+	}
+	if leftover, _ := filepath.Glob(filepath.Join(dir, ".*tmp*")); len(leftover) > 0 {
+		t.Errorf("temporary files left behind: %v", leftover)
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines after Batch returned, want %d", n, before)
+	}
+
+	// 已经取消的 ctx：什么也不做
+	if _, err := thumbnail.Batch(ctx, files, thumbnail.BatchOptions{}); err != context.Canceled {
+		t.Errorf("Batch with cancelled ctx = %v", err)
+	}
+}
+
+// 取消时已经完成的文件中的错误与 ctx.Err() 一起返回
+func TestBatchCancelErrors(t *testing.T) {
+	dir := t.TempDir()
+	bad := filepath.Join(dir, "bad.png")
+	ioutil.WriteFile(bad, []byte("not an image"), 0644)
+	files := append([]string{bad}, makeImages(t, dir, 20)...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan thumbnail.Progress)
+	go func() {
+		<-ch // bad.png 是第一个文件，只有一个 worker，所以第一个进度就是它
+		cancel()
+		for range ch {
+		}
+	}()
+	_, err := thumbnail.Batch(ctx, files, thumbnail.BatchOptions{Workers: 1, Progress: ch})
+	ce, ok := err.(*thumbnail.CanceledError)
+	if !ok || !errors.Is(err, context.Canceled) || len(ce.Errors) != 1 || ce.Errors[0].File != bad {
+		t.Errorf("Batch = %v, want CanceledError with bad.png", err)
+	}
+}
+
+// 缩略图的权限与 os.Create 创建的文件相同，遵守 umask
+func TestBatchMode(t *testing.T) {
+	dir := t.TempDir()
+	files := makeImages(t, dir, 1)
+	thumbs, err := thumbnail.Batch(context.Background(), files, thumbnail.BatchOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref, err := os.Create(filepath.Join(dir, "ref"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref.Close()
+	want, _ := os.Stat(ref.Name())
+	got, err := os.Stat(thumbs[0])
+	if err != nil || got.Mode() != want.Mode() {
+		t.Errorf("thumbnail mode = %v, want %v (%v)", got.Mode(), want.Mode(), err)
+	}
+}
@@ -0,0 +1,62 @@
+// thumbd 通过 HTTP 提供 -root 目录中图像的缩略图，缩略图缓存在 -cache 目录中
+// go run main.go -root ~/Pictures -cache /tmp/thumbs -addr localhost:8000
+// curl -o cat.jpg 'http://localhost:8000/thumb?src=cat.jpg&w=200&h=200&fit=cover'
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"time"
+
+	"gostudy/08、Goroutines和Channels/files/thumbnail"
+)
+
+var (
+	root    = flag.String("root", ".", "原图所在的目录")
+	cache   = flag.String("cache", "thumbcache", "缩略图的缓存目录")
+	addr    = flag.String("addr", "localhost:8000", "监听地址")
+	decodes = flag.Int("decodes", 0, "同时解码的图像数，0 表示 CPU 数")
+	maxSize = flag.Int("max", 2048, "缩略图的最大宽度和高度")
+)
+
+func main() {
+	flag.Parse()
+	s, err := thumbnail.NewServer(thumbnail.ServerOptions{
+		Root:       *root,
+		CacheDir:   *cache,
+		MaxDecodes: *decodes,
+		MaxSize:    *maxSize,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	srv := &http.Server{Addr: *addr, Handler: s}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	drained := make(chan struct{}) // Shutdown 返回后关闭
+	go func() {
+		defer close(drained)
+		<-ctx.Done()
+		shutdown, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := srv.Shutdown(shutdown); err != nil {
+			log.Print(err) // 超时：还有请求没有完成
+		}
+	}()
+
+	log.Printf("serving %s on http://%s/thumb", *root, *addr)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	// Shutdown 一开始 ListenAndServe 就返回了，等正在处理的请求完成之后再关闭 s
+	<-drained
+	s.Close()
+	st := s.Stats()
+	log.Printf("%d requests, %d cache hits, %d generated, %d coalesced",
+		st.Requests, st.CacheHits, st.Generated, st.Coalesced)
+}
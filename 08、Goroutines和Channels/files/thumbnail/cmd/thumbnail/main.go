@@ -0,0 +1,133 @@
+// thumbnail 为命令行参数中的图像文件生成缩略图，参数是目录时处理其中所有的 JPEG、PNG 和 GIF 文件
+// go run main.go -w 200 -h 200 -fit cover -j 4 ~/Pictures
+// 按 Ctrl-C 取消，正在处理的文件完成后退出
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+
+	"gostudy/08、Goroutines和Channels/files/thumbnail"
+)
+
+var (
+	width   = flag.Int("w", 128, "缩略图的最大宽度")
+	height  = flag.Int("h", 128, "缩略图的最大高度")
+	fit     = flag.String("fit", "contain", "contain、cover 或 stretch")
+	filter  = flag.String("filter", "lanczos", "lanczos、bicubic、bilinear 或 nearest")
+	quality = flag.Int("q", 0, "JPEG 质量（1-100），0 表示默认值")
+	workers = flag.Int("j", 0, "同时处理的文件数，0 表示 CPU 数")
+	dir     = flag.String("o", "", "缩略图的输出目录，默认与原图相同")
+	force   = flag.Bool("f", false, "即使缩略图比原图新也重新生成")
+	verbose = flag.Bool("v", false, "显示每个文件的处理结果")
+)
+
+func main() {
+	flag.Parse()
+	opts := thumbnail.BatchOptions{
+		Options: thumbnail.Options{Width: *width, Height: *height, Quality: *quality},
+		Workers: *workers,
+		Dir:     *dir,
+		Force:   *force,
+	}
+	var err error
+	if opts.Fit, err = thumbnail.ParseFit(*fit); err != nil {
+		fatal(err)
+	}
+	if opts.Filter, err = thumbnail.ParseFilter(*filter); err != nil {
+		fatal(err)
+	}
+
+	files, err := images(flag.Args())
+	if err != nil {
+		fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	progress := make(chan thumbnail.Progress)
+	opts.Progress = progress
+	printed := make(chan struct{})
+	go func() {
+		var made, skipped int
+		for p := range progress {
+			switch {
+			case p.Err != nil:
+				// 错误在最后统一打印
+			case p.Skipped:
+				skipped++
+			default:
+				made++
+			}
+			if *verbose && p.Err == nil {
+				status := "->"
+				if p.Skipped {
+					status = "== (已是最新)"
+				}
+				fmt.Printf("[%d/%d] %s %s %s\n", p.Done, p.Total, p.File, status, p.Thumb)
+			}
+		}
+		fmt.Printf("生成 %d 个缩略图，跳过 %d 个\n", made, skipped)
+		close(printed)
+	}()
+
+	_, err = thumbnail.Batch(ctx, files, opts)
+	<-printed
+	if ce, ok := err.(*thumbnail.CanceledError); ok {
+		for _, e := range ce.Errors {
+			fmt.Fprintf(os.Stderr, "thumbnail: %v\n", e)
+		}
+		fatal(ce.Err)
+	}
+	if errs, ok := err.(thumbnail.Errors); ok {
+		for _, e := range errs {
+			fmt.Fprintf(os.Stderr, "thumbnail: %v\n", e)
+		}
+		os.Exit(1)
+	} else if err != nil {
+		fatal(err)
+	}
+}
+
+// images 展开参数中的目录，返回其中的图像文件，跳过已经是缩略图的文件
+func images(args []string) ([]string, error) {
+	var files []string
+	for _, arg := range args {
+		fi, err := os.Stat(arg)
+		if err != nil {
+			return nil, err
+		}
+		if !fi.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.Walk(arg, func(path string, fi os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			name := strings.ToLower(fi.Name())
+			switch filepath.Ext(name) {
+			case ".jpg", ".jpeg", ".png", ".gif":
+				if !fi.IsDir() && !strings.Contains(name, ".thumb.") {
+					files = append(files, path)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+func fatal(err error) {
+	fmt.Fprintf(os.Stderr, "thumbnail: %v\n", err)
+	os.Exit(1)
+}
@@ -0,0 +1,144 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+)
+
+// errGroupClosed 是 close 之后 do 返回的错误
+var errGroupClosed = errors.New("group closed")
+
+// group 合并对同一个 key 的并发调用，结构与 memo5 的 monitor goroutine 相同：
+// 第一个请求启动调用，之后的请求等待同一个 ready channel；所有等待者都放弃时调用被取消
+// 与 memo5 不同的是，调用完成后 entry 就被删除，因为结果已经保存在磁盘上，失败的调用在下次请求时重试
+type group struct {
+	requests chan groupRequest
+	abandons chan groupMessage
+	finished chan groupMessage
+	quit     chan struct{} // close 时关闭
+	done     chan struct{} // monitor goroutine 退出后关闭
+}
+
+type call struct {
+	err     error
+	ready   chan struct{}      // ready 后关闭
+	cancel  context.CancelFunc // 取消 f 的调用
+	waiters int                // 正在等待 ready 的请求数，只限于 monitor goroutine
+}
+
+type groupRequest struct {
+	ctx      context.Context
+	key      string
+	f        func(ctx context.Context) error
+	response chan<- groupResponse
+}
+
+type groupResponse struct {
+	err    error
+	shared bool // 是否与之前的请求合并
+}
+
+// groupMessage 表示等待 c 的一个请求放弃了，或者 c 完成了
+type groupMessage struct {
+	key string
+	c   *call
+}
+
+func newGroup() *group {
+	g := &group{
+		requests: make(chan groupRequest),
+		abandons: make(chan groupMessage),
+		finished: make(chan groupMessage),
+		quit:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	go g.server()
+	return g
+}
+
+// do 调用 f，同一个 key 同时只有一个 f 在运行，其他请求等待它的结果
+// shared 报告这个请求是否与之前的请求合并了；close 之后 do 返回 errGroupClosed
+func (g *group) do(ctx context.Context, key string, f func(ctx context.Context) error) (shared bool, err error) {
+	select {
+	case <-g.quit:
+		return false, errGroupClosed
+	default:
+	}
+	response := make(chan groupResponse)
+	select {
+	case g.requests <- groupRequest{ctx, key, f, response}:
+	case <-g.done:
+		return false, errGroupClosed
+	}
+	res := <-response
+	return res.shared, res.err
+}
+
+// close 停止 monitor goroutine，已经被接收的请求仍然会得到结果
+func (g *group) close() { close(g.quit) }
+
+func (g *group) server() {
+	defer close(g.done)
+	calls := make(map[string]*call)
+	for {
+		select {
+		case <-g.quit:
+			return
+		case req := <-g.requests:
+			c := calls[req.key]
+			shared := c != nil
+			if c == nil {
+				ctx, cancel := context.WithCancel(context.Background())
+				c = &call{ready: make(chan struct{}), cancel: cancel}
+				calls[req.key] = c
+				go g.call(ctx, c, req.f, req.key)
+			}
+			c.waiters++
+			go g.deliver(c, req, shared)
+		case m := <-g.abandons:
+			m.c.waiters--
+			if m.c.waiters == 0 && !m.c.isReady() {
+				m.c.cancel()
+				if calls[m.key] == m.c {
+					delete(calls, m.key)
+				}
+			}
+		case m := <-g.finished:
+			if calls[m.key] == m.c {
+				delete(calls, m.key)
+			}
+		}
+	}
+}
+
+func (g *group) call(ctx context.Context, c *call, f func(context.Context) error, key string) {
+	c.err = f(ctx)
+	c.cancel()
+	close(c.ready)
+	select {
+	case g.finished <- groupMessage{key, c}:
+	case <-g.done:
+	}
+}
+
+func (g *group) deliver(c *call, req groupRequest, shared bool) {
+	select {
+	case <-c.ready:
+		req.response <- groupResponse{c.err, shared}
+	case <-req.ctx.Done():
+		select {
+		case g.abandons <- groupMessage{req.key, c}:
+		case <-g.done:
+		}
+		req.response <- groupResponse{req.ctx.Err(), shared}
+	}
+}
+
+func (c *call) isReady() bool {
+	select {
+	case <-c.ready:
+		return true
+	default:
+		return false
+	}
+}
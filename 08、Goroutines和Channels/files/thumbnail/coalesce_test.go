@@ -0,0 +1,104 @@
+package thumbnail
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	g := newGroup()
+	defer g.close()
+
+	// 第二个请求在第一个的 f 运行时到达，与它合并
+	start, release := make(chan struct{}), make(chan struct{})
+	calls := 0
+	f := func(ctx context.Context) error {
+		calls++
+		close(start)
+		<-release
+		return errors.New("failed")
+	}
+	type result struct {
+		shared bool
+		err    error
+	}
+	results := make(chan result)
+	for i := 0; i < 2; i++ {
+		go func() {
+			shared, err := g.do(context.Background(), "k", f)
+			results <- result{shared, err}
+		}()
+		if i == 0 {
+			<-start
+		}
+	}
+	time.Sleep(10 * time.Millisecond) // 等第二个请求到达 monitor goroutine
+	close(release)
+	var shared int
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err == nil || r.err.Error() != "failed" {
+			t.Errorf("err = %v, want failed", r.err)
+		}
+		if r.shared {
+			shared++
+		}
+	}
+	if calls != 1 || shared != 1 {
+		t.Errorf("%d calls, %d shared, want 1 and 1", calls, shared)
+	}
+
+	// 失败的调用不会被缓存，下一次请求重新调用
+	if shared, err := g.do(context.Background(), "k", func(context.Context) error { return nil }); shared || err != nil {
+		t.Errorf("retry: shared %t, err %v", shared, err)
+	}
+}
+
+// 一个等待者放弃时调用继续进行；所有等待者都放弃时调用被取消
+func TestGroupCancel(t *testing.T) {
+	g := newGroup()
+	defer g.close()
+
+	start, cancelled := make(chan struct{}), make(chan struct{})
+	f := func(ctx context.Context) error {
+		close(start)
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	}
+	ctx1, cancel1 := context.WithCancel(context.Background())
+	ctx2, cancel2 := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() { _, err := g.do(ctx1, "k", f); errs <- err }()
+	<-start
+	go func() { _, err := g.do(ctx2, "k", f); errs <- err }()
+	time.Sleep(10 * time.Millisecond) // 等第二个请求到达 monitor goroutine
+
+	cancel1()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("first waiter: err = %v, want context.Canceled", err)
+	}
+	select {
+	case <-cancelled:
+		t.Fatal("call cancelled while a waiter remains")
+	case <-time.After(20 * time.Millisecond):
+	}
+	cancel2()
+	<-errs
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("call not cancelled after all waiters gave up")
+	}
+}
+
+// close 之后的请求返回错误，而不是 panic
+func TestGroupClosed(t *testing.T) {
+	g := newGroup()
+	g.close()
+	if _, err := g.do(context.Background(), "k", func(context.Context) error { return nil }); err != errGroupClosed {
+		t.Errorf("do after close: %v, want %v", err, errGroupClosed)
+	}
+}
@@ -0,0 +1,121 @@
+package thumbnail
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// 相机总是按传感器的方向保存像素，拍摄时的方向记录在 EXIF 的 Orientation 标签（0x0112）中：
+//
+//	1 正常        2 水平翻转      3 旋转 180°        4 垂直翻转
+//	5 沿主对角线翻转  6 顺时针旋转 90°  7 沿副对角线翻转  8 逆时针旋转 90°
+//
+// image/jpeg 不读取 EXIF，所以我们自己找出这个标签，并在缩放之后把缩略图转正
+
+// exifOrientation 返回 JPEG 数据中的 EXIF Orientation，没有或无法解析时返回 1
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1 // 不是 JPEG
+	}
+	for p := 2; p+4 <= len(data); {
+		if data[p] != 0xFF {
+			return 1
+		}
+		marker := data[p+1]
+		if marker == 0xFF { // 填充
+			p++
+			continue
+		}
+		if marker == 0xD8 || marker >= 0xD0 && marker <= 0xD7 || marker == 0x01 { // 没有长度的标记
+			p += 2
+			continue
+		}
+		if marker == 0xDA || marker == 0xD9 { // 图像数据开始了，EXIF 只会在它之前
+			return 1
+		}
+		n := int(binary.BigEndian.Uint16(data[p+2:]))
+		if n < 2 || p+2+n > len(data) {
+			return 1
+		}
+		seg := data[p+4 : p+2+n]
+		if marker == 0xE1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")) {
+			return tiffOrientation(seg[6:])
+		}
+		p += 2 + n
+	}
+	return 1
+}
+
+// tiffOrientation 在 TIFF 结构的第一个 IFD 中查找 Orientation
+func tiffOrientation(t []byte) int {
+	if len(t) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(t[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	ifd := int(order.Uint32(t[4:]))
+	if ifd < 8 || ifd+2 > len(t) {
+		return 1
+	}
+	count := int(order.Uint16(t[ifd:]))
+	for i := 0; i < count; i++ {
+		e := ifd + 2 + 12*i // 每项 12 字节：标签、类型、个数、值
+		if e+12 > len(t) {
+			return 1
+		}
+		if order.Uint16(t[e:]) == 0x0112 && order.Uint16(t[e+2:]) == 3 { // 类型 3 是 SHORT
+			if o := int(order.Uint16(t[e+8:])); o >= 1 && o <= 8 {
+				return o
+			}
+			return 1
+		}
+	}
+	return 1
+}
+
+// transposed 报告方向 o 是否交换宽和高
+func transposed(o int) bool { return o >= 5 }
+
+// orient 按 EXIF 方向 o 把 src 转正
+func orient(src *image.RGBA, o int) *image.RGBA {
+	if o <= 1 || o > 8 {
+		return src
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if transposed(o) {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch o {
+			case 2:
+				dx, dy = w-1-x, y
+			case 3:
+				dx, dy = w-1-x, h-1-y
+			case 4:
+				dx, dy = x, h-1-y
+			case 5:
+				dx, dy = y, x
+			case 6:
+				dx, dy = h-1-y, x
+			case 7:
+				dx, dy = h-1-y, w-1-x
+			case 8:
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dst.PixOffset(dx, dy):][:4], src.Pix[src.PixOffset(x, y):])
+		}
+	}
+	return dst
+}
@@ -0,0 +1,272 @@
+package thumbnail
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+	"math"
+)
+
+// Fit 决定缩略图如何放入 Width×Height 的框中
+type Fit int
+
+const (
+	Contain Fit = iota // 保留长宽比，整张图放入框中，缩略图可能比框小
+	Cover              // 保留长宽比，填满整个框，居中裁掉多余的部分
+	Stretch            // 不保留长宽比，拉伸到框的大小
+)
+
+func (f Fit) String() string {
+	switch f {
+	case Contain:
+		return "contain"
+	case Cover:
+		return "cover"
+	case Stretch:
+		return "stretch"
+	}
+	return fmt.Sprintf("Fit(%d)", int(f))
+}
+
+// Filter 是缩放时使用的重采样滤波器
+// 除 Nearest 外，缩小时滤波器的宽度会随缩小的比例放大，所以每个目标像素是一块源像素的加权平均，不会产生锯齿
+type Filter int
+
+const (
+	Lanczos  Filter = iota // Lanczos-3，最清晰，也最慢
+	Bicubic                // Catmull-Rom 三次卷积
+	Bilinear               // 三角形（tent）滤波器
+	Nearest                // 最近邻，与原来的 Image 相同，最快但有锯齿
+)
+
+func (f Filter) String() string {
+	switch f {
+	case Lanczos:
+		return "lanczos"
+	case Bicubic:
+		return "bicubic"
+	case Bilinear:
+		return "bilinear"
+	case Nearest:
+		return "nearest"
+	}
+	return fmt.Sprintf("Filter(%d)", int(f))
+}
+
+// ParseFit 和 ParseFilter 解析 String 返回的名字，用于命令行标志和 URL 参数
+
+// ParseFit 解析 "contain"、"cover" 或 "stretch"
+func ParseFit(s string) (Fit, error) {
+	for f := Contain; f <= Stretch; f++ {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("thumbnail: unknown fit %q", s)
+}
+
+// ParseFilter 解析 "lanczos"、"bicubic"、"bilinear" 或 "nearest"
+func ParseFilter(s string) (Filter, error) {
+	for f := Lanczos; f <= Nearest; f++ {
+		if f.String() == s {
+			return f, nil
+		}
+	}
+	return 0, fmt.Errorf("thumbnail: unknown filter %q", s)
+}
+
+// Options 配置缩略图，零值表示 128×128 的框、Contain、Lanczos 和默认的 JPEG 质量
+type Options struct {
+	Width, Height int // 只有一个为 0 时按长宽比计算（Contain 和 Cover 相同），都为 0 时为 128
+	Fit           Fit
+	Filter        Filter
+	Quality       int // JPEG 的质量，1 到 100，0 表示 jpeg.DefaultQuality
+}
+
+// size 返回缩略图的大小，以及需要从 src 中截取的部分；src 为空时无法计算长宽比，返回 ErrEmpty
+func (o Options) size(src image.Rectangle) (w, h int, crop image.Rectangle, err error) {
+	if src.Empty() {
+		return 0, 0, src, ErrEmpty
+	}
+	sw, sh := src.Dx(), src.Dy()
+	w, h = o.Width, o.Height
+	switch {
+	case w <= 0 && h <= 0:
+		w, h = 128, 128
+	case w <= 0:
+		w = dim(float64(h) * float64(sw) / float64(sh))
+	case h <= 0:
+		h = dim(float64(w) * float64(sh) / float64(sw))
+	}
+	crop = src
+	switch o.Fit {
+	case Contain:
+		if sw*h > sh*w { // 横向：宽度填满
+			h = dim(float64(w) * float64(sh) / float64(sw))
+		} else {
+			w = dim(float64(h) * float64(sw) / float64(sh))
+		}
+	case Cover:
+		// 从 src 中间截取长宽比与框相同的最大区域
+		if sw*h > sh*w {
+			cw := round(float64(sh) * float64(w) / float64(h))
+			x := src.Min.X + (sw-cw)/2
+			crop = image.Rect(x, src.Min.Y, x+cw, src.Max.Y)
+		} else {
+			ch := round(float64(sw) * float64(h) / float64(w))
+			y := src.Min.Y + (sh-ch)/2
+			crop = image.Rect(src.Min.X, y, src.Max.X, y+ch)
+		}
+	}
+	return w, h, crop, nil
+}
+
+func round(x float64) int { return int(math.Floor(x + 0.5)) }
+
+// dim 把 x 舍入为至少为 1 的像素数
+func dim(x float64) int {
+	if n := round(x); n > 1 {
+		return n
+	}
+	return 1
+}
+
+// resize 使用滤波器 f 把 src 中的区域 b 缩放到 w×h
+// 计算在预乘了 alpha 的颜色上进行，所以透明像素的颜色不会渗入相邻的不透明像素
+func resize(src image.Image, b image.Rectangle, w, h int, f Filter) *image.RGBA {
+	var rgba *image.RGBA
+	if m, ok := src.(*image.RGBA); ok {
+		rgba = m.SubImage(b).(*image.RGBA)
+	} else {
+		rgba = image.NewRGBA(b)
+		draw.Draw(rgba, b, src, b.Min, draw.Src)
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	if f == Nearest {
+		nearest(dst, rgba)
+		return dst
+	}
+	k := kernels[f]
+	// 先横向缩放到 w×sh 的临时缓冲区，再纵向缩放到 w×h
+	sw, sh := b.Dx(), b.Dy()
+	xw := weights(sw, w, k)
+	yw := weights(sh, h, k)
+	tmp := make([]float32, w*sh*4)
+	for y := 0; y < sh; y++ {
+		row := rgba.Pix[rgba.PixOffset(b.Min.X, b.Min.Y+y):]
+		for x, ws := range xw {
+			var r, g, bl, a float32
+			for _, t := range ws {
+				p := row[t.i*4 : t.i*4+4]
+				r += t.w * float32(p[0])
+				g += t.w * float32(p[1])
+				bl += t.w * float32(p[2])
+				a += t.w * float32(p[3])
+			}
+			o := (y*w + x) * 4
+			tmp[o], tmp[o+1], tmp[o+2], tmp[o+3] = r, g, bl, a
+		}
+	}
+	for y, ws := range yw {
+		for x := 0; x < w; x++ {
+			var r, g, bl, a float32
+			for _, t := range ws {
+				o := (t.i*w + x) * 4
+				r += t.w * tmp[o]
+				g += t.w * tmp[o+1]
+				bl += t.w * tmp[o+2]
+				a += t.w * tmp[o+3]
+			}
+			// Lanczos 和 Bicubic 有负的权重，结果可能越界；预乘的颜色不能大于 alpha
+			alpha := clamp(a, 255)
+			p := dst.Pix[dst.PixOffset(x, y):]
+			p[0], p[1], p[2], p[3] = clamp(r, alpha), clamp(g, alpha), clamp(bl, alpha), alpha
+		}
+	}
+	return dst
+}
+
+func clamp(v float32, hi uint8) uint8 {
+	if v <= 0 {
+		return 0
+	}
+	if v >= float32(hi) {
+		return hi
+	}
+	return uint8(v + 0.5)
+}
+
+func nearest(dst, src *image.RGBA) {
+	b, d := src.Bounds(), dst.Bounds()
+	xscale := float64(b.Dx()) / float64(d.Dx())
+	yscale := float64(b.Dy()) / float64(d.Dy())
+	for y := 0; y < d.Dy(); y++ {
+		sy := b.Min.Y + int((float64(y)+0.5)*yscale)
+		for x := 0; x < d.Dx(); x++ {
+			sx := b.Min.X + int((float64(x)+0.5)*xscale)
+			copy(dst.Pix[dst.PixOffset(x, y):][:4], src.Pix[src.PixOffset(sx, sy):])
+		}
+	}
+}
+
+// kernel 是一个对称的滤波器，support 是它的半径
+type kernel struct {
+	support float64
+	at      func(x float64) float64
+}
+
+var kernels = map[Filter]kernel{
+	Bilinear: {1, func(x float64) float64 { return 1 - x }},
+	Bicubic: {2, func(x float64) float64 {
+		// Catmull-Rom，即 B=0、C=0.5 的 Mitchell-Netravali 三次卷积
+		if x < 1 {
+			return (1.5*x-2.5)*x*x + 1
+		}
+		return ((-0.5*x+2.5)*x-4)*x + 2
+	}},
+	Lanczos: {3, func(x float64) float64 {
+		if x == 0 {
+			return 1
+		}
+		return 3 * math.Sin(math.Pi*x) * math.Sin(math.Pi*x/3) / (math.Pi * math.Pi * x * x)
+	}},
+}
+
+type tap struct {
+	i int     // 源像素的下标
+	w float32 // 权重
+}
+
+// weights 计算把长度 n 缩放到 m 时每个目标像素的源像素和权重
+func weights(n, m int, k kernel) [][]tap {
+	scale := float64(n) / float64(m)
+	fscale := math.Max(scale, 1) // 缩小时放宽滤波器
+	support := k.support * fscale
+	ws := make([][]tap, m)
+	for x := range ws {
+		center := (float64(x)+0.5)*scale - 0.5
+		var taps []tap
+		var sum float64
+		for i := int(math.Ceil(center - support)); i <= int(math.Floor(center+support)); i++ {
+			d := math.Abs(float64(i)-center) / fscale
+			if d >= k.support {
+				continue
+			}
+			w := k.at(d)
+			sum += w
+			// 边缘以外的像素用最近的边缘像素代替
+			j := i
+			if j < 0 {
+				j = 0
+			} else if j >= n {
+				j = n - 1
+			}
+			taps = append(taps, tap{j, float32(w)})
+		}
+		for j := range taps {
+			taps[j].w /= float32(sum)
+		}
+		ws[x] = taps
+	}
+	return ws
+}
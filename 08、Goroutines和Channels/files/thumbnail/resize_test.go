@@ -0,0 +1,222 @@
+package thumbnail_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+
+	"gostudy/08、Goroutines和Channels/files/thumbnail"
+)
+
+// quadrants 返回一个 w×h 的图像，左上、右上、左下、右下分别为红、绿、蓝、白
+func quadrants(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	colors := [2][2]color.RGBA{
+		{{255, 0, 0, 255}, {0, 255, 0, 255}},
+		{{0, 0, 255, 255}, {255, 255, 255, 255}},
+	}
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			img.Set(x, y, colors[2*y/h][2*x/w])
+		}
+	}
+	return img
+}
+
+func TestFit(t *testing.T) {
+	src := quadrants(400, 200)
+	for _, test := range []struct {
+		opts thumbnail.Options
+		w, h int
+	}{
+		{thumbnail.Options{}, 128, 64},
+		{thumbnail.Options{Width: 100, Height: 100}, 100, 50},
+		{thumbnail.Options{Width: 100, Height: 100, Fit: thumbnail.Cover}, 100, 100},
+		{thumbnail.Options{Width: 100, Height: 100, Fit: thumbnail.Stretch}, 100, 100},
+		{thumbnail.Options{Width: 100}, 100, 50},
+		{thumbnail.Options{Height: 50}, 100, 50},
+		{thumbnail.Options{Width: 1000, Height: 1}, 2, 1},
+	} {
+		size := test.opts.Image(src).Bounds().Size()
+		if size.X != test.w || size.Y != test.h {
+			t.Errorf("%+v: size %v, want %dx%d", test.opts, size, test.w, test.h)
+		}
+	}
+
+	// Cover 裁掉左右两边，剩下的中间部分四个象限各占四分之一
+	dst := thumbnail.Options{Width: 10, Height: 10, Fit: thumbnail.Cover}.Image(src)
+	if c := color.RGBAModel.Convert(dst.At(2, 2)).(color.RGBA); !near(c, color.RGBA{255, 0, 0, 255}) {
+		t.Errorf("Cover: top-left pixel is %v, want red", c)
+	}
+}
+
+// 把 1 像素的黑白棋盘格缩小 8 倍，每个像素都应该接近灰色；最近邻只会取到黑或白
+func TestAliasing(t *testing.T) {
+	src := image.NewGray(image.Rect(0, 0, 256, 256))
+	for y := 0; y < 256; y++ {
+		for x := 0; x < 256; x++ {
+			if (x+y)%2 == 0 {
+				src.SetGray(x, y, color.Gray{255})
+			}
+		}
+	}
+	for _, f := range []thumbnail.Filter{thumbnail.Lanczos, thumbnail.Bicubic, thumbnail.Bilinear, thumbnail.Nearest} {
+		dst := thumbnail.Options{Width: 32, Height: 32, Filter: f}.Image(src)
+		var worst int
+		for y := 0; y < 32; y++ {
+			for x := 0; x < 32; x++ {
+				g := int(color.GrayModel.Convert(dst.At(x, y)).(color.Gray).Y)
+				if d := abs(g - 128); d > worst {
+					worst = d
+				}
+			}
+		}
+		if aliased := worst > 8; aliased != (f == thumbnail.Nearest) {
+			t.Errorf("%v: worst deviation from gray is %d", f, worst)
+		}
+	}
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+func stream(t *testing.T, opts thumbnail.Options, in []byte) (image.Image, string) {
+	t.Helper()
+	var out bytes.Buffer
+	format, err := opts.Stream(&out, bytes.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, decoded, err := image.Decode(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != format {
+		t.Errorf("Stream returned format %s but wrote %s", format, decoded)
+	}
+	return img, format
+}
+
+// PNG 保留透明度，透明像素的颜色不会渗入不透明的部分
+func TestPNGTransparency(t *testing.T) {
+	src := image.NewNRGBA(image.Rect(0, 0, 100, 100))
+	for y := 0; y < 100; y++ {
+		for x := 50; x < 100; x++ {
+			src.Set(x, y, color.NRGBA{255, 0, 0, 255})
+		}
+	}
+	var in bytes.Buffer
+	png.Encode(&in, src)
+	dst, format := stream(t, thumbnail.Options{Width: 30, Height: 30}, in.Bytes())
+	if format != "png" {
+		t.Fatalf("format = %s, want png", format)
+	}
+	for x := 0; x < 30; x++ {
+		c := color.NRGBAModel.Convert(dst.At(x, 15)).(color.NRGBA)
+		switch {
+		case x < 12 && c.A != 0: // Lanczos 的支撑范围是 3 个目标像素
+			t.Errorf("pixel %d: %v, want transparent", x, c)
+		case x > 18 && c.A != 255:
+			t.Errorf("pixel %d: %v, want opaque", x, c)
+		case c.A > 0 && (c.R < 250 || c.G > 5):
+			t.Errorf("pixel %d: %v, want red", x, c) // 边缘上不应出现深色
+		}
+	}
+}
+
+func TestGIF(t *testing.T) {
+	pal := color.Palette{color.Transparent, color.RGBA{0, 0, 255, 255}}
+	src := image.NewPaletted(image.Rect(0, 0, 64, 64), pal)
+	for y := 0; y < 64; y++ {
+		for x := 32; x < 64; x++ {
+			src.SetColorIndex(x, y, 1)
+		}
+	}
+	var in bytes.Buffer
+	gif.Encode(&in, src, nil)
+	dst, format := stream(t, thumbnail.Options{Width: 16}, in.Bytes())
+	if format != "gif" {
+		t.Fatalf("format = %s, want gif", format)
+	}
+	if _, _, _, a := dst.At(2, 8).RGBA(); a != 0 {
+		t.Errorf("left pixel %v, want transparent", dst.At(2, 8))
+	}
+	if c := color.RGBAModel.Convert(dst.At(13, 8)); c != (color.RGBA{0, 0, 255, 255}) {
+		t.Errorf("right pixel %v, want blue", c)
+	}
+}
+
+// withOrientation 在 JPEG 的 SOI 标记之后插入一个只有 Orientation 标签的 EXIF 段
+func withOrientation(jpg []byte, o int) []byte {
+	var tiff bytes.Buffer
+	le := binary.LittleEndian
+	tiff.WriteString("II")
+	binary.Write(&tiff, le, uint16(42))
+	binary.Write(&tiff, le, uint32(8)) // IFD0 的偏移
+	binary.Write(&tiff, le, uint16(1)) // 一项
+	binary.Write(&tiff, le, [4]uint16{0x0112, 3, 1, 0})
+	binary.Write(&tiff, le, [2]uint16{uint16(o), 0})
+	binary.Write(&tiff, le, uint32(0)) // 没有下一个 IFD
+
+	seg := append([]byte("Exif\x00\x00"), tiff.Bytes()...)
+	var out bytes.Buffer
+	out.Write(jpg[:2])
+	out.Write([]byte{0xFF, 0xE1})
+	binary.Write(&out, binary.BigEndian, uint16(len(seg)+2))
+	out.Write(seg)
+	out.Write(jpg[2:])
+	return out.Bytes()
+}
+
+func TestEXIFOrientation(t *testing.T) {
+	var jpg bytes.Buffer
+	jpeg.Encode(&jpg, quadrants(80, 40), &jpeg.Options{Quality: 100})
+	red, green := color.RGBA{255, 0, 0, 255}, color.RGBA{0, 255, 0, 255}
+	blue, white := color.RGBA{0, 0, 255, 255}, color.RGBA{255, 255, 255, 255}
+	for _, test := range []struct {
+		orientation int
+		w, h        int
+		topLeft     color.RGBA // 转正后左上角的颜色
+	}{
+		{1, 64, 32, red},
+		{2, 64, 32, green},
+		{3, 64, 32, white},
+		{4, 64, 32, blue},
+		{5, 32, 64, red},
+		{6, 32, 64, blue},
+		{7, 32, 64, white},
+		{8, 32, 64, green},
+	} {
+		dst, _ := stream(t, thumbnail.Options{Width: 64, Height: 64}, withOrientation(jpg.Bytes(), test.orientation))
+		if size := dst.Bounds().Size(); size.X != test.w || size.Y != test.h {
+			t.Errorf("orientation %d: size %v, want %dx%d", test.orientation, size, test.w, test.h)
+			continue
+		}
+		if c := color.RGBAModel.Convert(dst.At(4, 4)).(color.RGBA); !near(c, test.topLeft) {
+			t.Errorf("orientation %d: top-left %v, want %v", test.orientation, c, test.topLeft)
+		}
+	}
+}
+
+func near(a, b color.RGBA) bool {
+	return abs(int(a.R)-int(b.R)) < 32 && abs(int(a.G)-int(b.G)) < 32 && abs(int(a.B)-int(b.B)) < 32
+}
+
+// 宽或高为 0 的原图没有长宽比：Image 返回空的图像，而不是除以 0 之后 panic
+func TestEmpty(t *testing.T) {
+	for _, opts := range []thumbnail.Options{{Width: 10}, {Height: 10}, {Width: 10, Height: 10, Fit: thumbnail.Cover}} {
+		src := image.NewRGBA(image.Rect(0, 0, 0, 10))
+		if dst := opts.Image(src); !dst.Bounds().Empty() {
+			t.Errorf("%+v: Image(empty) has bounds %v", opts, dst.Bounds())
+		}
+	}
+}
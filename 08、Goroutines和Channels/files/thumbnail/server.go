@@ -0,0 +1,283 @@
+package thumbnail
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// ServerOptions 配置 Server
+type ServerOptions struct {
+	Root     string // 原图所在的目录，请求只能访问其中的文件
+	CacheDir string // 缩略图的缓存目录
+	// MaxDecodes 是同时解码的图像数，0 表示 runtime.NumCPU()
+	// 解码一张大图需要几十 MB 内存，限制它就限制了服务器的内存占用
+	MaxDecodes int
+	MaxSize    int   // w 和 h 的最大值，0 表示 2048
+	MaxPixels  int64 // 原图的最大像素数，0 表示 50M，超过时返回 413
+}
+
+// ServerStats 是 Server 的计数器
+type ServerStats struct {
+	Requests  int64 // 有效的请求数
+	CacheHits int64 // 缩略图已经在缓存中
+	Generated int64 // 生成的缩略图数
+	Coalesced int64 // 与正在生成同一个缩略图的请求合并的请求数
+}
+
+// Server 通过 HTTP 提供缩略图：
+//
+//	GET /thumb?src=photos/cat.jpg&w=200&h=200&fit=cover&filter=lanczos&q=85
+//
+// 缩略图按原图的路径、大小、修改时间和参数缓存在磁盘上，原图修改之后会重新生成
+// 同一个缩略图的并发请求只生成一次；响应带有 ETag，客户端用 If-None-Match 再次请求时返回 304
+type Server struct {
+	opts  ServerOptions
+	root  string        // 解析了符号链接的 Root
+	sema  chan struct{} // 限制同时解码的图像数
+	group *group
+	stats ServerStats // 用 atomic 访问
+}
+
+var (
+	errForbidden = errors.New("path outside root")
+	errTooLarge  = errors.New("image too large")
+)
+
+// NewServer 返回一个 Server，客户端必须随后调用 Close
+func NewServer(opts ServerOptions) (*Server, error) {
+	if opts.MaxDecodes <= 0 {
+		opts.MaxDecodes = runtime.NumCPU()
+	}
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 2048
+	}
+	if opts.MaxPixels <= 0 {
+		opts.MaxPixels = 50 << 20
+	}
+	root, err := filepath.EvalSymlinks(opts.Root)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(opts.CacheDir, 0755); err != nil {
+		return nil, err
+	}
+	return &Server{
+		opts:  opts,
+		root:  root,
+		sema:  make(chan struct{}, opts.MaxDecodes),
+		group: newGroup(),
+	}, nil
+}
+
+// Close 停止 Server 的 monitor goroutine，之后需要生成缩略图的请求返回 503
+func (s *Server) Close() { s.group.close() }
+
+// Stats 返回计数器的当前值
+func (s *Server) Stats() ServerStats {
+	return ServerStats{
+		Requests:  atomic.LoadInt64(&s.stats.Requests),
+		CacheHits: atomic.LoadInt64(&s.stats.CacheHits),
+		Generated: atomic.LoadInt64(&s.stats.Generated),
+		Coalesced: atomic.LoadInt64(&s.stats.Coalesced),
+	}
+}
+
+// ServeHTTP 处理 /thumb 请求，其他路径返回 404
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/thumb" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	opts, err := s.parseOptions(q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	file, err := s.resolve(q.Get("src"))
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	info, err := os.Stat(file)
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	atomic.AddInt64(&s.stats.Requests, 1)
+
+	// 原图或参数改变时 key 也会改变，所以缓存永远不需要失效
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%d\x00%d\x00%+v", file, info.Size(), info.ModTime().UnixNano(), opts)
+	key := hex.EncodeToString(h.Sum(nil))
+	etag := `"` + key[:32] + `"`
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	if match := r.Header.Get("If-None-Match"); match != "" && etagMatch(match, etag) {
+		w.WriteHeader(http.StatusNotModified) // 不需要读取缓存，更不需要生成
+		return
+	}
+
+	cached := filepath.Join(s.opts.CacheDir, key[:2], key)
+	f, err := os.Open(cached)
+	if err == nil {
+		atomic.AddInt64(&s.stats.CacheHits, 1)
+	} else {
+		shared, err := s.group.do(r.Context(), key, func(ctx context.Context) error {
+			// 检查缓存之后、进入 group 之前，另一个请求可能刚好生成完并删除了 entry，
+			// 所以在 group 中再检查一次，否则会重复生成
+			if _, err := os.Stat(cached); err == nil {
+				atomic.AddInt64(&s.stats.CacheHits, 1)
+				return nil
+			}
+			return s.generate(ctx, cached, file, opts)
+		})
+		if shared {
+			atomic.AddInt64(&s.stats.Coalesced, 1)
+		}
+		if err != nil {
+			s.error(w, err)
+			return
+		}
+		if f, err = os.Open(cached); err != nil {
+			s.error(w, err)
+			return
+		}
+	}
+	defer f.Close()
+	// ServeContent 根据内容设置 Content-Type，并处理 Range 和 If-None-Match
+	http.ServeContent(w, r, "", info.ModTime(), f)
+}
+
+func (s *Server) parseOptions(q map[string][]string) (Options, error) {
+	var opts Options
+	get := func(name string) string {
+		if v := q[name]; len(v) > 0 {
+			return v[0]
+		}
+		return ""
+	}
+	var err error
+	for _, p := range []struct {
+		name string
+		v    *int
+		max  int
+	}{
+		{"w", &opts.Width, s.opts.MaxSize},
+		{"h", &opts.Height, s.opts.MaxSize},
+		{"q", &opts.Quality, 100},
+	} {
+		if v := get(p.name); v != "" {
+			if *p.v, err = strconv.Atoi(v); err != nil || *p.v < 0 || *p.v > p.max {
+				return opts, fmt.Errorf("bad %s=%q: want an integer between 0 and %d", p.name, v, p.max)
+			}
+		}
+	}
+	if v := get("fit"); v != "" {
+		if opts.Fit, err = ParseFit(v); err != nil {
+			return opts, err
+		}
+	}
+	if v := get("filter"); v != "" {
+		if opts.Filter, err = ParseFilter(v); err != nil {
+			return opts, err
+		}
+	}
+	return opts, nil
+}
+
+// resolve 返回 src 在 Root 中的路径
+// src 必须是相对路径并且不能包含 “..”；解析符号链接之后也必须仍在 Root 之中
+func (s *Server) resolve(src string) (string, error) {
+	src = strings.TrimPrefix(src, "/")
+	if src == "" || !fs.ValidPath(src) || strings.Contains(src, `\`) {
+		return "", errForbidden
+	}
+	file, err := filepath.EvalSymlinks(filepath.Join(s.root, filepath.FromSlash(src)))
+	if err != nil {
+		return "", err
+	}
+	if rel, err := filepath.Rel(s.root, file); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", errForbidden
+	}
+	return file, nil
+}
+
+// generate 在解码信号量的限制下生成缩略图并写入缓存
+func (s *Server) generate(ctx context.Context, cached, file string, opts Options) error {
+	select {
+	case s.sema <- struct{}{}: // 获取 token
+	case <-ctx.Done():
+		return ctx.Err() // 所有请求都放弃了
+	}
+	defer func() { <-s.sema }() // 释放 token
+
+	// 先只读取图像的头部，太大的图像不解码
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	cfg, _, err := image.DecodeConfig(f)
+	f.Close()
+	if err != nil {
+		return &FileError{file, err}
+	}
+	if int64(cfg.Width)*int64(cfg.Height) > s.opts.MaxPixels {
+		return errTooLarge
+	}
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		return err
+	}
+	if err := opts.File(cached, file); err != nil {
+		return err
+	}
+	atomic.AddInt64(&s.stats.Generated, 1)
+	return nil
+}
+
+func (s *Server) error(w http.ResponseWriter, err error) {
+	var fe *FileError
+	switch {
+	case err == errForbidden:
+		http.Error(w, err.Error(), http.StatusForbidden)
+	case os.IsNotExist(err):
+		http.Error(w, "not found", http.StatusNotFound)
+	case err == errGroupClosed:
+		http.Error(w, "server closed", http.StatusServiceUnavailable)
+	case err == errTooLarge:
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+	case errors.As(err, &fe):
+		http.Error(w, "unsupported image: "+fe.Err.Error(), http.StatusUnsupportedMediaType)
+	case err == context.Canceled || err == context.DeadlineExceeded:
+		// 客户端已经断开，不需要响应
+	default:
+		http.Error(w, "internal error", http.StatusInternalServerError)
+	}
+}
+
+// etagMatch 报告 If-None-Match 头是否包含 etag
+func etagMatch(header, etag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == etag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,248 @@
+package thumbnail_test
+
+import (
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gostudy/08、Goroutines和Channels/files/thumbnail"
+)
+
+// makeRoot 返回一个临时目录，其中有生成的 cat.png（300×200）、dog.jpg（200×400）和无法解码的 bad.png
+func makeRoot(t *testing.T) string {
+	t.Helper()
+	root := t.TempDir()
+	png.Encode(mustCreate(t, filepath.Join(root, "cat.png")), quadrants(300, 200))
+	jpeg.Encode(mustCreate(t, filepath.Join(root, "dog.jpg")), quadrants(200, 400), nil)
+	ioutil.WriteFile(filepath.Join(root, "bad.png"), []byte("not an image"), 0644)
+	return root
+}
+
+func mustCreate(t *testing.T, name string) *os.File {
+	t.Helper()
+	f, err := os.Create(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+// newServer 启动一个 Server，Root 和 CacheDir 为空时使用新的临时目录
+func newServer(t *testing.T, opts thumbnail.ServerOptions) (*thumbnail.Server, *httptest.Server) {
+	t.Helper()
+	if opts.Root == "" {
+		opts.Root = makeRoot(t)
+	}
+	if opts.CacheDir == "" {
+		opts.CacheDir = t.TempDir()
+	}
+	s, err := thumbnail.NewServer(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(s)
+	t.Cleanup(func() {
+		ts.Close()
+		s.Close()
+	})
+	return s, ts
+}
+
+func get(t *testing.T, url string, header ...string) *http.Response {
+	t.Helper()
+	req, _ := http.NewRequest("GET", url, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		req.Header.Set(header[i], header[i+1])
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestServer(t *testing.T) {
+	s, ts := newServer(t, thumbnail.ServerOptions{})
+	for _, test := range []struct {
+		query       string
+		contentType string
+		w, h        int
+	}{
+		{"src=cat.png&w=60&h=60", "image/png", 60, 40},
+		{"src=cat.png&w=50&h=50&fit=cover&filter=bilinear", "image/png", 50, 50},
+		{"src=/dog.jpg&h=100&q=90", "image/jpeg", 50, 100},
+	} {
+		resp := get(t, ts.URL+"/thumb?"+test.query)
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("%s: status %s", test.query, resp.Status)
+		}
+		if ct := resp.Header.Get("Content-Type"); ct != test.contentType {
+			t.Errorf("%s: Content-Type %q, want %q", test.query, ct, test.contentType)
+		}
+		img, _, err := image.Decode(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", test.query, err)
+		}
+		if size := img.Bounds().Size(); size.X != test.w || size.Y != test.h {
+			t.Errorf("%s: size %v, want %dx%d", test.query, size, test.w, test.h)
+		}
+	}
+	if st := s.Stats(); st.Generated != 3 || st.CacheHits != 0 {
+		t.Errorf("stats = %+v, want 3 generated", st)
+	}
+}
+
+func TestServerErrors(t *testing.T) {
+	// Root 中的 link 是指向 Root 之外的符号链接
+	outside := makeRoot(t)
+	root := makeRoot(t)
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	_, ts := newServer(t, thumbnail.ServerOptions{Root: root, MaxSize: 500})
+
+	for _, test := range []struct {
+		url    string
+		status int
+	}{
+		{ts.URL + "/thumb?src=../cat.png", http.StatusForbidden},
+		{ts.URL + "/thumb?src=a/../../cat.png", http.StatusForbidden},
+		{ts.URL + "/thumb?src=..%5Ccat.png", http.StatusForbidden},
+		{ts.URL + "/thumb?src=", http.StatusForbidden},
+		{ts.URL + "/thumb?src=link/cat.png", http.StatusForbidden},
+		{ts.URL + "/thumb?src=missing.png", http.StatusNotFound},
+		{ts.URL + "/thumb?src=.", http.StatusNotFound},
+		{ts.URL + "/other?src=cat.png", http.StatusNotFound},
+		{ts.URL + "/thumb?src=cat.png&w=abc", http.StatusBadRequest},
+		{ts.URL + "/thumb?src=cat.png&w=501", http.StatusBadRequest},
+		{ts.URL + "/thumb?src=cat.png&q=-1", http.StatusBadRequest},
+		{ts.URL + "/thumb?src=cat.png&fit=squash", http.StatusBadRequest},
+		{ts.URL + "/thumb?src=bad.png", http.StatusUnsupportedMediaType},
+	} {
+		resp := get(t, test.url)
+		resp.Body.Close()
+		if resp.StatusCode != test.status {
+			t.Errorf("GET %s: status %d, want %d", test.url, resp.StatusCode, test.status)
+		}
+	}
+
+	resp, err := http.Post(ts.URL+"/thumb?src=cat.png", "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST: status %d, want 405", resp.StatusCode)
+	}
+
+	// 像素数超过限制的图像不解码
+	s, small := newServer(t, thumbnail.ServerOptions{MaxPixels: 300*200 - 1})
+	resp = get(t, small.URL+"/thumb?src=cat.png")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusRequestEntityTooLarge {
+		t.Errorf("large image: status %d, want 413", resp.StatusCode)
+	}
+	if st := s.Stats(); st.Generated != 0 {
+		t.Errorf("large image: %d generated", st.Generated)
+	}
+}
+
+func TestServerCache(t *testing.T) {
+	opts := thumbnail.ServerOptions{Root: makeRoot(t), CacheDir: t.TempDir()}
+	s, ts := newServer(t, opts)
+	url := ts.URL + "/thumb?src=cat.png&w=30"
+	resp := get(t, url)
+	resp.Body.Close()
+	etag := resp.Header.Get("ETag")
+	if resp.StatusCode != http.StatusOK || etag == "" {
+		t.Fatalf("status %s, ETag %q", resp.Status, etag)
+	}
+
+	// If-None-Match 匹配时返回 304，不读缓存也不生成
+	resp = get(t, url, "If-None-Match", `"other", `+etag)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotModified {
+		t.Errorf("If-None-Match: status %d, want 304", resp.StatusCode)
+	}
+	// 参数不同时是另一个缩略图
+	resp = get(t, ts.URL+"/thumb?src=cat.png&w=31", "If-None-Match", etag)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("different size: status %d, ETag %s", resp.StatusCode, resp.Header.Get("ETag"))
+	}
+	if st := s.Stats(); st.Generated != 2 || st.CacheHits != 0 {
+		t.Errorf("stats = %+v, want 2 generated", st)
+	}
+
+	// 新的 Server 使用同一个缓存目录：不需要重新生成，ETag 不变
+	s2, ts2 := newServer(t, opts)
+	resp = get(t, ts2.URL+"/thumb?src=cat.png&w=30")
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") != etag {
+		t.Errorf("after restart: status %d, ETag %s, want %s", resp.StatusCode, resp.Header.Get("ETag"), etag)
+	}
+	if st := s2.Stats(); st.Generated != 0 || st.CacheHits != 1 {
+		t.Errorf("after restart: stats = %+v, want 1 cache hit", st)
+	}
+
+	// 原图修改之后 ETag 改变，缩略图重新生成
+	future := time.Now().Add(time.Hour)
+	os.Chtimes(filepath.Join(opts.Root, "cat.png"), future, future)
+	resp = get(t, ts2.URL+"/thumb?src=cat.png&w=30", "If-None-Match", etag)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("ETag") == etag {
+		t.Errorf("after modification: status %d, ETag unchanged", resp.StatusCode)
+	}
+	if st := s2.Stats(); st.Generated != 1 {
+		t.Errorf("after modification: stats = %+v, want 1 generated", st)
+	}
+}
+
+// 同一个缩略图的并发请求只生成一次：每个请求要么与正在进行的生成合并，要么命中缓存
+// 无论请求到达的时机如何，结果都是确定的，包括刚好在生成完成时错过缓存的请求
+func TestServerCoalesce(t *testing.T) {
+	s, ts := newServer(t, thumbnail.ServerOptions{MaxDecodes: 1})
+	const n = 20
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	etags := make([]string, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start // 所有请求同时开始
+			resp, err := http.Get(ts.URL + "/thumb?src=cat.png&w=100&h=100&fit=cover")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusOK {
+				t.Errorf("status %s", resp.Status)
+			}
+			etags[i] = resp.Header.Get("ETag")
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+	for _, etag := range etags {
+		if etag != etags[0] {
+			t.Errorf("ETags differ: %q and %q", etag, etags[0])
+		}
+	}
+	st := s.Stats()
+	if st.Generated != 1 || st.Requests != n || 1+st.Coalesced+st.CacheHits != n {
+		t.Errorf("stats = %+v, want 1 generated and the rest coalesced or cached", st)
+	}
+	t.Logf("%+v", st)
+}
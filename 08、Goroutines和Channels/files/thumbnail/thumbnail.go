@@ -1,78 +1,187 @@
 // Package thumbnail 可以从较大尺寸的图像生成缩略图像
-// 当前仅支持 JPEG
+// 支持 JPEG、PNG 和 GIF，缩略图使用与原图相同的格式
 package thumbnail
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"image"
+	"image/color"
+	"image/color/palette"
+	"image/gif"
 	"image/jpeg"
+	"image/png"
 	"io"
+	"io/ioutil"
 	"os"
+	"math/rand"
 	"path/filepath"
+	"strconv"
 	"strings"
 )
 
-// Image 返回 src 的缩略图
+// ErrEmpty 表示原图的宽或高为 0，无法生成缩略图
+var ErrEmpty = errors.New("thumbnail: empty image")
+
+// Image 返回 src 的缩略图，大小不超过 128×128，保留长宽比
 func Image(src image.Image) image.Image {
-	// 计算缩略图大小，保留长宽比
-	xs := src.Bounds().Size().X
-	ys := src.Bounds().Size().Y
-	width, height := 128, 128
-	if aspect := float64(xs) / float64(ys); aspect < 1.0 {
-		width = int(128 * aspect) // 竖向
-	} else {
-		height = int(128 / aspect) // 横向
-	}
-	xscale := float64(xs) / float64(width)
-	yscale := float64(ys) / float64(height)
-
-	dst := image.NewRGBA(image.Rect(0, 0, width, height))
-
-	// 一个非常粗糙的缩放算法
-	for x := 0; x < width; x++ {
-		for y := 0; y < height; y++ {
-			srcx := int(float64(x) * xscale)
-			srcy := int(float64(y) * yscale)
-			dst.Set(x, y, src.At(srcx, srcy))
-		}
+	return Options{}.Image(src)
+}
+
+// Image 按 o 返回 src 的缩略图，src 为空时返回空的图像
+func (o Options) Image(src image.Image) image.Image {
+	dst, err := o.thumb(src, 1)
+	if err != nil {
+		return image.NewRGBA(image.Rectangle{})
 	}
 	return dst
 }
 
-// ImageStream 从 r 读取图像，并将缩略图写入 w
+// thumb 缩放 src，然后按 EXIF 方向 orientation 转正
+// 转正会交换宽和高时，先用交换后的框缩放，转正之后就是要求的大小
+func (o Options) thumb(src image.Image, orientation int) (*image.RGBA, error) {
+	box := o
+	if transposed(orientation) {
+		box.Width, box.Height = o.Height, o.Width
+	}
+	w, h, crop, err := box.size(src.Bounds())
+	if err != nil {
+		return nil, err
+	}
+	return orient(resize(src, crop, w, h, o.Filter), orientation), nil
+}
+
+// ImageStream 从 r 读取图像，并将缩略图以相同的格式写入 w
 func ImageStream(w io.Writer, r io.Reader) error {
-	src, _, err := image.Decode(r)
+	_, err := Options{}.Stream(w, r)
+	return err
+}
+
+// Stream 从 r 读取图像，按 o 生成缩略图，并以相同的格式写入 w
+// 它返回图像的格式，例如 “jpeg”、“png”、“gif”
+func (o Options) Stream(w io.Writer, r io.Reader) (format string, err error) {
+	data, err := ioutil.ReadAll(r) // 需要两次读取：解码和查找 EXIF
 	if err != nil {
-		return err
+		return "", err
+	}
+	src, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+	orientation := 1
+	if format == "jpeg" {
+		orientation = exifOrientation(data)
+	}
+	dst, err := o.thumb(src, orientation)
+	if err != nil {
+		return format, err
+	}
+	return format, o.encode(w, dst, src, format)
+}
+
+// encode 以格式 format 写入缩略图 dst，src 是原图
+// 其他包注册的格式（例如 image/bmp）没有对应的编码器，使用无损的 PNG
+func (o Options) encode(w io.Writer, dst *image.RGBA, src image.Image, format string) error {
+	switch format {
+	case "jpeg":
+		q := o.Quality
+		if q <= 0 {
+			q = jpeg.DefaultQuality
+		}
+		return jpeg.Encode(w, dst, &jpeg.Options{Quality: q})
+	case "gif":
+		return gif.Encode(w, paletted(dst, src), nil)
 	}
-	dst := Image(src)
-	return jpeg.Encode(w, dst, nil)
+	return png.Encode(w, dst)
+}
+
+// paletted 把 dst 转换为调色板图像，尽量使用原图的调色板以保留透明色
+// 只处理 GIF 的第一帧，动画不会被保留
+func paletted(dst *image.RGBA, src image.Image) *image.Paletted {
+	pal := color.Palette(palette.Plan9)
+	if p, ok := src.(*image.Paletted); ok {
+		pal = p.Palette
+	}
+	transparent := -1
+	for i, c := range pal {
+		if _, _, _, a := c.RGBA(); a == 0 {
+			transparent = i
+			break
+		}
+	}
+	b := dst.Bounds()
+	p := image.NewPaletted(b, pal)
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			c := color.NRGBAModel.Convert(dst.At(x, y)).(color.NRGBA)
+			if c.A < 0x80 && transparent >= 0 {
+				p.SetColorIndex(x, y, uint8(transparent))
+				continue
+			}
+			c.A = 0xFF
+			p.SetColorIndex(x, y, uint8(pal.Index(c)))
+		}
+	}
+	return p
 }
 
 // ImageFile2 从 infile 读取图像，并将缩略图写入 outfile
 func ImageFile2(outfile, infile string) (err error) {
+	return Options{}.File(outfile, infile)
+}
+
+// File 从 infile 读取图像，并按 o 将缩略图写入 outfile
+// 缩略图先写入同一目录下的临时文件再重命名，所以失败或被中断时不会留下不完整的 outfile
+func (o Options) File(outfile, infile string) (err error) {
 	in, err := os.Open(infile)
 	if err != nil {
 		return err
 	}
 	defer in.Close()
 
-	out, err := os.Create(outfile)
+	out, err := createTemp(filepath.Dir(outfile), "."+filepath.Base(outfile)+".tmp")
 	if err != nil {
 		return err
 	}
+	defer func() {
+		if err != nil {
+			os.Remove(out.Name())
+		}
+	}()
 
-	if err := ImageStream(out, in); err != nil {
+	if _, err := o.Stream(out, in); err != nil {
 		out.Close()
 		return fmt.Errorf("缩放 %s 到 %s: %s", infile, outfile, err)
 	}
-	return out.Close()
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Rename(out.Name(), outfile)
+}
+
+// createTemp 在 dir 中创建一个名字以 prefix 开头的新文件
+// 与 ioutil.TempFile 不同，它的权限与 os.Create 相同（0666 去掉 umask），而不是只有所有者可读
+func createTemp(dir, prefix string) (*os.File, error) {
+	for i := 0; ; i++ {
+		name := filepath.Join(dir, prefix+strconv.FormatUint(uint64(rand.Uint32()), 10))
+		f, err := os.OpenFile(name, os.O_RDWR|os.O_CREATE|os.O_EXCL, 0666)
+		if os.IsExist(err) && i < 100 {
+			continue // 名字冲突，换一个
+		}
+		return f, err
+	}
 }
 
 // ImageFile 从 infile 读取图像，并将缩略图写入同一目录
 // 它返回生成的文件名，如 “foo.thumb.jpg”
 func ImageFile(infile string) (string, error) {
-	ext := filepath.Ext(infile) // 例如 “.jpg”、“.JPEG”
-	outfile := strings.TrimSuffix(infile, ext) + ".thumb" + ext
+	outfile := thumbName(infile)
 	return outfile, ImageFile2(outfile, infile)
 }
+
+// thumbName 返回 infile 的缩略图的文件名
+func thumbName(infile string) string {
+	ext := filepath.Ext(infile) // 例如 “.jpg”、“.JPEG”
+	return strings.TrimSuffix(infile, ext) + ".thumb" + ext
+}
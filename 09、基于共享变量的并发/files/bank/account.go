@@ -0,0 +1,228 @@
+package bank
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Account 是只有一个余额的账户，与 bank1、bank2 和 bank3 的包级函数相同，但可以同时存在多个并互相替换
+// 所有实现都是并发安全的
+type Account interface {
+	Deposit(amount int)
+	// Withdraw 取款，余额不足时返回 ErrInsufficientFunds，余额不变
+	Withdraw(amount int) error
+	Balance() int
+	// Close 释放账户使用的资源，之后不能再使用这个账户
+	Close()
+}
+
+// !+ monitor
+
+// NewMonitor 返回一个 balance 只限于 teller goroutine 的账户，与 bank1 相同
+func NewMonitor() Account {
+	a := &monitor{
+		deposits:  make(chan int),
+		withdraws: make(chan withdrawal),
+		balances:  make(chan int),
+		done:      make(chan struct{}),
+	}
+	go a.teller()
+	return a
+}
+
+type monitor struct {
+	deposits  chan int        // 汇款到存款
+	withdraws chan withdrawal // 取款
+	balances  chan int        // 收到余额
+	done      chan struct{}
+}
+
+type withdrawal struct {
+	amount int
+	ok     chan<- bool
+}
+
+func (a *monitor) Deposit(amount int) { a.deposits <- amount }
+func (a *monitor) Balance() int       { return <-a.balances }
+func (a *monitor) Close()             { close(a.done) }
+
+func (a *monitor) Withdraw(amount int) error {
+	ok := make(chan bool)
+	a.withdraws <- withdrawal{amount, ok}
+	if !<-ok {
+		return ErrInsufficientFunds
+	}
+	return nil
+}
+
+func (a *monitor) teller() {
+	var balance int // balance 只限于 teller goroutine
+	for {
+		select {
+		case amount := <-a.deposits:
+			balance += amount
+		case w := <-a.withdraws:
+			ok := balance >= w.amount
+			if ok {
+				balance -= w.amount
+			}
+			w.ok <- ok
+		case a.balances <- balance:
+		case <-a.done:
+			return
+		}
+	}
+}
+
+// !- monitor
+
+// !+ semaphore
+
+// NewSemaphore 返回一个用二元信号量保护 balance 的账户，与 bank2 相同
+func NewSemaphore() Account {
+	return &semaphore{sema: make(chan struct{}, 1)}
+}
+
+type semaphore struct {
+	sema    chan struct{} // 一个保护 balance 的二元信号量
+	balance int
+}
+
+func (a *semaphore) Deposit(amount int) {
+	a.sema <- struct{}{} // 获取 token
+	a.balance += amount
+	<-a.sema // 释放 token
+}
+
+func (a *semaphore) Withdraw(amount int) error {
+	a.sema <- struct{}{}
+	defer func() { <-a.sema }()
+	if a.balance < amount {
+		return ErrInsufficientFunds
+	}
+	a.balance -= amount
+	return nil
+}
+
+func (a *semaphore) Balance() int {
+	a.sema <- struct{}{}
+	b := a.balance
+	<-a.sema
+	return b
+}
+
+func (a *semaphore) Close() {}
+
+// !- semaphore
+
+// !+ mutex
+
+// NewMutex 返回一个用 sync.Mutex 保护 balance 的账户，与 bank3 相同
+func NewMutex() Account {
+	return new(mutex)
+}
+
+type mutex struct {
+	mu      sync.Mutex // 守护 balance
+	balance int
+}
+
+func (a *mutex) Deposit(amount int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.balance += amount
+}
+
+func (a *mutex) Withdraw(amount int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.balance < amount {
+		return ErrInsufficientFunds
+	}
+	a.balance -= amount
+	return nil
+}
+
+func (a *mutex) Balance() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.balance
+}
+
+func (a *mutex) Close() {}
+
+// !- mutex
+
+// !+ rwmutex
+
+// NewRWMutex 返回一个用 sync.RWMutex 保护 balance 的账户，查询余额可以并发进行
+func NewRWMutex() Account {
+	return new(rwmutex)
+}
+
+type rwmutex struct {
+	mu      sync.RWMutex // 守护 balance
+	balance int
+}
+
+func (a *rwmutex) Deposit(amount int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.balance += amount
+}
+
+func (a *rwmutex) Withdraw(amount int) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.balance < amount {
+		return ErrInsufficientFunds
+	}
+	a.balance -= amount
+	return nil
+}
+
+func (a *rwmutex) Balance() int {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.balance
+}
+
+func (a *rwmutex) Close() {}
+
+// !- rwmutex
+
+// !+ atomic
+
+// NewAtomic 返回一个用 sync/atomic 更新 balance 的账户
+// Withdraw 使用比较并交换（CAS）循环，余额在检查之后被其他 goroutine 修改时会重试
+func NewAtomic() Account {
+	return new(atomicAccount)
+}
+
+type atomicAccount struct {
+	balance int64
+}
+
+func (a *atomicAccount) Deposit(amount int) {
+	atomic.AddInt64(&a.balance, int64(amount))
+}
+
+func (a *atomicAccount) Withdraw(amount int) error {
+	for {
+		b := atomic.LoadInt64(&a.balance)
+		if b < int64(amount) {
+			return ErrInsufficientFunds
+		}
+		if atomic.CompareAndSwapInt64(&a.balance, b, b-int64(amount)) {
+			return nil
+		}
+	}
+}
+
+func (a *atomicAccount) Balance() int {
+	return int(atomic.LoadInt64(&a.balance))
+}
+
+func (a *atomicAccount) Close() {}
+
+// !- atomic
@@ -0,0 +1,147 @@
+package bank_test
+
+import (
+	"sync"
+	"testing"
+
+	"gostudy/09、基于共享变量的并发/files/bank"
+)
+
+var strategies = []struct {
+	name string
+	new  func() bank.Account
+}{
+	{"Monitor", bank.NewMonitor},
+	{"Semaphore", bank.NewSemaphore},
+	{"Mutex", bank.NewMutex},
+	{"RWMutex", bank.NewRWMutex},
+	{"Atomic", bank.NewAtomic},
+}
+
+// 对每种实现运行相同的检查，使用 -race 运行
+func TestAccount(t *testing.T) {
+	for _, s := range strategies {
+		t.Run(s.name, func(t *testing.T) {
+			t.Run("ConcurrentDeposits", func(t *testing.T) {
+				a := s.new()
+				defer a.Close()
+				// 1000 个并发存款
+				var n sync.WaitGroup
+				for i := 1; i <= 1000; i++ {
+					n.Add(1)
+					go func(amount int) {
+						a.Deposit(amount)
+						n.Done()
+					}(i)
+				}
+				n.Wait()
+				if got, want := a.Balance(), (1000+1)*1000/2; got != want {
+					t.Errorf("Balance = %d, want %d", got, want)
+				}
+			})
+
+			t.Run("Withdraw", func(t *testing.T) {
+				a := s.new()
+				defer a.Close()
+				a.Deposit(100)
+				if err := a.Withdraw(30); err != nil {
+					t.Fatal(err)
+				}
+				if err := a.Withdraw(71); err != bank.ErrInsufficientFunds {
+					t.Errorf("Withdraw(71) = %v, want ErrInsufficientFunds", err)
+				}
+				if got := a.Balance(); got != 70 {
+					t.Errorf("Balance = %d, want 70", got)
+				}
+			})
+
+			// 并发取款时，余额不会小于零，成功的取款数与余额一致
+			t.Run("ConcurrentWithdraws", func(t *testing.T) {
+				a := s.new()
+				defer a.Close()
+				a.Deposit(500)
+				var n sync.WaitGroup
+				var mu sync.Mutex
+				ok := 0
+				for i := 0; i < 1000; i++ {
+					n.Add(1)
+					go func() {
+						defer n.Done()
+						if a.Withdraw(1) == nil {
+							mu.Lock()
+							ok++
+							mu.Unlock()
+						}
+						if b := a.Balance(); b < 0 {
+							t.Errorf("Balance = %d, below zero", b)
+						}
+					}()
+				}
+				n.Wait()
+				if ok != 500 || a.Balance() != 0 {
+					t.Errorf("%d withdrawals succeeded, Balance = %d; want 500, 0", ok, a.Balance())
+				}
+			})
+		})
+	}
+}
+
+// benchmark 让每个 goroutine 循环执行操作，每 10 次中有 writes 次存取款，其余是查询余额
+func benchmark(b *testing.B, writes, parallelism int) {
+	for _, s := range strategies {
+		b.Run(s.name, func(b *testing.B) {
+			a := s.new()
+			defer a.Close()
+			a.Deposit(1 << 30)
+			b.SetParallelism(parallelism)
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					switch {
+					case i%10 >= writes:
+						a.Balance()
+					case i%2 == 0:
+						a.Deposit(1)
+					default:
+						a.Withdraw(1)
+					}
+				}
+			})
+		})
+	}
+}
+
+// 读多写少：90% 查询余额
+func BenchmarkReadHeavy(b *testing.B) { benchmark(b, 1, 1) }
+
+// 写多读少：90% 存取款
+func BenchmarkWriteHeavy(b *testing.B) { benchmark(b, 9, 1) }
+
+// 高度竞争：每个 CPU 8 个 goroutine，一半存取款
+func BenchmarkContended(b *testing.B) { benchmark(b, 5, 8) }
+
+/*
+命令：
+go test -run=xxx -bench=. -benchtime=200ms
+执行结果（1 个 CPU）：
+BenchmarkReadHeavy/Monitor         	  499818	       408.2 ns/op
+BenchmarkReadHeavy/Semaphore       	 5457196	        43.24 ns/op
+BenchmarkReadHeavy/Mutex           	12995127	        18.73 ns/op
+BenchmarkReadHeavy/RWMutex         	11845058	        21.08 ns/op
+BenchmarkReadHeavy/Atomic          	83715633	         2.844 ns/op
+BenchmarkWriteHeavy/Monitor        	  440965	       515.3 ns/op
+BenchmarkWriteHeavy/Semaphore      	 5422502	        49.28 ns/op
+BenchmarkWriteHeavy/Mutex          	12993828	        19.01 ns/op
+BenchmarkWriteHeavy/RWMutex        	 6766899	        36.13 ns/op
+BenchmarkWriteHeavy/Atomic         	25040949	         9.679 ns/op
+BenchmarkContended/Monitor         	  475494	       493.0 ns/op
+BenchmarkContended/Semaphore       	 5629615	       243.4 ns/op
+BenchmarkContended/Mutex           	 9340650	        27.81 ns/op
+BenchmarkContended/RWMutex         	 6686530	        37.71 ns/op
+BenchmarkContended/Atomic          	33944839	         7.120 ns/op
+PASS
+
+monitor goroutine 每次操作都要经过 channel 和调度器，比互斥锁慢一个数量级；
+只有一个 CPU 时读操作不会真正并行，所以 RWMutex 并不比 Mutex 快，写多时反而更慢；
+单个整数的余额用 atomic 最快，但它无法扩展到需要同时修改多个变量的临界区（例如 Ledger 的转账）
+在多个 CPU 上运行时，请使用 -cpu=1,4,8 比较结果
+*/
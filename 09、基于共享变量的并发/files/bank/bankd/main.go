@@ -0,0 +1,45 @@
+// bankd 通过 TCP 和 HTTP 提供 bank.Service
+// go run bankd/main.go -dir /tmp/bank&
+// nc localhost 8000
+// OPEN alice
+// DEPOSIT alice 100 @req-1
+// curl -d '{"account":"alice","amount":30}' -H 'Idempotency-Key: req-2' localhost:8080/withdraw
+// curl localhost:8080/balance?account=alice
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"gostudy/09、基于共享变量的并发/files/bank"
+)
+
+var (
+	dir      = flag.String("dir", "bank-data", "存放日志和快照的目录")
+	tcpAddr  = flag.String("tcp", "localhost:8000", "TCP 协议的监听地址")
+	httpAddr = flag.String("http", "localhost:8080", "HTTP 接口的监听地址")
+	every    = flag.Int("snapshot-every", 1000, "每写入这么多条日志做一次快照")
+	interval = flag.Duration("snapshot-interval", time.Minute, "定期做快照的间隔")
+)
+
+func main() {
+	flag.Parse()
+	s, err := bank.OpenService(*dir, bank.ServiceOptions{
+		SnapshotEvery:    *every,
+		SnapshotInterval: *interval,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+	// 不需要在退出前调用 s.Close，已确认的修改都已 fsync 到日志中
+
+	l, err := net.Listen("tcp", *tcpAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	go func() { log.Fatal(s.Serve(l)) }()
+	log.Fatal(http.ListenAndServe(*httpAddr, s.Handler()))
+}
@@ -0,0 +1,39 @@
+package bank
+
+import "errors"
+
+// ErrInjected 是 FailLog 注入的错误
+var ErrInjected = errors.New("injected failure")
+
+// failingLog 在 Write 之后的 Sync 或 Truncate 失败一次
+type failingLog struct {
+	logFile
+	sync, truncate bool
+}
+
+func (f *failingLog) Sync() error {
+	if f.sync {
+		f.sync = false
+		return ErrInjected
+	}
+	return f.logFile.Sync()
+}
+
+func (f *failingLog) Truncate(size int64) error {
+	if f.truncate {
+		f.truncate = false
+		return ErrInjected
+	}
+	return f.logFile.Truncate(size)
+}
+
+// FailLog 使 s 的日志的下一次 Sync（sync 为 true 时）或 Truncate（truncate 为 true 时）失败
+func FailLog(s *Service, sync, truncate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if f, ok := s.wal.(*failingLog); ok {
+		f.sync, f.truncate = sync, truncate
+		return
+	}
+	s.wal = &failingLog{s.wal, sync, truncate}
+}
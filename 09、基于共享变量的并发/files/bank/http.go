@@ -0,0 +1,90 @@
+package bank
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// JSON HTTP 接口：
+//
+//	POST /open      {"account": "alice", "overdraft": 0}
+//	POST /deposit   {"account": "alice", "amount": 100}
+//	POST /withdraw  {"account": "alice", "amount": 30}
+//	POST /transfer  {"account": "alice", "to": "bob", "amount": 20}
+//	GET  /balance?account=alice   -> {"account": "alice", "balance": 50}
+//	GET  /history?account=alice   -> [交易, ...]
+//
+// 修改请求的幂等键可以放在请求体的 "key" 字段或 Idempotency-Key 头中
+// 失败时返回 {"error": "错误信息"}，状态码为 400、404 或 409
+
+// Handler 返回服务的 HTTP 接口
+func (s *Service) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, kind := range []string{"open", "deposit", "withdraw", "transfer"} {
+		kind := kind
+		mux.HandleFunc("/"+kind, func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				writeJSON(w, http.StatusMethodNotAllowed, errorBody{"method not allowed"})
+				return
+			}
+			var op Op
+			if err := json.NewDecoder(r.Body).Decode(&op); err != nil {
+				writeJSON(w, http.StatusBadRequest, errorBody{err.Error()})
+				return
+			}
+			op.Kind, op.Seq = kind, 0
+			if key := r.Header.Get("Idempotency-Key"); key != "" {
+				op.Key = key
+			}
+			if err := s.Do(op); err != nil {
+				writeError(w, err)
+				return
+			}
+			writeJSON(w, http.StatusOK, struct{}{})
+		})
+	}
+	mux.HandleFunc("/balance", func(w http.ResponseWriter, r *http.Request) {
+		name := r.URL.Query().Get("account")
+		b, err := s.ledger.Balance(name)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, struct {
+			Account string `json:"account"`
+			Balance int    `json:"balance"`
+		}{name, b})
+	})
+	mux.HandleFunc("/history", func(w http.ResponseWriter, r *http.Request) {
+		txs, err := s.ledger.History(r.URL.Query().Get("account"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, txs)
+	})
+	return mux
+}
+
+type errorBody struct {
+	Error string `json:"error"`
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	code := http.StatusInternalServerError
+	switch err {
+	case ErrNoAccount:
+		code = http.StatusNotFound
+	case ErrInvalidAmount, ErrSameAccount:
+		code = http.StatusBadRequest
+	case ErrInsufficientFunds, ErrAccountExists:
+		code = http.StatusConflict
+	}
+	writeJSON(w, code, errorBody{err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,235 @@
+// Package bank 提供有多个账户的并发安全的银行
+// 与 bank1、bank2 和 bank3 只有一个全局余额不同，Ledger 中每个账户有自己的锁，
+// 转账按照账户名的顺序获取两个账户的锁，所以并发的双向转账不会死锁
+package bank
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// 错误
+var (
+	ErrInsufficientFunds = errors.New("bank: insufficient funds")
+	ErrNoAccount         = errors.New("bank: no such account")
+	ErrAccountExists     = errors.New("bank: account already exists")
+	ErrInvalidAmount     = errors.New("bank: amount must be positive")
+	ErrSameAccount       = errors.New("bank: transfer to the same account")
+)
+
+// Kind 是交易的类型
+type Kind int
+
+const (
+	Deposit Kind = iota
+	Withdraw
+	Transfer
+)
+
+func (k Kind) String() string {
+	switch k {
+	case Deposit:
+		return "deposit"
+	case Withdraw:
+		return "withdraw"
+	case Transfer:
+		return "transfer"
+	}
+	return "unknown"
+}
+
+// Transaction 是日志中的一条交易
+// 存款只有 To，取款只有 From，转账两者都有
+type Transaction struct {
+	Seq    int64 // 从 1 开始递增
+	Time   time.Time
+	Kind   Kind
+	From   string
+	To     string
+	Amount int
+}
+
+type account struct {
+	mu        sync.Mutex // 守护 balance
+	name      string
+	balance   int
+	overdraft int // 允许透支的额度
+}
+
+// Ledger 是有多个账户的银行，零值不可用，请使用 NewLedger
+type Ledger struct {
+	mu       sync.RWMutex // 守护 accounts
+	accounts map[string]*account
+
+	// 持有账户的锁时才能获取 jmu，所以每个账户的交易在日志中的顺序与发生的顺序相同
+	jmu     sync.Mutex
+	journal []Transaction
+	history map[string][]int // 账户名 -> 相关交易在 journal 中的下标
+}
+
+// NewLedger 返回一个没有账户的 Ledger
+func NewLedger() *Ledger {
+	return &Ledger{
+		accounts: make(map[string]*account),
+		history:  make(map[string][]int),
+	}
+}
+
+// Open 开设一个余额为 0 的账户，overdraft 是允许透支的额度
+func (l *Ledger) Open(name string, overdraft int) error {
+	if overdraft < 0 {
+		return ErrInvalidAmount
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.accounts[name]; ok {
+		return ErrAccountExists
+	}
+	l.accounts[name] = &account{name: name, overdraft: overdraft}
+	return nil
+}
+
+// Accounts 返回所有账户名，按字母顺序排列
+func (l *Ledger) Accounts() []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	var names []string
+	for name := range l.accounts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (l *Ledger) account(name string) (*account, error) {
+	l.mu.RLock()
+	a, ok := l.accounts[name]
+	l.mu.RUnlock()
+	if !ok {
+		return nil, ErrNoAccount
+	}
+	return a, nil
+}
+
+// Balance 查询余额
+func (l *Ledger) Balance(name string) (int, error) {
+	a, err := l.account(name)
+	if err != nil {
+		return 0, err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.balance, nil
+}
+
+// Deposit 存款
+func (l *Ledger) Deposit(name string, amount int) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	a, err := l.account(name)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.balance += amount
+	l.record(Transaction{Kind: Deposit, To: name, Amount: amount})
+	return nil
+}
+
+// Withdraw 取款，余额加上透支额度不足时返回 ErrInsufficientFunds
+func (l *Ledger) Withdraw(name string, amount int) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	a, err := l.account(name)
+	if err != nil {
+		return err
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if !a.canPay(amount) {
+		return ErrInsufficientFunds
+	}
+	a.balance -= amount
+	l.record(Transaction{Kind: Withdraw, From: name, Amount: amount})
+	return nil
+}
+
+// Transfer 从 from 转账到 to，要么两个账户都改变，要么都不变
+func (l *Ledger) Transfer(from, to string, amount int) error {
+	if amount <= 0 {
+		return ErrInvalidAmount
+	}
+	if from == to {
+		return ErrSameAccount
+	}
+	src, err := l.account(from)
+	if err != nil {
+		return err
+	}
+	dst, err := l.account(to)
+	if err != nil {
+		return err
+	}
+	// 总是先锁账户名较小的账户，避免 A->B 和 B->A 同时进行时死锁
+	first, second := src, dst
+	if to < from {
+		first, second = dst, src
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	second.mu.Lock()
+	defer second.mu.Unlock()
+
+	if !src.canPay(amount) {
+		return ErrInsufficientFunds
+	}
+	src.balance -= amount
+	dst.balance += amount
+	l.record(Transaction{Kind: Transfer, From: from, To: to, Amount: amount})
+	return nil
+}
+
+func (a *account) canPay(amount int) bool {
+	return a.balance-amount >= -a.overdraft
+}
+
+// record 把交易追加到日志中，调用方必须持有相关账户的锁
+func (l *Ledger) record(tx Transaction) {
+	l.jmu.Lock()
+	defer l.jmu.Unlock()
+	tx.Seq = int64(len(l.journal)) + 1
+	tx.Time = time.Now()
+	i := len(l.journal)
+	l.journal = append(l.journal, tx)
+	for _, name := range []string{tx.From, tx.To} {
+		if name != "" {
+			l.history[name] = append(l.history[name], i)
+		}
+	}
+}
+
+// Journal 返回所有交易的副本，按 Seq 排序
+func (l *Ledger) Journal() []Transaction {
+	l.jmu.Lock()
+	defer l.jmu.Unlock()
+	return append([]Transaction(nil), l.journal...)
+}
+
+// History 返回与账户 name 相关的交易，按 Seq 排序
+func (l *Ledger) History(name string) ([]Transaction, error) {
+	if _, err := l.account(name); err != nil {
+		return nil, err
+	}
+	l.jmu.Lock()
+	defer l.jmu.Unlock()
+	var txs []Transaction
+	for _, i := range l.history[name] {
+		txs = append(txs, l.journal[i])
+	}
+	return txs, nil
+}
@@ -0,0 +1,180 @@
+package bank_test
+
+import (
+	"sync"
+	"testing"
+
+	"gostudy/09、基于共享变量的并发/files/bank"
+)
+
+func newLedger(t *testing.T, accounts map[string]int) *bank.Ledger {
+	t.Helper()
+	l := bank.NewLedger()
+	for name, balance := range accounts {
+		if err := l.Open(name, 0); err != nil {
+			t.Fatal(err)
+		}
+		if balance > 0 {
+			if err := l.Deposit(name, balance); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	return l
+}
+
+func balance(t *testing.T, l *bank.Ledger, name string) int {
+	t.Helper()
+	b, err := l.Balance(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestWithdraw(t *testing.T) {
+	l := newLedger(t, map[string]int{"alice": 100})
+	if err := l.Withdraw("alice", 30); err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Withdraw("alice", 71); err != bank.ErrInsufficientFunds {
+		t.Errorf("Withdraw(71) = %v, want ErrInsufficientFunds", err)
+	}
+	if got := balance(t, l, "alice"); got != 70 {
+		t.Errorf("Balance = %d, want 70", got)
+	}
+	for _, err := range []error{
+		l.Withdraw("alice", 0),
+		l.Withdraw("bob", 1),
+		l.Deposit("alice", -5),
+	} {
+		if err != bank.ErrInvalidAmount && err != bank.ErrNoAccount {
+			t.Errorf("got %v, want a validation error", err)
+		}
+	}
+}
+
+func TestOverdraft(t *testing.T) {
+	l := bank.NewLedger()
+	l.Open("carol", 50)
+	l.Open("dave", 0)
+	if err := l.Transfer("carol", "dave", 50); err != nil {
+		t.Fatalf("Transfer within overdraft: %v", err)
+	}
+	if err := l.Withdraw("carol", 1); err != bank.ErrInsufficientFunds {
+		t.Errorf("Withdraw beyond overdraft = %v, want ErrInsufficientFunds", err)
+	}
+	if got := balance(t, l, "carol"); got != -50 {
+		t.Errorf("Balance = %d, want -50", got)
+	}
+}
+
+func TestTransferAtomic(t *testing.T) {
+	l := newLedger(t, map[string]int{"alice": 100, "bob": 0})
+	if err := l.Transfer("alice", "bob", 150); err != bank.ErrInsufficientFunds {
+		t.Errorf("Transfer(150) = %v, want ErrInsufficientFunds", err)
+	}
+	if a, b := balance(t, l, "alice"), balance(t, l, "bob"); a != 100 || b != 0 {
+		t.Errorf("after failed transfer: alice = %d, bob = %d, want 100, 0", a, b)
+	}
+	if err := l.Transfer("alice", "alice", 1); err != bank.ErrSameAccount {
+		t.Errorf("self transfer = %v, want ErrSameAccount", err)
+	}
+	if err := l.Transfer("alice", "nobody", 1); err != bank.ErrNoAccount {
+		t.Errorf("transfer to missing account = %v, want ErrNoAccount", err)
+	}
+}
+
+// 使用 -race 运行：双向并发转账不会死锁，总金额不变
+func TestConcurrentTransfers(t *testing.T) {
+	names := []string{"a", "b", "c", "d"}
+	accounts := make(map[string]int)
+	for _, name := range names {
+		accounts[name] = 1000
+	}
+	l := newLedger(t, accounts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 1000; i++ {
+		from, to := names[i%len(names)], names[(i*7+1)%len(names)]
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			l.Transfer(from, to, 3)
+		}()
+		go func() {
+			defer wg.Done()
+			l.Transfer(to, from, 5)
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, name := range names {
+		b := balance(t, l, name)
+		if b < 0 {
+			t.Errorf("%s overdrawn: %d", name, b)
+		}
+		total += b
+	}
+	if total != 4000 {
+		t.Errorf("total = %d, want 4000", total)
+	}
+
+	// 重放日志得到相同的余额
+	replay := make(map[string]int)
+	for _, tx := range l.Journal() {
+		switch tx.Kind {
+		case bank.Deposit:
+			replay[tx.To] += tx.Amount
+		case bank.Withdraw:
+			replay[tx.From] -= tx.Amount
+		case bank.Transfer:
+			replay[tx.From] -= tx.Amount
+			replay[tx.To] += tx.Amount
+		}
+	}
+	for _, name := range names {
+		if replay[name] != balance(t, l, name) {
+			t.Errorf("replayed %s = %d, want %d", name, replay[name], balance(t, l, name))
+		}
+	}
+}
+
+func TestHistory(t *testing.T) {
+	l := newLedger(t, map[string]int{"alice": 100, "bob": 10, "carol": 0})
+	l.Transfer("alice", "bob", 20)
+	l.Withdraw("bob", 5)
+	l.Transfer("bob", "carol", 25)
+	l.Withdraw("carol", 100) // 失败的交易不会记录
+
+	h, err := l.History("bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct {
+		kind     bank.Kind
+		from, to string
+		amount   int
+	}{
+		{bank.Deposit, "", "bob", 10},
+		{bank.Transfer, "alice", "bob", 20},
+		{bank.Withdraw, "bob", "", 5},
+		{bank.Transfer, "bob", "carol", 25},
+	}
+	if len(h) != len(want) {
+		t.Fatalf("History(bob) has %d transactions, want %d: %+v", len(h), len(want), h)
+	}
+	for i, w := range want {
+		tx := h[i]
+		if tx.Kind != w.kind || tx.From != w.from || tx.To != w.to || tx.Amount != w.amount {
+			t.Errorf("History(bob)[%d] = %+v, want %+v", i, tx, w)
+		}
+		if i > 0 && tx.Seq <= h[i-1].Seq {
+			t.Errorf("History(bob) not ordered by Seq: %d after %d", tx.Seq, h[i-1].Seq)
+		}
+	}
+	if _, err := l.History("nobody"); err != bank.ErrNoAccount {
+		t.Errorf("History(nobody) = %v, want ErrNoAccount", err)
+	}
+}
@@ -0,0 +1,148 @@
+package bank
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 基于行的 TCP 协议，与 08 章的聊天服务一样，每个连接由一个 handleConn goroutine 处理
+// 每行一个命令，可选的幂等键以 @ 开头放在最后：
+//
+//	OPEN alice [overdraft] [@key]
+//	DEPOSIT alice 100 [@key]
+//	WITHDRAW alice 30 [@key]
+//	TRANSFER alice bob 20 [@key]
+//	BALANCE alice
+//	HISTORY alice
+//
+// 成功时回复 "OK"，BALANCE 回复 "OK 余额"，HISTORY 回复 "OK n" 和随后的 n 行交易；失败时回复 "ERR 错误信息"
+
+// Serve 接受 l 上的连接并为每个连接启动一个 goroutine，直到 l 被关闭
+// 返回之前会关闭所有连接并等待它们的 goroutine 退出
+func (s *Service) Serve(l net.Listener) error {
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		conns = make(map[net.Conn]bool)
+	)
+	defer func() {
+		mu.Lock()
+		for conn := range conns {
+			conn.Close()
+		}
+		mu.Unlock()
+		wg.Wait()
+	}()
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		mu.Lock()
+		conns[conn] = true
+		mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.handleConn(conn)
+			mu.Lock()
+			delete(conns, conn)
+			mu.Unlock()
+		}()
+	}
+}
+
+func (s *Service) handleConn(conn net.Conn) {
+	defer conn.Close()
+	w := bufio.NewWriter(conn)
+	input := bufio.NewScanner(conn)
+	for input.Scan() {
+		fields := strings.Fields(input.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		s.command(w, fields)
+		if w.Flush() != nil {
+			return
+		}
+	}
+}
+
+// command 执行一行命令，并把回复写入 w
+func (s *Service) command(w *bufio.Writer, fields []string) {
+	var key string
+	if last := fields[len(fields)-1]; strings.HasPrefix(last, "@") {
+		key, fields = last[1:], fields[:len(fields)-1]
+	}
+	cmd, args := strings.ToUpper(fields[0]), fields[1:]
+	// num 把 args[i] 解析为整数存入 n，不是整数时返回 false，此时回复用法
+	var n int
+	num := func(i int) bool {
+		var err error
+		n, err = strconv.Atoi(args[i])
+		return err == nil
+	}
+	usage := func(format string) {
+		fmt.Fprintf(w, "ERR usage: %s %s\n", cmd, format)
+	}
+
+	var err error
+	switch {
+	case cmd == "OPEN" && len(args) == 1:
+		err = s.Open(args[0], 0, key)
+	case cmd == "OPEN" && len(args) == 2 && num(1):
+		err = s.Open(args[0], n, key)
+	case cmd == "OPEN":
+		usage("name [overdraft] [@key]")
+		return
+	case cmd == "DEPOSIT" && len(args) == 2 && num(1):
+		err = s.Deposit(args[0], n, key)
+	case cmd == "WITHDRAW" && len(args) == 2 && num(1):
+		err = s.Withdraw(args[0], n, key)
+	case (cmd == "DEPOSIT" || cmd == "WITHDRAW"):
+		usage("name amount [@key]")
+		return
+	case cmd == "TRANSFER" && len(args) == 3 && num(2):
+		err = s.Transfer(args[0], args[1], n, key)
+	case cmd == "TRANSFER":
+		usage("from to amount [@key]")
+		return
+	case cmd == "BALANCE" && len(args) == 1:
+		var b int
+		if b, err = s.ledger.Balance(args[0]); err == nil {
+			fmt.Fprintf(w, "OK %d\n", b)
+			return
+		}
+	case cmd == "HISTORY" && len(args) == 1:
+		var txs []Transaction
+		if txs, err = s.ledger.History(args[0]); err == nil {
+			fmt.Fprintf(w, "OK %d\n", len(txs))
+			for _, tx := range txs {
+				fmt.Fprintf(w, "%d %s %s %s %d\n", tx.Seq, tx.Kind, dash(tx.From), dash(tx.To), tx.Amount)
+			}
+			return
+		}
+	case cmd == "BALANCE" || cmd == "HISTORY":
+		usage("name")
+		return
+	default:
+		fmt.Fprintf(w, "ERR unknown command %q\n", fields[0])
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(w, "ERR %v\n", err)
+		return
+	}
+	fmt.Fprintln(w, "OK")
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
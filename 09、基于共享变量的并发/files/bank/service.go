@@ -0,0 +1,424 @@
+package bank
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Op 是一次修改，它在执行之前被写入预写日志（write-ahead log）
+type Op struct {
+	Seq       int64     `json:"seq"`
+	Time      time.Time `json:"time"`
+	Kind      string    `json:"op"` // open、deposit、withdraw 或 transfer
+	Account   string    `json:"account"`
+	To        string    `json:"to,omitempty"`
+	Amount    int       `json:"amount,omitempty"`
+	Overdraft int       `json:"overdraft,omitempty"`
+	Key       string    `json:"key,omitempty"` // 幂等键，相同的键只执行一次
+}
+
+// ServiceOptions 配置 Service
+type ServiceOptions struct {
+	SnapshotEvery    int           // 每写入这么多条日志做一次快照，0 表示不按条数
+	SnapshotInterval time.Duration // 定期做快照的间隔，0 表示不定期
+}
+
+// Service 是可以在崩溃后恢复的 Ledger
+// 每个修改先写入日志并 fsync，然后才执行并返回给客户端；启动时从最近的快照和之后的日志恢复状态
+// 执行是确定的，失败的修改（例如资金不足）在重放时同样会失败，所以它们也记录在日志中
+type Service struct {
+	dir  string
+	opts ServiceOptions
+
+	mu      sync.Mutex // 使修改串行执行，日志的顺序就是执行的顺序；守护以下字段
+	ledger  *Ledger
+	wal     logFile
+	seq     int64             // 最后一条日志的序号
+	results map[string]string // 幂等键 -> 执行结果，空字符串表示成功
+	pending int               // 上次快照后写入的日志条数
+	snapErr error             // 最近一次自动快照的错误
+	failed  error             // 日志的状态不确定，之后的修改都返回它
+	closed  bool
+
+	done chan struct{}
+}
+
+// logFile 是日志需要的 *os.File 的方法，测试中用它注入写入错误
+type logFile interface {
+	io.Writer
+	io.Seeker
+	io.Closer
+	Sync() error
+	Truncate(size int64) error
+}
+
+const (
+	walName      = "wal.log"
+	snapshotName = "snapshot.json"
+)
+
+// snapshot 是快照文件的内容
+type snapshot struct {
+	Seq      int64             `json:"seq"`
+	Accounts []snapshotAccount `json:"accounts"`
+	Journal  []Transaction     `json:"journal"`
+	Results  map[string]string `json:"results"`
+}
+
+type snapshotAccount struct {
+	Name      string `json:"name"`
+	Balance   int    `json:"balance"`
+	Overdraft int    `json:"overdraft"`
+}
+
+// OpenService 从 dir 中的快照和日志恢复状态，dir 不存在时会被创建
+// 客户端必须随后调用 Close
+func OpenService(dir string, opts ServiceOptions) (*Service, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	s := &Service{
+		dir:     dir,
+		opts:    opts,
+		ledger:  NewLedger(),
+		results: make(map[string]string),
+		done:    make(chan struct{}),
+	}
+	if err := s.loadSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replay(); err != nil {
+		return nil, err
+	}
+	if opts.SnapshotInterval > 0 {
+		go s.snapshotter(opts.SnapshotInterval)
+	}
+	return s, nil
+}
+
+// Ledger 返回服务的账本，只能用于查询，修改必须通过 Service 的方法
+func (s *Service) Ledger() *Ledger { return s.ledger }
+
+func (s *Service) loadSnapshot() error {
+	data, err := ioutil.ReadFile(filepath.Join(s.dir, snapshotName))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("bank: bad snapshot: %v", err)
+	}
+	l := s.ledger
+	for _, a := range snap.Accounts {
+		l.accounts[a.Name] = &account{name: a.Name, balance: a.Balance, overdraft: a.Overdraft}
+	}
+	for i, tx := range snap.Journal {
+		l.journal = append(l.journal, tx)
+		for _, name := range []string{tx.From, tx.To} {
+			if name != "" {
+				l.history[name] = append(l.history[name], i)
+			}
+		}
+	}
+	if snap.Results != nil {
+		s.results = snap.Results
+	}
+	s.seq = snap.Seq
+	return nil
+}
+
+// 日志的每一行为：CRC-32（十六进制） JSON
+// 最后一行不完整或校验失败说明写到一半时崩溃了，这条修改没有被确认，恢复时把它截掉
+func encodeOp(op Op) []byte {
+	data, _ := json.Marshal(op)
+	return []byte(fmt.Sprintf("%08x %s\n", crc32.ChecksumIEEE(data), data))
+}
+
+func decodeOp(line []byte) (Op, bool) {
+	var op Op
+	i := bytes.IndexByte(line, ' ')
+	if i < 0 || line[len(line)-1] != '\n' {
+		return op, false
+	}
+	sum, err := strconv.ParseUint(string(line[:i]), 16, 32)
+	data := line[i+1 : len(line)-1]
+	if err != nil || uint32(sum) != crc32.ChecksumIEEE(data) {
+		return op, false
+	}
+	return op, json.Unmarshal(data, &op) == nil
+}
+
+// replay 执行快照之后的日志，并打开日志以便追加
+func (s *Service) replay() error {
+	f, err := os.OpenFile(filepath.Join(s.dir, walName), os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	var good int64
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		op, ok := decodeOp(line)
+		if !ok {
+			break
+		}
+		good += int64(len(line))
+		if op.Seq <= s.seq {
+			continue // 已经包含在快照中
+		}
+		s.seq = op.Seq
+		s.apply(op)
+	}
+	if err := f.Truncate(good); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(good, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	s.wal = f
+	return nil
+}
+
+// apply 执行 op 并记录幂等键的结果，调用方必须持有 mu
+func (s *Service) apply(op Op) error {
+	var err error
+	switch op.Kind {
+	case "open":
+		err = s.ledger.Open(op.Account, op.Overdraft)
+	case "deposit":
+		err = s.ledger.Deposit(op.Account, op.Amount)
+	case "withdraw":
+		err = s.ledger.Withdraw(op.Account, op.Amount)
+	case "transfer":
+		err = s.ledger.Transfer(op.Account, op.To, op.Amount)
+	default:
+		err = fmt.Errorf("bank: unknown operation %q", op.Kind)
+	}
+	if err == nil && op.Kind != "open" {
+		// 交易时间使用写入日志的时间，而不是重放的时间
+		l := s.ledger
+		l.jmu.Lock()
+		l.journal[len(l.journal)-1].Time = op.Time
+		l.jmu.Unlock()
+	}
+	if op.Key != "" {
+		s.results[op.Key] = errString(err)
+	}
+	return err
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+var knownErrors = map[string]error{}
+
+func init() {
+	for _, err := range []error{
+		ErrInsufficientFunds, ErrNoAccount, ErrAccountExists, ErrInvalidAmount, ErrSameAccount,
+	} {
+		knownErrors[err.Error()] = err
+	}
+}
+
+// parseErr 把记录的结果还原为错误，以便客户端可以与 ErrInsufficientFunds 等比较
+func parseErr(msg string) error {
+	if msg == "" {
+		return nil
+	}
+	if err, ok := knownErrors[msg]; ok {
+		return err
+	}
+	return errors.New(msg)
+}
+
+// ErrClosed 表示 Service 已经关闭
+var ErrClosed = errors.New("bank: service closed")
+
+// Do 执行一个修改：先写入日志并 fsync，再执行
+// 如果 op.Key 已经执行过，直接返回当时的结果，不会再次执行
+func (s *Service) Do(op Op) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	if op.Key != "" {
+		if msg, ok := s.results[op.Key]; ok {
+			return parseErr(msg)
+		}
+	}
+	if s.failed != nil {
+		return s.failed
+	}
+	op.Seq, op.Time = s.seq+1, time.Now()
+	if err := s.append(op); err != nil {
+		return err
+	}
+	s.seq = op.Seq
+	err := s.apply(op)
+	s.pending++
+	if s.opts.SnapshotEvery > 0 && s.pending >= s.opts.SnapshotEvery {
+		// op 已经执行并写入日志，快照失败不改变它的结果，日志仍然完整，下次再试
+		s.snapErr = s.snapshot()
+	}
+	return err
+}
+
+// append 把 op 写入日志并 fsync
+// 失败时把日志截回写入之前的长度，否则这条没有被确认的修改会在恢复时被执行，
+// 而且下一个修改会使用相同的序号；截断也失败时 Service 进入失败状态
+func (s *Service) append(op Op) error {
+	off, err := s.wal.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err = s.wal.Write(encodeOp(op)); err == nil {
+		err = s.wal.Sync()
+	}
+	if err == nil {
+		return nil
+	}
+	rerr := s.wal.Truncate(off)
+	if rerr == nil {
+		_, rerr = s.wal.Seek(off, io.SeekStart)
+	}
+	if rerr == nil {
+		rerr = s.wal.Sync()
+	}
+	if rerr != nil {
+		s.failed = fmt.Errorf("bank: log may be damaged: %v", rerr)
+	}
+	return err
+}
+
+// SnapshotErr 返回最近一次自动快照（SnapshotEvery 或 SnapshotInterval）的错误，成功之后为 nil
+// 自动快照失败不影响修改的结果，所以 Do 不返回它
+func (s *Service) SnapshotErr() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.snapErr
+}
+
+// Open、Deposit、Withdraw 和 Transfer 是 Do 的简便写法，key 为空表示不需要幂等
+
+// Open 开设账户
+func (s *Service) Open(name string, overdraft int, key string) error {
+	return s.Do(Op{Kind: "open", Account: name, Overdraft: overdraft, Key: key})
+}
+
+// Deposit 存款
+func (s *Service) Deposit(name string, amount int, key string) error {
+	return s.Do(Op{Kind: "deposit", Account: name, Amount: amount, Key: key})
+}
+
+// Withdraw 取款
+func (s *Service) Withdraw(name string, amount int, key string) error {
+	return s.Do(Op{Kind: "withdraw", Account: name, Amount: amount, Key: key})
+}
+
+// Transfer 转账
+func (s *Service) Transfer(from, to string, amount int, key string) error {
+	return s.Do(Op{Kind: "transfer", Account: from, To: to, Amount: amount, Key: key})
+}
+
+// Snapshot 立即做一次快照，然后清空日志
+func (s *Service) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrClosed
+	}
+	return s.snapshot()
+}
+
+// snapshot 把当前状态写入临时文件，fsync 后重命名为快照，最后清空日志
+// 在重命名和清空之间崩溃时，日志中的条目序号都不大于快照的序号，恢复时会被跳过
+func (s *Service) snapshot() error {
+	l := s.ledger
+	snap := snapshot{Seq: s.seq, Journal: l.Journal(), Results: s.results}
+	for _, name := range l.Accounts() {
+		a, _ := l.account(name)
+		snap.Accounts = append(snap.Accounts, snapshotAccount{name, a.balance, a.overdraft})
+	}
+	data, err := json.Marshal(snap)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".snapshot-")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(s.dir, snapshotName))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := s.wal.Truncate(0); err != nil {
+		return err // 日志中的条目都会在恢复时被跳过，之后的条目仍然可以追加
+	}
+	if _, err := s.wal.Seek(0, io.SeekStart); err != nil {
+		s.failed = fmt.Errorf("bank: log may be damaged: %v", err) // 之后的写入会在日志中留下空洞
+		return err
+	}
+	s.pending = 0
+	return nil
+}
+
+func (s *Service) snapshotter(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.pending > 0 && !s.closed {
+				s.snapErr = s.snapshot() // 失败时下次再试，日志仍然完整
+			}
+			s.mu.Unlock()
+		case <-s.done:
+			return
+		}
+	}
+}
+
+// Close 关闭日志，不做快照，与进程被杀死时的状态相同
+func (s *Service) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	close(s.done)
+	return s.wal.Close()
+}
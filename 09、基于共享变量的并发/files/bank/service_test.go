@@ -0,0 +1,345 @@
+package bank_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gostudy/09、基于共享变量的并发/files/bank"
+)
+
+func openService(t *testing.T, dir string, opts bank.ServiceOptions) *bank.Service {
+	t.Helper()
+	s, err := bank.OpenService(dir, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func checkBalance(t *testing.T, s *bank.Service, name string, want int) {
+	t.Helper()
+	if got, err := s.Ledger().Balance(name); err != nil || got != want {
+		t.Errorf("Balance(%s) = %d, %v; want %d", name, got, err, want)
+	}
+}
+
+// 关闭后重新打开（相当于杀死进程再重启），状态由日志恢复
+func TestServiceRestart(t *testing.T) {
+	dir := t.TempDir()
+	s := openService(t, dir, bank.ServiceOptions{})
+	s.Open("alice", 0, "")
+	s.Open("bob", 50, "")
+	s.Deposit("alice", 100, "")
+	s.Transfer("alice", "bob", 30, "")
+	if err := s.Withdraw("bob", 100, ""); err != bank.ErrInsufficientFunds {
+		t.Fatalf("Withdraw = %v, want ErrInsufficientFunds", err)
+	}
+	before, _ := s.Ledger().History("alice")
+	s.Close()
+	if err := s.Deposit("alice", 1, ""); err != bank.ErrClosed {
+		t.Errorf("Deposit after Close = %v, want ErrClosed", err)
+	}
+
+	s = openService(t, dir, bank.ServiceOptions{})
+	defer s.Close()
+	checkBalance(t, s, "alice", 70)
+	checkBalance(t, s, "bob", 30)
+	after, _ := s.Ledger().History("alice")
+	if len(after) != len(before) {
+		t.Fatalf("History after restart has %d transactions, want %d", len(after), len(before))
+	}
+	for i := range after {
+		if !after[i].Time.Equal(before[i].Time) {
+			t.Errorf("transaction %d: Time = %v, want %v", i, after[i].Time, before[i].Time)
+		}
+	}
+}
+
+// 写到一半时崩溃：日志末尾不完整的一行被截掉，之后的写入不受影响
+func TestServiceTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	s := openService(t, dir, bank.ServiceOptions{})
+	s.Open("alice", 0, "")
+	s.Deposit("alice", 100, "")
+	s.Close()
+
+	f, err := os.OpenFile(filepath.Join(dir, "wal.log"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`1a2b3c4d {"seq":3,"op":"depo`)
+	f.Close()
+
+	s = openService(t, dir, bank.ServiceOptions{})
+	checkBalance(t, s, "alice", 100)
+	if err := s.Deposit("alice", 5, ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = openService(t, dir, bank.ServiceOptions{})
+	defer s.Close()
+	checkBalance(t, s, "alice", 105)
+}
+
+// fsync 失败的修改没有被确认：它被从日志中移除，重启后不会被执行，下一个修改也不会重用它的序号
+func TestServiceSyncFailure(t *testing.T) {
+	dir := t.TempDir()
+	s := openService(t, dir, bank.ServiceOptions{})
+	s.Open("alice", 0, "")
+	s.Deposit("alice", 100, "")
+	bank.FailLog(s, true, false)
+	if err := s.Deposit("alice", 50, ""); err != bank.ErrInjected {
+		t.Fatalf("Deposit with failing Sync: got %v, want %v", err, bank.ErrInjected)
+	}
+	checkBalance(t, s, "alice", 100)
+	if err := s.Deposit("alice", 7, ""); err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+
+	s = openService(t, dir, bank.ServiceOptions{})
+	defer s.Close()
+	checkBalance(t, s, "alice", 107)
+	if txs := s.Ledger().Journal(); len(txs) != 2 {
+		t.Errorf("Journal has %d transactions, want 2", len(txs))
+	}
+
+	// 日志也无法截回时，不确定日志中有什么，之后的修改都被拒绝
+	bank.FailLog(s, true, true)
+	if err := s.Deposit("alice", 50, ""); err != bank.ErrInjected {
+		t.Fatalf("Deposit with failing Sync: got %v, want %v", err, bank.ErrInjected)
+	}
+	if err := s.Deposit("alice", 1, ""); err == nil {
+		t.Error("Deposit after failed rollback succeeded")
+	}
+	checkBalance(t, s, "alice", 107)
+}
+
+// 自动快照失败时，触发它的修改仍然返回自己的结果，错误由 SnapshotErr 报告
+func TestServiceSnapshotFailure(t *testing.T) {
+	dir := t.TempDir()
+	s := openService(t, dir, bank.ServiceOptions{SnapshotEvery: 1})
+	s.Open("alice", 0, "")
+	bank.FailLog(s, false, true) // 快照之后清空日志时失败
+	if err := s.Deposit("alice", 100, ""); err != nil {
+		t.Fatalf("Deposit: %v, want nil", err)
+	}
+	if err := s.SnapshotErr(); err != bank.ErrInjected {
+		t.Errorf("SnapshotErr() = %v, want %v", err, bank.ErrInjected)
+	}
+	if err := s.Withdraw("alice", 200, ""); err != bank.ErrInsufficientFunds {
+		t.Errorf("Withdraw: %v, want %v", err, bank.ErrInsufficientFunds)
+	}
+	if err := s.SnapshotErr(); err != nil {
+		t.Errorf("SnapshotErr() after a successful snapshot = %v", err)
+	}
+	s.Close()
+
+	s = openService(t, dir, bank.ServiceOptions{})
+	defer s.Close()
+	checkBalance(t, s, "alice", 100)
+}
+
+// 快照之后日志被清空，恢复时先读快照再重放之后的日志
+func TestServiceSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	s := openService(t, dir, bank.ServiceOptions{SnapshotEvery: 3})
+	s.Open("alice", 0, "")
+	s.Deposit("alice", 100, "d1")
+	s.Withdraw("alice", 10, "") // 第 3 条，触发快照
+	if fi, err := os.Stat(filepath.Join(dir, "wal.log")); err != nil || fi.Size() != 0 {
+		t.Fatalf("wal.log after snapshot: %v, %v; want empty", fi, err)
+	}
+	s.Withdraw("alice", 20, "")
+	s.Close()
+
+	s = openService(t, dir, bank.ServiceOptions{})
+	defer s.Close()
+	checkBalance(t, s, "alice", 70)
+	if txs := s.Ledger().Journal(); len(txs) != 3 {
+		t.Errorf("Journal has %d transactions, want 3", len(txs))
+	}
+	// 幂等键的结果也保存在快照中
+	if err := s.Deposit("alice", 100, "d1"); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, s, "alice", 70)
+}
+
+// 客户端重试时使用相同的幂等键，修改只执行一次，重启后也一样
+func TestServiceIdempotency(t *testing.T) {
+	dir := t.TempDir()
+	s := openService(t, dir, bank.ServiceOptions{})
+	s.Open("alice", 0, "")
+	for i := 0; i < 3; i++ {
+		if err := s.Deposit("alice", 100, "req-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 失败的结果同样被记住
+	for i := 0; i < 2; i++ {
+		if err := s.Withdraw("alice", 500, "req-2"); err != bank.ErrInsufficientFunds {
+			t.Fatalf("Withdraw = %v, want ErrInsufficientFunds", err)
+		}
+	}
+	checkBalance(t, s, "alice", 100)
+	s.Close()
+
+	s = openService(t, dir, bank.ServiceOptions{})
+	defer s.Close()
+	if err := s.Deposit("alice", 100, "req-1"); err != nil {
+		t.Fatal(err)
+	}
+	checkBalance(t, s, "alice", 100)
+}
+
+func TestServiceTCP(t *testing.T) {
+	dir := t.TempDir()
+	serve := func() (*bank.Service, net.Listener, chan error) {
+		s := openService(t, dir, bank.ServiceOptions{})
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error)
+		go func() { done <- s.Serve(l) }()
+		return s, l, done
+	}
+
+	s, l, done := serve()
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := bufio.NewReader(conn)
+	send := func(line string) string {
+		fmt.Fprintln(conn, line)
+		reply, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatalf("%s: %v", line, err)
+		}
+		return strings.TrimSpace(reply)
+	}
+	for _, test := range []struct{ line, want string }{
+		{"OPEN alice", "OK"},
+		{"OPEN bob 10", "OK"},
+		{"DEPOSIT alice 100 @r1", "OK"},
+		{"DEPOSIT alice 100 @r1", "OK"}, // 重试
+		{"TRANSFER alice bob 30", "OK"},
+		{"WITHDRAW bob 50", "ERR " + bank.ErrInsufficientFunds.Error()},
+		{"BALANCE alice", "OK 70"},
+		{"BALANCE carol", "ERR " + bank.ErrNoAccount.Error()},
+		{"DEPOSIT alice", "ERR usage: DEPOSIT name amount [@key]"},
+		{"DEPOSIT alice 1e3", "ERR usage: DEPOSIT name amount [@key]"},
+		{"OPEN carol xyz", "ERR usage: OPEN name [overdraft] [@key]"},
+		{"TRANSFER alice bob 3x", "ERR usage: TRANSFER from to amount [@key]"},
+		{"FOO", `ERR unknown command "FOO"`},
+	} {
+		if got := send(test.line); got != test.want {
+			t.Errorf("%s: got %q, want %q", test.line, got, test.want)
+		}
+	}
+	if got := send("HISTORY bob"); got != "OK 1" {
+		t.Fatalf("HISTORY bob: got %q, want %q", got, "OK 1")
+	}
+	if line, _ := r.ReadString('\n'); !strings.HasSuffix(line, "transfer alice bob 30\n") {
+		t.Errorf("HISTORY bob: got %q", line)
+	}
+
+	// 杀死服务器：关闭监听器后 Serve 会关闭所有连接
+	l.Close()
+	<-done
+	s.Close()
+	if _, err := r.ReadString('\n'); err == nil {
+		t.Error("connection still open after Serve returned")
+	}
+
+	s, l, done = serve()
+	defer func() { l.Close(); <-done; s.Close() }()
+	conn, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r = bufio.NewReader(conn)
+	if got := send("DEPOSIT alice 100 @r1"); got != "OK" {
+		t.Errorf("retry after restart: got %q", got)
+	}
+	if got := send("BALANCE alice"); got != "OK 70" {
+		t.Errorf("BALANCE alice after restart: got %q, want %q", got, "OK 70")
+	}
+}
+
+func TestServiceHTTP(t *testing.T) {
+	s := openService(t, t.TempDir(), bank.ServiceOptions{})
+	defer s.Close()
+	srv := httptest.NewServer(s.Handler())
+	defer srv.Close()
+
+	post := func(path, key, body string) (int, string) {
+		req, _ := http.NewRequest("POST", srv.URL+path, strings.NewReader(body))
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := ioutil.ReadAll(resp.Body)
+		return resp.StatusCode, strings.TrimSpace(string(b))
+	}
+	for _, test := range []struct {
+		path, key, body string
+		code            int
+	}{
+		{"/open", "", `{"account":"alice"}`, 200},
+		{"/open", "", `{"account":"alice"}`, 409},
+		{"/open", "", `{"account":"bob","overdraft":10}`, 200},
+		{"/deposit", "k1", `{"account":"alice","amount":100}`, 200},
+		{"/deposit", "k1", `{"account":"alice","amount":100}`, 200}, // 重试
+		{"/transfer", "", `{"account":"alice","to":"bob","amount":30}`, 200},
+		{"/withdraw", "", `{"account":"bob","amount":50}`, 409},
+		{"/withdraw", "", `{"account":"carol","amount":1}`, 404},
+		{"/deposit", "", `{"account":"alice","amount":-1}`, 400},
+		{"/deposit", "", `not json`, 400},
+	} {
+		if code, body := post(test.path, test.key, test.body); code != test.code {
+			t.Errorf("POST %s %s: %d %s, want %d", test.path, test.body, code, body, test.code)
+		}
+	}
+
+	resp, err := http.Get(srv.URL + "/balance?account=alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var balance struct {
+		Account string
+		Balance int
+	}
+	json.NewDecoder(resp.Body).Decode(&balance)
+	resp.Body.Close()
+	if balance.Balance != 70 {
+		t.Errorf("GET /balance: %+v, want 70", balance)
+	}
+
+	resp, err = http.Get(srv.URL + "/history?account=bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var txs []bank.Transaction
+	json.NewDecoder(resp.Body).Decode(&txs)
+	resp.Body.Close()
+	if len(txs) != 1 || txs[0].Kind != bank.Transfer || txs[0].Amount != 30 {
+		t.Errorf("GET /history: %+v", txs)
+	}
+}
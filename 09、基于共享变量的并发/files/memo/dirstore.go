@@ -0,0 +1,81 @@
+package memo
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// DirStore 把每个结果保存为目录中的一个文件，文件名是 key 的 SHA-256
+// 写入时先写临时文件再重命名，所以崩溃时不会留下写了一半的记录
+type DirStore struct {
+	dir   string
+	codec Codec
+}
+
+// OpenDir 返回保存在 dir 中的 Store，dir 不存在时会被创建
+// codec 为 nil 时使用 GobCodec
+func OpenDir(dir string, codec Codec) (*DirStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	return &DirStore{dir: dir, codec: codec}, nil
+}
+
+func (s *DirStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// Load 读取 key 的记录，没有通过校验的文件被视为不存在并被删除
+func (s *DirStore) Load(key string) (Record, bool, error) {
+	f, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return Record{}, false, nil
+	} else if err != nil {
+		return Record{}, false, err
+	}
+	defer f.Close()
+	data, err := readRecord(f)
+	if err == nil {
+		var rec Record
+		if rec, err = decodeRecord(s.codec, data); err == nil && rec.Key == key {
+			return rec, true, nil
+		}
+	}
+	if err == ErrCorrupt {
+		os.Remove(f.Name())
+		return Record{}, false, nil
+	}
+	return Record{}, false, err // SHA-256 冲突时 err 为 nil
+}
+
+// Save 保存 rec，覆盖之前的记录
+func (s *DirStore) Save(rec Record) error {
+	b, err := encodeRecord(s.codec, rec)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(s.dir, ".tmp-")
+	if err != nil {
+		return err
+	}
+	if _, err = tmp.Write(b); err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), s.path(rec.Key))
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
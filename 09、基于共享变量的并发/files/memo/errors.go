@@ -0,0 +1,88 @@
+package memo
+
+import (
+	"context"
+	"time"
+)
+
+// ErrorMode 决定暂时性错误是否被缓存
+type ErrorMode int
+
+const (
+	CacheErrors   ErrorMode = iota // 和成功的结果一样缓存，与 memo4 相同
+	NoCacheErrors                  // 不缓存，之后的请求会重新调用 f
+	NegativeTTL                    // 只缓存 ErrorPolicy.TTL 这么长时间
+)
+
+// ErrorPolicy 配置 f 返回错误时的处理方式
+// 只有暂时性的错误才会被重试，并按照 Mode 缓存，其他错误总是和成功的结果一样缓存
+type ErrorPolicy struct {
+	Mode ErrorMode
+	TTL  time.Duration // Mode 为 NegativeTTL 时错误的有效期
+
+	// Retries 是对暂时性错误最多重试的次数，重试都失败后才按照 Mode 处理最后一个错误
+	// 第 n 次重试前等待 Backoff * 2^(n-1)，最多等待 MaxBackoff，
+	// 然后再随机减去其中不超过 Jitter（0 到 1 之间）的比例，以免大量请求同时重试
+	Retries    int
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	Jitter     float64
+
+	// IsTransient 判断一个错误是否是暂时性的，为 nil 时所有错误都是暂时性的
+	IsTransient func(error) bool
+}
+
+func (p *ErrorPolicy) transient(err error) bool {
+	return p.IsTransient == nil || p.IsTransient(err)
+}
+
+// cache 返回暂时性错误的有效期以及是否缓存它，有效期为 0 表示不过期
+func (p *ErrorPolicy) cache() (ttl time.Duration, keep bool) {
+	switch p.Mode {
+	case NoCacheErrors:
+		return 0, false
+	case NegativeTTL:
+		return p.TTL, true
+	}
+	return 0, true
+}
+
+func (p *ErrorPolicy) ttl() time.Duration {
+	if p.Mode == NegativeTTL {
+		return p.TTL
+	}
+	return 0
+}
+
+// backoff 返回第 n 次重试前等待的时间，r 是 [0, 1) 之间的随机数
+func (p *ErrorPolicy) backoff(n int, r float64) time.Duration {
+	d := p.Backoff
+	for i := 1; i < n && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d - time.Duration(float64(d)*p.Jitter*r)
+}
+
+// load 调用 f，遇到暂时性错误时按照 ErrorPolicy 退避并重试
+// 等待重试时 ctx 被取消，则返回最后一个错误
+func (memo *Memo) load(ctx context.Context, key string) result {
+	p := &memo.opts.Errors
+	var res result
+	for n := 0; ; n++ {
+		res.value, res.err = memo.f(ctx, key)
+		if res.err == nil || n >= p.Retries || !p.transient(res.err) {
+			return res
+		}
+		select {
+		case <-memo.clock.After(p.backoff(n+1, memo.rand())):
+		case <-ctx.Done():
+			return res
+		}
+		memo.mu.Lock()
+		memo.stats.Retries++
+		memo.mu.Unlock()
+	}
+}
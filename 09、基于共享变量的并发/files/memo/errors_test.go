@@ -0,0 +1,255 @@
+package memo
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock 只在 Advance 时前进，After 请求的时长会发送到 sleeps
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []fakeTimer
+	sleeps chan time.Duration
+}
+
+type fakeTimer struct {
+	when time.Time
+	c    chan time.Time
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Unix(0, 0), sleeps: make(chan time.Duration, 100)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	ch := make(chan time.Time, 1)
+	c.timers = append(c.timers, fakeTimer{c.now.Add(d), ch})
+	c.sleeps <- d
+	return ch
+}
+
+// Advance 让时间前进 d，并触发到期的定时器
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	pending := c.timers[:0]
+	for _, t := range c.timers {
+		if t.when.After(c.now) {
+			pending = append(pending, t)
+		} else {
+			t.c <- c.now
+		}
+	}
+	c.timers = pending
+}
+
+// sleep 等待下一次 After 调用并返回请求的时长
+func (c *fakeClock) sleep(t *testing.T) time.Duration {
+	t.Helper()
+	select {
+	case d := <-c.sleeps:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for a retry")
+		return 0
+	}
+}
+
+var (
+	errTransient = errors.New("transient")
+	errPermanent = errors.New("permanent")
+)
+
+// flaky 前 failures 次调用返回 err，之后返回 key
+type flaky struct {
+	mu       sync.Mutex
+	calls    int
+	failures int
+	err      error
+}
+
+func (f *flaky) f(ctx context.Context, key string) (interface{}, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if f.calls <= f.failures {
+		return nil, f.err
+	}
+	return key, nil
+}
+
+func (f *flaky) count() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func isTransient(err error) bool { return errors.Is(err, errTransient) }
+
+func TestCacheErrors(t *testing.T) {
+	f := &flaky{failures: 1, err: errTransient}
+	m := New(f.f)
+	for i := 0; i < 2; i++ {
+		if _, err := m.Get("k"); err != errTransient {
+			t.Fatalf("Get #%d: err = %v, want %v", i, err, errTransient)
+		}
+	}
+	if f.count() != 1 {
+		t.Errorf("f called %d times, want 1", f.count())
+	}
+}
+
+func TestNoCacheErrors(t *testing.T) {
+	f := &flaky{failures: 1, err: errTransient}
+	m := NewWithOptions(f.f, Options{Errors: ErrorPolicy{Mode: NoCacheErrors}})
+	if _, err := m.Get("k"); err != errTransient {
+		t.Fatalf("first Get: err = %v, want %v", err, errTransient)
+	}
+	get(t, m, "k", "k")
+	if f.count() != 2 {
+		t.Errorf("f called %d times, want 2", f.count())
+	}
+	if s := m.Stats(); s.Entries != 1 {
+		t.Errorf("Entries = %d, want 1", s.Entries)
+	}
+}
+
+func TestPermanentErrorsAreCached(t *testing.T) {
+	f := &flaky{failures: 1, err: errPermanent}
+	m := NewWithOptions(f.f, Options{Errors: ErrorPolicy{
+		Mode: NoCacheErrors, Retries: 3, Backoff: time.Second, IsTransient: isTransient,
+	}})
+	for i := 0; i < 2; i++ {
+		if _, err := m.Get("k"); err != errPermanent {
+			t.Fatalf("Get #%d: err = %v, want %v", i, err, errPermanent)
+		}
+	}
+	if f.count() != 1 {
+		t.Errorf("f called %d times, want 1", f.count())
+	}
+}
+
+func TestNegativeTTL(t *testing.T) {
+	f := &flaky{failures: 1, err: errTransient}
+	clock := newFakeClock()
+	m := NewWithOptions(f.f, Options{
+		Clock:          clock,
+		ExpiryInterval: time.Hour,
+		Errors:         ErrorPolicy{Mode: NegativeTTL, TTL: 10 * time.Second, IsTransient: isTransient},
+	})
+	defer m.Close()
+
+	if _, err := m.Get("k"); err != errTransient {
+		t.Fatalf("first Get: err = %v, want %v", err, errTransient)
+	}
+	clock.Advance(9 * time.Second)
+	if _, err := m.Get("k"); err != errTransient {
+		t.Fatalf("Get within negative TTL: err = %v, want cached %v", err, errTransient)
+	}
+	clock.Advance(time.Second)
+	get(t, m, "k")
+	// 成功的结果不受错误的 TTL 影响
+	clock.Advance(time.Hour)
+	get(t, m, "k")
+	if f.count() != 2 {
+		t.Errorf("f called %d times, want 2", f.count())
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	f := &flaky{failures: 3, err: errTransient}
+	clock := newFakeClock()
+	m := NewWithOptions(f.f, Options{Clock: clock, Errors: ErrorPolicy{
+		Retries: 5, Backoff: 100 * time.Millisecond, MaxBackoff: 300 * time.Millisecond,
+		Jitter: 0.5, IsTransient: isTransient,
+	}})
+	m.rand = func() float64 { return 0.5 }
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.Get("k")
+		done <- err
+	}()
+	// 退避时间为 100ms、200ms、300ms（上限），各减去 25% 的抖动
+	for _, want := range []time.Duration{75, 150, 225} {
+		want *= time.Millisecond
+		if got := clock.sleep(t); got != want {
+			t.Errorf("backoff = %v, want %v", got, want)
+		}
+		clock.Advance(want)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("Get after retries: %v", err)
+	}
+	if s := m.Stats(); s.Retries != 3 || s.Loads != 1 {
+		t.Errorf("Retries = %d, Loads = %d, want 3, 1", s.Retries, s.Loads)
+	}
+}
+
+func TestRetriesExhausted(t *testing.T) {
+	f := &flaky{failures: 10, err: errTransient}
+	clock := newFakeClock()
+	m := NewWithOptions(f.f, Options{Clock: clock, Errors: ErrorPolicy{
+		Mode: NoCacheErrors, Retries: 2, Backoff: time.Second,
+	}})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.Get("k")
+		done <- err
+	}()
+	for i := 0; i < 2; i++ {
+		clock.Advance(clock.sleep(t))
+	}
+	if err := <-done; err != errTransient {
+		t.Fatalf("Get: err = %v, want %v", err, errTransient)
+	}
+	if f.count() != 3 {
+		t.Errorf("f called %d times, want 3", f.count())
+	}
+	if s := m.Stats(); s.Entries != 0 {
+		t.Errorf("Entries = %d, want 0", s.Entries)
+	}
+}
+
+// 所有等待者都放弃时，退避中的重试会立即结束
+func TestRetryCanceled(t *testing.T) {
+	f := &flaky{failures: 10, err: errTransient}
+	clock := newFakeClock()
+	m := NewWithOptions(f.f, Options{Clock: clock, Errors: ErrorPolicy{Retries: 5, Backoff: time.Hour}})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := m.GetContext(ctx, "k")
+		done <- err
+	}()
+	clock.sleep(t)
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("GetContext: err = %v, want context.Canceled", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().Loads != 1 {
+		if time.Now().After(deadline) {
+			t.Fatal("retry loop did not stop after cancel")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if f.count() != 1 {
+		t.Errorf("f called %d times, want 1", f.count())
+	}
+}
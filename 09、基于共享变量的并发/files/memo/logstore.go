@@ -0,0 +1,205 @@
+package memo
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogStore 把结果追加到一个日志文件中，内存中只保存每个 key 最新记录的位置，值在未命中时才从文件读取
+// 打开日志时，从第一条没有通过校验的记录开始的内容会被截掉，它们是写到一半时崩溃留下的
+// 同一个 key 的旧记录和过期的记录会在 Compact 时被丢弃；
+// 作为 Memo 的 Store 时，是否过期按 Memo 的 Clock 判断，与 Memo 读取记录时相同
+type LogStore struct {
+	mu    sync.Mutex
+	path  string
+	codec Codec
+	clock Clock
+	f     *os.File
+	size  int64 // 日志中有效内容的长度
+	live  int64 // 最新记录的长度之和
+	index map[string]span
+}
+
+// span 是一条记录（包括头部）在日志中的位置
+type span struct {
+	off, n  int64
+	expires time.Time
+}
+
+// autoCompactSize 是自动压缩的最小日志长度，超过它并且一半以上是旧记录时，Save 会压缩日志
+const autoCompactSize = 1 << 20
+
+// OpenLog 打开或创建 path 处的日志，codec 为 nil 时使用 GobCodec
+func OpenLog(path string, codec Codec) (*LogStore, error) {
+	if codec == nil {
+		codec = GobCodec{}
+	}
+	s := &LogStore{path: path, codec: codec, clock: systemClock{}}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// open 打开日志并重建索引，调用方必须持有 mu
+// 失败时 s 保持不变，所以 compact 在打开新日志失败时仍然可以使用旧的文件
+func (s *LogStore) open() error {
+	f, err := os.OpenFile(s.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	t := &LogStore{f: f, index: make(map[string]span)}
+	r := bufio.NewReader(f)
+	for {
+		data, err := readRecord(r)
+		if err == io.EOF || err == ErrCorrupt {
+			break // 截掉损坏的部分
+		} else if err != nil {
+			f.Close()
+			return err
+		}
+		key, expires, _, err := recordKey(data)
+		if err != nil {
+			break
+		}
+		t.add(key, span{t.size, int64(headerSize + len(data)), expires})
+	}
+	if err := f.Truncate(t.size); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Seek(t.size, io.SeekStart); err != nil {
+		f.Close()
+		return err
+	}
+	s.f, s.size, s.live, s.index = t.f, t.size, t.live, t.index
+	return nil
+}
+
+// setClock 使 Compact 按 c 判断记录是否过期，NewWithOptions 用 Memo 的 Clock 调用它
+func (s *LogStore) setClock(c Clock) {
+	s.mu.Lock()
+	s.clock = c
+	s.mu.Unlock()
+}
+
+// add 把一条新追加的记录加入索引
+func (s *LogStore) add(key string, sp span) {
+	if old, ok := s.index[key]; ok {
+		s.live -= old.n
+	}
+	s.index[key] = sp
+	s.live += sp.n
+	s.size = sp.off + sp.n
+}
+
+// Load 从日志中读取 key 的最新记录
+func (s *LogStore) Load(key string) (Record, bool, error) {
+	s.mu.Lock()
+	sp, ok := s.index[key]
+	if !ok {
+		s.mu.Unlock()
+		return Record{}, false, nil
+	}
+	// 持有锁以免 Compact 同时替换文件
+	data, err := readRecord(io.NewSectionReader(s.f, sp.off, sp.n))
+	s.mu.Unlock()
+	if err != nil {
+		return Record{}, false, err
+	}
+	rec, err := decodeRecord(s.codec, data)
+	if err != nil {
+		return Record{}, false, err
+	}
+	return rec, rec.Key == key, nil
+}
+
+// Save 把 rec 追加到日志中
+func (s *LogStore) Save(rec Record) error {
+	b, err := encodeRecord(s.codec, rec)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.f.Write(b); err != nil {
+		// 截掉可能写了一半的记录
+		s.f.Truncate(s.size)
+		s.f.Seek(s.size, io.SeekStart)
+		return err
+	}
+	s.add(rec.Key, span{s.size, int64(len(b)), rec.Expires})
+	if s.size > autoCompactSize && s.live < s.size/2 {
+		return s.compact()
+	}
+	return nil
+}
+
+// Compact 把每个 key 未过期的最新记录写入新的日志，然后替换旧的日志
+func (s *LogStore) Compact() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.compact()
+}
+
+func (s *LogStore) compact() error {
+	tmp, err := os.Create(s.path + ".compact")
+	if err != nil {
+		return err
+	}
+	now := s.clock.Now()
+	w := bufio.NewWriter(tmp)
+	for _, sp := range s.index {
+		if !sp.expires.IsZero() && !now.Before(sp.expires) {
+			continue
+		}
+		if _, err = io.Copy(w, io.NewSectionReader(s.f, sp.off, sp.n)); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		// 重命名是原子的，崩溃时要么是旧日志，要么是新日志
+		err = os.Rename(tmp.Name(), s.path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	// 先打开新日志再关闭旧的：打开失败时旧的文件仍然可用，之后的 Save 和 Load 不会失败
+	old := s.f
+	if err := s.open(); err != nil {
+		return err
+	}
+	old.Close()
+	return nil
+}
+
+// Size 返回日志的长度
+func (s *LogStore) Size() int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.size
+}
+
+// Close 把日志同步到磁盘并关闭它
+func (s *LogStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	err := s.f.Sync()
+	if cerr := s.f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
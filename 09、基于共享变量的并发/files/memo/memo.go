@@ -0,0 +1,358 @@
+// Package memo 提供并发安全、可以限制大小的缓存
+// 它在 memo4 的基础上增加了容量限制（LRU 或 LFU 淘汰）、TTL 过期和统计信息
+// 对相同 key 的并发请求仍然通过 entry 的 ready channel 去重，计算中的 entry 不会被淘汰
+package memo
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// Func 是要缓存的类型，它应当在 ctx 被取消时尽快返回
+type Func func(ctx context.Context, key string) (interface{}, error)
+
+// Policy 是缓存满时选择淘汰对象的策略
+type Policy int
+
+const (
+	LRU Policy = iota // 淘汰最久未使用的
+	LFU               // 淘汰使用次数最少的，次数相同时淘汰最久未使用的
+)
+
+// Options 配置 Memo 的容量和过期策略，零值表示不做任何限制
+type Options struct {
+	MaxEntries int   // 最多缓存的结果数
+	MaxBytes   int64 // 所有结果的大小之和的上限，大小由 Sizer 计算
+	// Sizer 返回一个结果的大小，为 nil 时使用 key 与 []byte 或 string 类型的值的长度之和
+	Sizer  func(key string, value interface{}) int64
+	TTL    time.Duration // 结果的有效期
+	Policy Policy
+	// ExpiryInterval 是后台清理过期结果的间隔，默认为 TTL 和 Errors.TTL 中较小的一个
+	ExpiryInterval time.Duration
+	Errors         ErrorPolicy // f 返回错误时的处理方式
+	// Clock 是时间的来源，为 nil 时使用系统时间
+	Clock Clock
+	// Store 是可选的第二层缓存，例如 OpenDir 或 OpenLog 返回的磁盘存储
+	Store Store
+}
+
+// Clock 提供当前时间和定时器，测试时可以用假的时钟代替
+type Clock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+// Stats 是 Memo 的统计信息
+type Stats struct {
+	Hits        int64         // 命中已完成的结果
+	Misses      int64         // 需要调用 f
+	Dedups      int64         // 等待正在进行中的同一个 key 的调用
+	Evictions   int64         // 因容量限制被淘汰的结果
+	Expirations int64         // 因 TTL 过期被删除的结果
+	Loads       int64         // f 完成的次数，不包括重试
+	Retries     int64         // 因暂时性错误重新调用 f 的次数
+	StoreHits   int64         // 从 Store 得到的结果
+	StoreErrors int64         // 读写 Store 失败的次数
+	LoadTime    time.Duration // f 的总耗时
+	Entries     int           // 当前缓存的结果数
+	Bytes       int64         // 当前缓存的结果大小之和
+}
+
+// MeanLoadTime 返回 f 的平均耗时
+func (s Stats) MeanLoadTime() time.Duration {
+	if s.Loads == 0 {
+		return 0
+	}
+	return s.LoadTime / time.Duration(s.Loads)
+}
+
+// Memo 会缓存 Func 的结果
+type Memo struct {
+	f     Func
+	opts  Options
+	clock Clock
+	rand  func() float64 // 用于退避的随机抖动
+	mu    sync.Mutex
+	cache map[string]*entry
+	evict policy // 只包含已完成的 entry
+	stats Stats
+	uses  int64         // 访问序号，由 mu 守护
+	done  chan struct{} // Close 后关闭
+	once  sync.Once
+}
+
+type result struct {
+	value interface{}
+	err   error
+}
+
+type entry struct {
+	key     string
+	res     result
+	ready   chan struct{}      // ready 后关闭
+	cancel  context.CancelFunc // 取消 f 的调用
+	waiters int                // 正在等待 ready 的请求数，由 mu 守护
+
+	// 以下字段在 entry 完成后才有意义，由 mu 守护
+	size     int64
+	expires  time.Time
+	uses     int64
+	lastUsed int64 // 单调递增的访问序号
+	index    int   // 在 policy 中的位置
+}
+
+// New 返回 f 的缓存，不限制大小
+func New(f Func) *Memo {
+	return NewWithOptions(f, Options{})
+}
+
+// NewWithOptions 返回按照 opts 限制大小的 f 的缓存
+// 设置了 TTL 或 Errors.TTL 时，客户端必须随后调用 Close 以停止后台清理
+func NewWithOptions(f Func, opts Options) *Memo {
+	if opts.Sizer == nil {
+		opts.Sizer = defaultSizer
+	}
+	if opts.Clock == nil {
+		opts.Clock = systemClock{}
+	}
+	if s, ok := opts.Store.(interface{ setClock(Clock) }); ok {
+		s.setClock(opts.Clock) // Store 判断过期的时间与 fetch 相同
+	}
+	memo := &Memo{
+		f:     f,
+		opts:  opts,
+		clock: opts.Clock,
+		rand:  rand.Float64,
+		cache: make(map[string]*entry),
+		done:  make(chan struct{}),
+	}
+	if opts.Policy == LFU {
+		memo.evict = newLFU()
+	} else {
+		memo.evict = newLRU()
+	}
+	if interval := opts.expiryInterval(); interval > 0 {
+		go memo.expirer(interval)
+	}
+	return memo
+}
+
+// expiryInterval 返回后台清理的间隔，不需要清理时返回 0
+func (o *Options) expiryInterval() time.Duration {
+	var interval time.Duration
+	for _, ttl := range []time.Duration{o.TTL, o.Errors.ttl()} {
+		if ttl > 0 && (interval == 0 || ttl < interval) {
+			interval = ttl
+		}
+	}
+	if interval > 0 && o.ExpiryInterval > 0 {
+		interval = o.ExpiryInterval
+	}
+	return interval
+}
+
+func defaultSizer(key string, value interface{}) int64 {
+	switch v := value.(type) {
+	case []byte:
+		return int64(len(key) + len(v))
+	case string:
+		return int64(len(key) + len(v))
+	}
+	return int64(len(key))
+}
+
+// Get 是线程安全的
+func (memo *Memo) Get(key string) (interface{}, error) {
+	return memo.GetContext(context.Background(), key)
+}
+
+// GetContext 和 Get 相同，但可以在 ctx 被取消时放弃等待并返回 ctx.Err()
+// 如果 key 的所有等待者都放弃了，f 的调用会被取消，并且 entry 会被删除
+func (memo *Memo) GetContext(ctx context.Context, key string) (interface{}, error) {
+	memo.mu.Lock()
+	e := memo.cache[key]
+	if e != nil && e.isReady() && memo.expired(e) {
+		memo.remove(e)
+		memo.stats.Expirations++
+		e = nil
+	}
+	switch {
+	case e == nil:
+		// 对 key 的首次请求
+		memo.stats.Misses++
+		fctx, cancel := context.WithCancel(context.Background())
+		e = &entry{key: key, ready: make(chan struct{}), cancel: cancel, index: -1}
+		memo.cache[key] = e
+		go memo.call(fctx, e)
+	case e.isReady():
+		memo.stats.Hits++
+		memo.touch(e)
+	default:
+		memo.stats.Dedups++
+	}
+	e.waiters++
+	memo.mu.Unlock()
+
+	select {
+	case <-e.ready: // 等待 ready 状态
+		return e.res.value, e.res.err
+	case <-ctx.Done():
+		memo.mu.Lock()
+		e.waiters--
+		if e.waiters == 0 && !e.isReady() {
+			// 最后一个等待者放弃了，取消计算以免结果被缓存
+			e.cancel()
+			if memo.cache[e.key] == e {
+				delete(memo.cache, e.key)
+			}
+		}
+		memo.mu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// call 从 Store 或 f 得到结果，把完成的 entry 交给淘汰策略管理，然后广播 ready 状态
+// 新的结果会在广播之前写入 Store，所以 Get 返回后结果就已经保存了
+func (memo *Memo) call(ctx context.Context, e *entry) {
+	start := memo.clock.Now()
+	res, expires, stored := memo.fetch(ctx, e.key)
+	e.res = res
+	e.cancel() // 释放 context 的资源
+
+	memo.mu.Lock()
+	now := memo.clock.Now()
+	if !stored {
+		memo.stats.Loads++
+		memo.stats.LoadTime += now.Sub(start)
+	}
+	ttl, keep := memo.opts.TTL, true
+	if e.res.err != nil && memo.opts.Errors.transient(e.res.err) {
+		ttl, keep = memo.opts.Errors.cache()
+	}
+	if !stored && ttl > 0 {
+		// 即使 entry 已经被删除（所有等待者都放弃了，或者 key 被删除），
+		// 写入 Store 的结果也要按 TTL 过期
+		expires = now.Add(ttl)
+	}
+	if !keep && memo.cache[e.key] == e {
+		// 不缓存这个错误，等待者仍然会得到它
+		delete(memo.cache, e.key)
+	}
+	if memo.cache[e.key] == e { // 没有因为取消而被删除
+		if e.res.err == nil {
+			e.size = memo.opts.Sizer(e.key, e.res.value)
+		} else {
+			e.size = int64(len(e.key))
+		}
+		e.expires = expires
+		memo.stats.Entries++
+		memo.stats.Bytes += e.size
+		memo.touch(e)
+		memo.evict.add(e)
+		memo.shrink()
+	}
+	memo.mu.Unlock()
+
+	if !stored {
+		memo.save(e, expires)
+	}
+	close(e.ready) // 广播 ready 状态
+}
+
+// touch 记录一次对 e 的访问，调用方必须持有 mu
+func (memo *Memo) touch(e *entry) {
+	e.uses++
+	memo.uses++
+	e.lastUsed = memo.uses
+	if e.index >= 0 {
+		memo.evict.touch(e)
+	}
+}
+
+// shrink 淘汰结果直到满足容量限制，调用方必须持有 mu
+func (memo *Memo) shrink() {
+	for memo.overLimit() {
+		e := memo.evict.victim()
+		if e == nil {
+			return
+		}
+		memo.remove(e)
+		memo.stats.Evictions++
+	}
+}
+
+func (memo *Memo) overLimit() bool {
+	o := memo.opts
+	return (o.MaxEntries > 0 && memo.stats.Entries > o.MaxEntries) ||
+		(o.MaxBytes > 0 && memo.stats.Bytes > o.MaxBytes)
+}
+
+// remove 删除一个已完成的 entry，调用方必须持有 mu
+func (memo *Memo) remove(e *entry) {
+	if memo.cache[e.key] == e {
+		delete(memo.cache, e.key)
+	}
+	if e.index >= 0 {
+		memo.evict.remove(e)
+		memo.stats.Entries--
+		memo.stats.Bytes -= e.size
+	}
+}
+
+func (memo *Memo) expired(e *entry) bool {
+	return !e.expires.IsZero() && !memo.clock.Now().Before(e.expires)
+}
+
+// expirer 定期删除过期的结果，直到 Close 被调用
+func (memo *Memo) expirer(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			memo.Expire()
+		case <-memo.done:
+			return
+		}
+	}
+}
+
+// Expire 立即删除所有过期的结果
+func (memo *Memo) Expire() {
+	memo.mu.Lock()
+	defer memo.mu.Unlock()
+	for _, e := range memo.cache {
+		if e.isReady() && memo.expired(e) {
+			memo.remove(e)
+			memo.stats.Expirations++
+		}
+	}
+}
+
+// Stats 返回统计信息的快照
+func (memo *Memo) Stats() Stats {
+	memo.mu.Lock()
+	defer memo.mu.Unlock()
+	return memo.stats
+}
+
+// Close 停止后台清理，可以多次调用
+func (memo *Memo) Close() {
+	memo.once.Do(func() { close(memo.done) })
+}
+
+func (e *entry) isReady() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
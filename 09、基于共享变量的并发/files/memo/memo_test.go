@@ -0,0 +1,204 @@
+package memo
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gostudy/09、基于共享变量的并发/files/memotest"
+)
+
+// counter 是一个记录调用次数的 Func，返回值是 key 本身
+type counter struct {
+	mu    sync.Mutex
+	calls map[string]int
+	gate  chan struct{} // 不为 nil 时，调用会阻塞到 gate 被关闭
+}
+
+func newCounter() *counter { return &counter{calls: make(map[string]int)} }
+
+func (c *counter) f(ctx context.Context, key string) (interface{}, error) {
+	c.mu.Lock()
+	c.calls[key]++
+	c.mu.Unlock()
+	if c.gate != nil {
+		<-c.gate
+	}
+	return key, nil
+}
+
+func (c *counter) count(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls[key]
+}
+
+func get(t *testing.T, m *Memo, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if v, err := m.Get(key); err != nil || v != key {
+			t.Fatalf("Get(%q) = %v, %v", key, v, err)
+		}
+	}
+}
+
+func TestLRU(t *testing.T) {
+	c := newCounter()
+	m := NewWithOptions(c.f, Options{MaxEntries: 2, Policy: LRU})
+	get(t, m, "a", "b", "a", "c") // c 淘汰最久未使用的 b
+	get(t, m, "a")
+	get(t, m, "b")
+	if got := c.count("a"); got != 1 {
+		t.Errorf("a loaded %d times, want 1", got)
+	}
+	if got := c.count("b"); got != 2 {
+		t.Errorf("b loaded %d times, want 2", got)
+	}
+	s := m.Stats()
+	if s.Entries != 2 || s.Evictions != 2 {
+		t.Errorf("Entries = %d, Evictions = %d, want 2, 2", s.Entries, s.Evictions)
+	}
+}
+
+func TestLFU(t *testing.T) {
+	c := newCounter()
+	m := NewWithOptions(c.f, Options{MaxEntries: 2, Policy: LFU})
+	get(t, m, "a", "a", "a", "b", "b", "c") // c 淘汰使用次数最少的
+	get(t, m, "a")
+	if got := c.count("a"); got != 1 {
+		t.Errorf("a loaded %d times, want 1", got)
+	}
+	// b 和 c 都在时，c 只用过一次，所以被淘汰的是 c 而不是 b
+	c2 := newCounter()
+	m = NewWithOptions(c2.f, Options{MaxEntries: 2, Policy: LFU})
+	get(t, m, "b", "b", "c", "d", "b")
+	if got := c2.count("b"); got != 1 {
+		t.Errorf("b loaded %d times, want 1", got)
+	}
+}
+
+func TestMaxBytes(t *testing.T) {
+	c := newCounter()
+	sizer := func(key string, value interface{}) int64 { return int64(len(value.(string))) }
+	m := NewWithOptions(c.f, Options{MaxBytes: 6, Sizer: sizer})
+	get(t, m, "aaa", "bbb", "cc")
+	if s := m.Stats(); s.Bytes != 5 || s.Entries != 2 || s.Evictions != 1 {
+		t.Errorf("Stats = %+v, want 5 bytes in 2 entries after 1 eviction", s)
+	}
+	// 单个结果超过上限时仍然返回给调用方，但不会被缓存
+	get(t, m, "toolong")
+	get(t, m, "toolong")
+	if got := c.count("toolong"); got != 2 {
+		t.Errorf("oversized value loaded %d times, want 2", got)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	c := newCounter()
+	clock := newFakeClock()
+	m := NewWithOptions(c.f, Options{TTL: time.Minute, ExpiryInterval: time.Hour, Clock: clock})
+	defer m.Close()
+
+	get(t, m, "a", "b")
+	clock.Advance(30 * time.Second)
+	get(t, m, "a") // 未过期，命中
+	clock.Advance(30 * time.Second)
+	get(t, m, "a") // 过期，重新调用 f
+	if got := c.count("a"); got != 2 {
+		t.Errorf("a loaded %d times, want 2", got)
+	}
+
+	m.Expire() // b 也过期了
+	s := m.Stats()
+	if s.Expirations != 2 || s.Entries != 1 {
+		t.Errorf("Expirations = %d, Entries = %d, want 2, 1", s.Expirations, s.Entries)
+	}
+}
+
+func TestBackgroundExpiry(t *testing.T) {
+	c := newCounter()
+	m := NewWithOptions(c.f, Options{TTL: time.Millisecond})
+	defer m.Close()
+	get(t, m, "a")
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Stats().Entries != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expired entry was never removed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// 计算中的 entry 不会被淘汰，对同一个 key 的并发请求只调用一次 f
+func TestDedup(t *testing.T) {
+	c := newCounter()
+	c.gate = make(chan struct{})
+	m := NewWithOptions(c.f, Options{MaxEntries: 1})
+	const n = 10
+	var wg sync.WaitGroup
+	var failed int32
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			key := "slow"
+			if i%2 == 1 {
+				key = fmt.Sprint("fast", i)
+			}
+			if v, err := m.Get(key); err != nil || v != key {
+				atomic.AddInt32(&failed, 1)
+			}
+		}(i)
+	}
+	// 等待所有请求到达，快的 key 也需要 gate
+	for {
+		s := m.Stats()
+		if s.Misses+s.Dedups+s.Hits == n {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(c.gate)
+	wg.Wait()
+
+	if failed != 0 {
+		t.Errorf("%d Gets failed", failed)
+	}
+	if got := c.count("slow"); got != 1 {
+		t.Errorf("slow loaded %d times, want 1", got)
+	}
+	s := m.Stats()
+	if s.Dedups != n/2-1 {
+		t.Errorf("Dedups = %d, want %d", s.Dedups, n/2-1)
+	}
+	if s.Entries != 1 || s.Loads != n/2+1 {
+		t.Errorf("Entries = %d, Loads = %d, want 1, %d", s.Entries, s.Loads, n/2+1)
+	}
+}
+
+func TestLoadTime(t *testing.T) {
+	m := New(func(ctx context.Context, key string) (interface{}, error) {
+		time.Sleep(10 * time.Millisecond)
+		return strings.ToUpper(key), nil
+	})
+	m.Get("a")
+	m.Get("a")
+	s := m.Stats()
+	if s.Hits != 1 || s.Misses != 1 || s.Loads != 1 {
+		t.Errorf("Stats = %+v, want 1 hit, 1 miss, 1 load", s)
+	}
+	if s.MeanLoadTime() < 10*time.Millisecond {
+		t.Errorf("MeanLoadTime = %v, want >= 10ms", s.MeanLoadTime())
+	}
+}
+
+// 一致性检查，使用 -race 运行
+func TestConformance(t *testing.T) {
+	memotest.RunContext(t, func(f memotest.ContextFunc) memotest.CM {
+		return NewWithOptions(f, Options{MaxEntries: 100, TTL: time.Minute})
+	})
+}
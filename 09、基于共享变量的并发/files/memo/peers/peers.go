@@ -0,0 +1,228 @@
+// Package peers 让多个进程共享 memo 的缓存，类似 groupcache
+// 每个 key 由一致性哈希环选出的一个节点拥有，只有拥有者会调用 f；
+// 其他节点未命中时通过 HTTP 向拥有者请求，拥有者用 memo 的 entry.ready 对并发的请求去重
+// 被频繁请求的 key 会在请求它的节点上保留一份副本，以免拥有者成为热点
+package peers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"gostudy/09、基于共享变量的并发/files/memo"
+)
+
+// Options 配置 Pool，零值使用默认配置
+type Options struct {
+	BasePath string              // 节点之间请求的路径前缀，默认为 "/_memo/"
+	Replicas int                 // 每个节点的虚拟节点数，默认为 50
+	Hash     func([]byte) uint32 // 一致性哈希函数，默认为 crc32.ChecksumIEEE
+	Memo     memo.Options        // 本节点拥有的 key 的缓存配置
+	Client   *http.Client        // 默认为 http.DefaultClient
+
+	// 一个不属于本节点的 key 被请求 HotThreshold 次之后，会在本节点保留一份副本，0 表示不保留
+	// 副本最多 HotEntries 个（默认 100），HotTTL（默认 1 分钟）后过期
+	HotThreshold int
+	HotEntries   int
+	HotTTL       time.Duration
+}
+
+// Stats 是 Pool 的统计信息
+type Stats struct {
+	Local        memo.Stats // 本节点拥有的 key
+	Hot          memo.Stats // 热点 key 的副本
+	PeerRequests int64      // 向其他节点发出的请求
+	PeerErrors   int64      // 失败后改为在本节点计算的请求
+	Served       int64      // 为其他节点提供的结果
+}
+
+// Pool 是一个节点，它同时是其他节点的 http.Handler
+// f 返回的值必须是 []byte，因为它们要在节点之间传输
+type Pool struct {
+	self  string // 本节点的 URL，例如 "http://10.0.0.1:8000"
+	opts  Options
+	local *memo.Memo
+	hot   *memo.Memo
+
+	mu    sync.Mutex
+	ring  *Ring
+	seen  map[string]int // 不属于本节点的 key 被请求的次数
+	stats Stats
+}
+
+// maxSeen 限制 seen 的大小，超过时清空重新计数
+const maxSeen = 10000
+
+// New 返回地址为 self 的节点，客户端必须随后调用 Set 设置所有节点，并最终调用 Close
+func New(self string, f memo.Func, opts Options) *Pool {
+	if opts.BasePath == "" {
+		opts.BasePath = "/_memo/"
+	}
+	if opts.Replicas <= 0 {
+		opts.Replicas = 50
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.HotEntries <= 0 {
+		opts.HotEntries = 100
+	}
+	if opts.HotTTL <= 0 {
+		opts.HotTTL = time.Minute
+	}
+	p := &Pool{
+		self: self,
+		opts: opts,
+		ring: NewRing(opts.Replicas, opts.Hash),
+		seen: make(map[string]int),
+	}
+	p.local = memo.NewWithOptions(f, opts.Memo)
+	p.hot = memo.NewWithOptions(p.fetch, memo.Options{
+		MaxEntries: opts.HotEntries,
+		TTL:        opts.HotTTL,
+		Errors:     memo.ErrorPolicy{Mode: memo.NoCacheErrors},
+	})
+	return p
+}
+
+// Set 替换所有节点的 URL，peers 应当包括本节点
+func (p *Pool) Set(peers ...string) {
+	ring := NewRing(p.opts.Replicas, p.opts.Hash)
+	ring.Add(peers...)
+	p.mu.Lock()
+	p.ring = ring
+	p.mu.Unlock()
+}
+
+// Get 是线程安全的
+func (p *Pool) Get(key string) (interface{}, error) {
+	return p.GetContext(context.Background(), key)
+}
+
+// GetContext 返回 key 的结果：本节点拥有 key 时从本地缓存得到，否则向拥有者请求
+func (p *Pool) GetContext(ctx context.Context, key string) (interface{}, error) {
+	p.mu.Lock()
+	owner := p.ring.Get(key)
+	if owner == "" || owner == p.self {
+		p.mu.Unlock()
+		return p.local.GetContext(ctx, key)
+	}
+	if len(p.seen) >= maxSeen {
+		p.seen = make(map[string]int)
+	}
+	p.seen[key]++
+	hot := p.opts.HotThreshold > 0 && p.seen[key] >= p.opts.HotThreshold
+	p.mu.Unlock()
+
+	if hot {
+		return p.hot.GetContext(ctx, key)
+	}
+	return p.fetch(ctx, key)
+}
+
+// fetch 向拥有者请求 key，失败时在本节点计算
+func (p *Pool) fetch(ctx context.Context, key string) (interface{}, error) {
+	p.mu.Lock()
+	owner := p.ring.Get(key)
+	p.stats.PeerRequests++
+	p.mu.Unlock()
+
+	value, err := p.request(ctx, owner, key)
+	if err == nil {
+		return value, nil
+	}
+	if _, ok := err.(*RemoteError); ok {
+		return nil, err // f 在拥有者那里返回了错误
+	}
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+	p.mu.Lock()
+	p.stats.PeerErrors++
+	p.mu.Unlock()
+	return p.local.GetContext(ctx, key)
+}
+
+// RemoteError 是 f 在拥有者节点上返回的错误
+type RemoteError struct {
+	Peer string
+	Msg  string
+}
+
+func (e *RemoteError) Error() string {
+	return fmt.Sprintf("peer %s: %s", e.Peer, e.Msg)
+}
+
+func (p *Pool) request(ctx context.Context, owner, key string) ([]byte, error) {
+	u := strings.TrimSuffix(owner, "/") + p.opts.BasePath + "?key=" + url.QueryEscape(key)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := p.opts.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	switch resp.StatusCode {
+	case http.StatusOK:
+		return body, nil
+	case http.StatusBadGateway:
+		return nil, &RemoteError{owner, string(body)}
+	}
+	return nil, fmt.Errorf("peer %s: %s", owner, resp.Status)
+}
+
+// ServeHTTP 为其他节点提供结果
+// 无论 key 是否属于本节点，都在本地计算，以免节点之间的环不一致时互相转发
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != p.opts.BasePath {
+		http.NotFound(w, r)
+		return
+	}
+	key := r.URL.Query().Get("key")
+	p.mu.Lock()
+	p.stats.Served++
+	p.mu.Unlock()
+
+	value, err := p.local.GetContext(r.Context(), key)
+	if err != nil {
+		if r.Context().Err() != nil {
+			return // 请求方已经放弃
+		}
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	b, ok := value.([]byte)
+	if !ok {
+		http.Error(w, fmt.Sprintf("value of type %T is not []byte", value), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Write(b)
+}
+
+// Stats 返回统计信息的快照
+func (p *Pool) Stats() Stats {
+	p.mu.Lock()
+	s := p.stats
+	p.mu.Unlock()
+	s.Local = p.local.Stats()
+	s.Hot = p.hot.Stats()
+	return s
+}
+
+// Close 停止本地缓存的后台清理
+func (p *Pool) Close() {
+	p.local.Close()
+	p.hot.Close()
+}
@@ -0,0 +1,222 @@
+package peers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRing(t *testing.T) {
+	r := NewRing(50, nil)
+	if got := r.Get("x"); got != "" {
+		t.Errorf("empty ring: Get = %q, want \"\"", got)
+	}
+	r.Add("a", "b", "c")
+	before := make(map[string]string)
+	count := make(map[string]int)
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprint("key", i)
+		before[key] = r.Get(key)
+		count[before[key]]++
+	}
+	for _, node := range []string{"a", "b", "c"} {
+		if count[node] < 500 {
+			t.Errorf("node %s owns %d of 3000 keys, want a fairer share", node, count[node])
+		}
+	}
+
+	// 增加一个节点后，key 只会从旧节点移动到新节点
+	r.Add("d")
+	moved := 0
+	for key, old := range before {
+		if now := r.Get(key); now != old {
+			if now != "d" {
+				t.Fatalf("key %s moved from %s to %s, want d", key, old, now)
+			}
+			moved++
+		}
+	}
+	if moved == 0 || moved > 1500 {
+		t.Errorf("%d of 3000 keys moved to the new node", moved)
+	}
+}
+
+// cluster 是若干个运行在 httptest 服务器上的节点
+type cluster struct {
+	pools   []*Pool
+	servers []*httptest.Server
+
+	mu    sync.Mutex
+	calls map[string]int // 每个节点上 f 的调用次数，key 为 "节点/key"
+	gate  chan struct{}  // 不为 nil 时，f 会阻塞到它被关闭
+}
+
+func newCluster(t *testing.T, n int, opts Options) *cluster {
+	c := &cluster{calls: make(map[string]int)}
+	var urls []string
+	for i := 0; i < n; i++ {
+		i := i
+		s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			c.pools[i].ServeHTTP(w, r)
+		}))
+		c.servers = append(c.servers, s)
+		urls = append(urls, s.URL)
+	}
+	for i, u := range urls {
+		u := u
+		f := func(ctx context.Context, key string) (interface{}, error) {
+			c.mu.Lock()
+			c.calls[fmt.Sprint(i, "/", key)]++
+			gate := c.gate
+			c.mu.Unlock()
+			if gate != nil {
+				<-gate
+			}
+			if key == "bad" {
+				return nil, errors.New("bad key")
+			}
+			return []byte(key + "@" + u), nil
+		}
+		p := New(u, f, opts)
+		p.Set(urls...)
+		c.pools = append(c.pools, p)
+	}
+	t.Cleanup(func() {
+		for i := range c.pools {
+			c.servers[i].Close()
+			c.pools[i].Close()
+		}
+	})
+	return c
+}
+
+// owner 返回拥有 key 的节点的下标
+func (c *cluster) owner(key string) int {
+	owner := c.pools[0].ring.Get(key)
+	for i, s := range c.servers {
+		if s.URL == owner {
+			return i
+		}
+	}
+	panic("no owner")
+}
+
+func (c *cluster) totalCalls(key string) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for i := range c.pools {
+		n += c.calls[fmt.Sprint(i, "/", key)]
+	}
+	return n
+}
+
+// 所有节点并发请求同一个 key 时，只有拥有者调用一次 f
+func TestOwnerDedup(t *testing.T) {
+	c := newCluster(t, 3, Options{})
+	c.gate = make(chan struct{})
+	const key = "shared"
+	owner := c.owner(key)
+	want := key + "@" + c.servers[owner].URL
+
+	var wg sync.WaitGroup
+	for i := range c.pools {
+		for j := 0; j < 5; j++ {
+			wg.Add(1)
+			go func(p *Pool) {
+				defer wg.Done()
+				v, err := p.Get(key)
+				if err != nil || string(v.([]byte)) != want {
+					t.Errorf("Get = %v, %v, want %s", v, err, want)
+				}
+			}(c.pools[i])
+		}
+	}
+	// 等待所有请求都到达拥有者
+	for {
+		s := c.pools[owner].local.Stats()
+		if s.Misses+s.Dedups == 15 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(c.gate)
+	wg.Wait()
+
+	if n := c.totalCalls(key); n != 1 {
+		t.Errorf("f called %d times across the cluster, want 1", n)
+	}
+	c.mu.Lock()
+	if n := c.calls[fmt.Sprint(owner, "/", key)]; n != 1 {
+		t.Errorf("owner called f %d times, want 1", n)
+	}
+	c.mu.Unlock()
+}
+
+func TestRemoteError(t *testing.T) {
+	c := newCluster(t, 3, Options{})
+	for i, p := range c.pools {
+		_, err := p.Get("bad")
+		if i == c.owner("bad") {
+			if err == nil || err.Error() != "bad key" {
+				t.Errorf("owner: err = %v, want bad key", err)
+			}
+			continue
+		}
+		var re *RemoteError
+		if !errors.As(err, &re) || re.Msg != "bad key\n" {
+			t.Errorf("node %d: err = %v, want a RemoteError", i, err)
+		}
+	}
+	if n := c.totalCalls("bad"); n != 1 {
+		t.Errorf("f called %d times, want 1", n)
+	}
+}
+
+// 热点 key 在请求它的节点上保留副本，之后不再访问拥有者
+func TestHotReplication(t *testing.T) {
+	c := newCluster(t, 2, Options{HotThreshold: 2})
+	const key = "hot"
+	owner := c.owner(key)
+	other := c.pools[1-owner]
+	for i := 0; i < 5; i++ {
+		if _, err := other.Get(key); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 第 1 次直接请求拥有者，第 2 次成为热点并复制，之后命中副本
+	if got := c.pools[owner].Stats().Served; got != 2 {
+		t.Errorf("owner served %d requests, want 2", got)
+	}
+	s := other.Stats()
+	if s.Hot.Hits != 3 || s.Hot.Entries != 1 {
+		t.Errorf("Hot = %+v, want 3 hits on 1 replica", s.Hot)
+	}
+	if n := c.totalCalls(key); n != 1 {
+		t.Errorf("f called %d times, want 1", n)
+	}
+}
+
+// 拥有者不可用时，在本节点计算
+func TestOwnerDown(t *testing.T) {
+	c := newCluster(t, 2, Options{})
+	const key = "k"
+	owner := c.owner(key)
+	c.servers[owner].Close()
+	other := c.pools[1-owner]
+	v, err := other.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := key + "@" + c.servers[1-owner].URL; string(v.([]byte)) != want {
+		t.Errorf("Get = %s, want %s", v, want)
+	}
+	if s := other.Stats(); s.PeerErrors != 1 {
+		t.Errorf("PeerErrors = %d, want 1", s.PeerErrors)
+	}
+}
@@ -0,0 +1,54 @@
+package peers
+
+import (
+	"hash/crc32"
+	"sort"
+	"strconv"
+)
+
+// Ring 是一致性哈希环，每个节点在环上有 replicas 个虚拟节点
+// 增加或删除一个节点时，只有相邻的 key 会换到别的节点
+type Ring struct {
+	hash     func([]byte) uint32
+	replicas int
+	points   []uint32 // 有序的虚拟节点
+	owners   map[uint32]string
+}
+
+// NewRing 返回一个空的环，hash 为 nil 时使用 crc32.ChecksumIEEE
+func NewRing(replicas int, hash func([]byte) uint32) *Ring {
+	if hash == nil {
+		hash = crc32.ChecksumIEEE
+	}
+	if replicas <= 0 {
+		replicas = 1
+	}
+	return &Ring{hash: hash, replicas: replicas, owners: make(map[uint32]string)}
+}
+
+// Add 把节点加入环中
+func (r *Ring) Add(nodes ...string) {
+	for _, node := range nodes {
+		for i := 0; i < r.replicas; i++ {
+			h := r.hash([]byte(strconv.Itoa(i) + node))
+			if _, ok := r.owners[h]; !ok {
+				r.points = append(r.points, h)
+			}
+			r.owners[h] = node
+		}
+	}
+	sort.Slice(r.points, func(i, j int) bool { return r.points[i] < r.points[j] })
+}
+
+// Get 返回拥有 key 的节点，环为空时返回 ""
+func (r *Ring) Get(key string) string {
+	if len(r.points) == 0 {
+		return ""
+	}
+	h := r.hash([]byte(key))
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0 // 环绕到第一个虚拟节点
+	}
+	return r.owners[r.points[i]]
+}
@@ -0,0 +1,67 @@
+package memo
+
+import "container/heap"
+
+// policy 按照淘汰的先后顺序保存已完成的 entry，调用方必须持有 mu
+type policy interface {
+	add(e *entry)
+	touch(e *entry) // e 的 uses 或 lastUsed 改变了
+	remove(e *entry)
+	victim() *entry // 下一个要淘汰的 entry，没有则返回 nil
+}
+
+// queue 是以 less 排序的最小堆，entry.index 是它在堆中的下标，不在堆中时为 -1
+type queue struct {
+	entries []*entry
+	less    func(a, b *entry) bool
+}
+
+func newLRU() *queue {
+	return &queue{less: func(a, b *entry) bool { return a.lastUsed < b.lastUsed }}
+}
+
+func newLFU() *queue {
+	return &queue{less: func(a, b *entry) bool {
+		if a.uses != b.uses {
+			return a.uses < b.uses
+		}
+		return a.lastUsed < b.lastUsed
+	}}
+}
+
+func (q *queue) add(e *entry)    { heap.Push(q, e) }
+func (q *queue) touch(e *entry)  { heap.Fix(q, e.index) }
+func (q *queue) remove(e *entry) { heap.Remove(q, e.index) }
+
+func (q *queue) victim() *entry {
+	if len(q.entries) == 0 {
+		return nil
+	}
+	return q.entries[0]
+}
+
+// 以下方法实现 heap.Interface
+
+func (q *queue) Len() int           { return len(q.entries) }
+func (q *queue) Less(i, j int) bool { return q.less(q.entries[i], q.entries[j]) }
+
+func (q *queue) Swap(i, j int) {
+	q.entries[i], q.entries[j] = q.entries[j], q.entries[i]
+	q.entries[i].index = i
+	q.entries[j].index = j
+}
+
+func (q *queue) Push(x interface{}) {
+	e := x.(*entry)
+	e.index = len(q.entries)
+	q.entries = append(q.entries, e)
+}
+
+func (q *queue) Pop() interface{} {
+	n := len(q.entries)
+	e := q.entries[n-1]
+	q.entries[n-1] = nil
+	q.entries = q.entries[:n-1]
+	e.index = -1
+	return e
+}
@@ -0,0 +1,167 @@
+package memo
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/gob"
+	"errors"
+	"hash/crc32"
+	"io"
+	"time"
+)
+
+// Store 是 Memo 的第二层缓存，用于在进程重启后复用已经计算过的结果
+// 只有成功的结果会被保存；内存中未命中时，Memo 先查找 Store，找不到才调用 f
+// Store 的方法可能被并发调用
+type Store interface {
+	// Load 返回 key 的记录，没有记录时 ok 为 false
+	Load(key string) (rec Record, ok bool, err error)
+	Save(rec Record) error
+}
+
+// Record 是 Store 中保存的一个结果
+type Record struct {
+	Key     string
+	Value   interface{}
+	Expires time.Time // 零值表示不过期
+}
+
+// Codec 把结果编码为字节
+type Codec interface {
+	Encode(w io.Writer, value interface{}) error
+	Decode(r io.Reader) (interface{}, error)
+}
+
+// GobCodec 使用 encoding/gob 编码结果
+// 除了基本类型和 []byte 之外，值的具体类型需要先用 gob.Register 注册
+type GobCodec struct{}
+
+// Encode *
+func (GobCodec) Encode(w io.Writer, value interface{}) error {
+	return gob.NewEncoder(w).Encode(&value)
+}
+
+// Decode *
+func (GobCodec) Decode(r io.Reader) (interface{}, error) {
+	var value interface{}
+	err := gob.NewDecoder(r).Decode(&value)
+	return value, err
+}
+
+// ErrCorrupt 表示 Store 中的一条记录没有通过校验
+var ErrCorrupt = errors.New("memo: corrupt record")
+
+// 每条记录的格式为：
+//
+//	长度 (uint32) | CRC-32 (uint32) | 数据
+//
+// 数据为：key 的长度 (uvarint) | key | 过期时间的 UnixNano (varint, 0 表示不过期) | 编码后的值
+// 校验失败的记录是写到一半时崩溃留下的，读取时会被丢弃
+const headerSize = 8
+
+// maxRecordSize 用于识别损坏的长度字段
+const maxRecordSize = 1 << 30
+
+func encodeRecord(codec Codec, rec Record) ([]byte, error) {
+	var data bytes.Buffer
+	data.Write(make([]byte, headerSize))
+	var n [binary.MaxVarintLen64]byte
+	data.Write(n[:binary.PutUvarint(n[:], uint64(len(rec.Key)))])
+	data.WriteString(rec.Key)
+	var expires int64
+	if !rec.Expires.IsZero() {
+		expires = rec.Expires.UnixNano()
+	}
+	data.Write(n[:binary.PutVarint(n[:], expires)])
+	if err := codec.Encode(&data, rec.Value); err != nil {
+		return nil, err
+	}
+	b := data.Bytes()
+	binary.BigEndian.PutUint32(b[0:], uint32(len(b)-headerSize))
+	binary.BigEndian.PutUint32(b[4:], crc32.ChecksumIEEE(b[headerSize:]))
+	return b, nil
+}
+
+// readRecord 从 r 读取一条记录的数据部分，并检查长度和校验和
+func readRecord(r io.Reader) ([]byte, error) {
+	var header [headerSize]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = ErrCorrupt
+		}
+		return nil, err // 正常结束时为 io.EOF
+	}
+	size := binary.BigEndian.Uint32(header[0:])
+	if size > maxRecordSize {
+		return nil, ErrCorrupt
+	}
+	data := make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, ErrCorrupt
+	}
+	if crc32.ChecksumIEEE(data) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, ErrCorrupt
+	}
+	return data, nil
+}
+
+// recordKey 返回数据中的 key 和过期时间，以及值的编码
+func recordKey(data []byte) (key string, expires time.Time, value []byte, err error) {
+	klen, n := binary.Uvarint(data)
+	if n <= 0 || uint64(len(data)-n) < klen {
+		return "", time.Time{}, nil, ErrCorrupt
+	}
+	data = data[n:]
+	key, data = string(data[:klen]), data[klen:]
+	nanos, n := binary.Varint(data)
+	if n <= 0 {
+		return "", time.Time{}, nil, ErrCorrupt
+	}
+	if nanos != 0 {
+		expires = time.Unix(0, nanos)
+	}
+	return key, expires, data[n:], nil
+}
+
+func decodeRecord(codec Codec, data []byte) (Record, error) {
+	key, expires, value, err := recordKey(data)
+	if err != nil {
+		return Record{}, err
+	}
+	v, err := codec.Decode(bytes.NewReader(value))
+	if err != nil {
+		return Record{}, err
+	}
+	return Record{Key: key, Value: v, Expires: expires}, nil
+}
+
+// fetch 先在 Store 中查找 key，找不到或已过期时才调用 f
+func (memo *Memo) fetch(ctx context.Context, key string) (res result, expires time.Time, stored bool) {
+	if s := memo.opts.Store; s != nil {
+		rec, ok, err := s.Load(key)
+		memo.mu.Lock()
+		if err != nil {
+			memo.stats.StoreErrors++
+		} else if ok && (rec.Expires.IsZero() || memo.clock.Now().Before(rec.Expires)) {
+			memo.stats.StoreHits++
+			memo.mu.Unlock()
+			return result{value: rec.Value}, rec.Expires, true
+		}
+		memo.mu.Unlock()
+	}
+	return memo.load(ctx, key), time.Time{}, false
+}
+
+// save 把成功的结果写入 Store
+func (memo *Memo) save(e *entry, expires time.Time) {
+	s := memo.opts.Store
+	if s == nil || e.res.err != nil {
+		return
+	}
+	if err := s.Save(Record{Key: e.key, Value: e.res.value, Expires: expires}); err != nil {
+		memo.mu.Lock()
+		memo.stats.StoreErrors++
+		memo.mu.Unlock()
+	}
+}
@@ -0,0 +1,263 @@
+package memo
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// 重启后，之前计算过的结果从 Store 中得到，不再调用 f
+func TestWarmRestart(t *testing.T) {
+	dir := t.TempDir()
+	for _, test := range []struct {
+		name string
+		open func() (Store, func())
+	}{
+		{"Dir", func() (Store, func()) {
+			s, err := OpenDir(filepath.Join(dir, "cache"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s, func() {}
+		}},
+		{"Log", func() (Store, func()) {
+			s, err := OpenLog(filepath.Join(dir, "cache.log"), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return s, func() { s.Close() }
+		}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			s, closeStore := test.open()
+			c := newCounter()
+			m := NewWithOptions(c.f, Options{Store: s})
+			get(t, m, "a", "b", "a")
+			closeStore()
+
+			s, closeStore = test.open()
+			defer closeStore()
+			c2 := newCounter()
+			m = NewWithOptions(c2.f, Options{Store: s})
+			get(t, m, "a", "b", "c")
+			if got := c2.count("a") + c2.count("b"); got != 0 {
+				t.Errorf("f called %d times for stored keys, want 0", got)
+			}
+			if st := m.Stats(); st.StoreHits != 2 || st.Loads != 1 || st.StoreErrors != 0 {
+				t.Errorf("Stats = %+v, want 2 store hits and 1 load", st)
+			}
+		})
+	}
+}
+
+// 记录带有过期时间，重启后过期的记录会被忽略
+func TestStoreTTL(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	s, err := OpenLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	clock := newFakeClock()
+	c := newCounter()
+	m := NewWithOptions(c.f, Options{Store: s, TTL: time.Minute, Clock: clock, ExpiryInterval: time.Hour})
+	defer m.Close()
+	get(t, m, "a")
+	rec, ok, err := s.Load("a")
+	if err != nil || !ok {
+		t.Fatalf("Load(a) = %v, %v", ok, err)
+	}
+	if want := clock.Now().Add(time.Minute); !rec.Expires.Equal(want) {
+		t.Errorf("Expires = %v, want %v", rec.Expires, want)
+	}
+
+	m2 := NewWithOptions(c.f, Options{Store: s, TTL: time.Minute, Clock: clock, ExpiryInterval: time.Hour})
+	defer m2.Close()
+	clock.Advance(30 * time.Second)
+	get(t, m2, "a") // 从 Store 得到，剩余的有效期是 30 秒
+	clock.Advance(30 * time.Second)
+	get(t, m2, "a") // 内存和 Store 中的记录都过期了
+	if got := c.count("a"); got != 2 {
+		t.Errorf("a loaded %d times, want 2", got)
+	}
+}
+
+// 所有等待者都放弃之后 f 仍然成功时，写入 Store 的记录也按 TTL 过期
+func TestStoreTTLAbandoned(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	s, err := OpenLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	clock := newFakeClock()
+	c := newCounter()
+	c.gate = make(chan struct{})
+	m := NewWithOptions(c.f, Options{Store: s, TTL: time.Minute, Clock: clock, ExpiryInterval: time.Hour})
+	defer m.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		m.GetContext(ctx, "a")
+		close(done)
+	}()
+	for c.count("a") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+	close(c.gate) // f 忽略了取消，仍然成功
+
+	var rec Record
+	for ok := false; !ok; {
+		if rec, ok, err = s.Load("a"); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if want := clock.Now().Add(time.Minute); !rec.Expires.Equal(want) {
+		t.Errorf("Expires = %v, want %v", rec.Expires, want)
+	}
+}
+
+// 写到一半时崩溃留下的记录在重新打开时被截掉，之前的记录不受影响
+func TestLogCrash(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	s, err := OpenLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"a", "b", "c"} {
+		if err := s.Save(Record{Key: key, Value: []byte(key + key)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	good := s.Size()
+	s.Close()
+
+	// 模拟崩溃：最后一条记录只写了一部分
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := encodeRecord(GobCodec{}, Record{Key: "d", Value: []byte("dd")})
+	f.Write(b[:len(b)-3])
+	f.Close()
+
+	s, err = OpenLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if s.Size() != good {
+		t.Errorf("Size after reopen = %d, want %d", s.Size(), good)
+	}
+	if _, ok, err := s.Load("d"); ok || err != nil {
+		t.Errorf("Load(d) = %v, %v, want a miss", ok, err)
+	}
+	rec, ok, err := s.Load("c")
+	if !ok || err != nil || string(rec.Value.([]byte)) != "cc" {
+		t.Errorf("Load(c) = %v, %v, %v", rec, ok, err)
+	}
+	// 截掉之后可以继续追加
+	if err := s.Save(Record{Key: "d", Value: []byte("dd")}); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := s.Load("d"); !ok {
+		t.Error("Load(d) after Save: miss")
+	}
+}
+
+// 校验和不匹配的记录被视为不存在
+func TestLogChecksum(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	s, err := OpenLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Save(Record{Key: "a", Value: "x"})
+	s.Close()
+
+	data, _ := ioutil.ReadFile(path)
+	data[len(data)-1] ^= 0xff
+	ioutil.WriteFile(path, data, 0644)
+
+	s, err = OpenLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if _, ok, _ := s.Load("a"); ok {
+		t.Error("Load returned a record with a bad checksum")
+	}
+}
+
+func TestLogCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "cache.log")
+	s, err := OpenLog(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	for i := 0; i < 100; i++ {
+		s.Save(Record{Key: "a", Value: fmt.Sprint(i)})
+	}
+	s.Save(Record{Key: "old", Value: "x", Expires: time.Unix(1, 0)})
+	s.Save(Record{Key: "b", Value: "y", Expires: time.Now().Add(time.Hour)})
+	before := s.Size()
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if after := s.Size(); after >= before/10 {
+		t.Errorf("Size after Compact = %d, want much less than %d", after, before)
+	}
+	if rec, ok, _ := s.Load("a"); !ok || rec.Value != "99" {
+		t.Errorf("Load(a) = %v, %v, want the latest value", rec.Value, ok)
+	}
+	if _, ok, _ := s.Load("old"); ok {
+		t.Error("expired record survived Compact")
+	}
+	if _, ok, _ := s.Load("b"); !ok {
+		t.Error("unexpired record lost by Compact")
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("temporary file left behind: %v", err)
+	}
+}
+
+// 作为 Memo 的 Store 时，Compact 按 Memo 的 Clock 判断过期，与读取记录时相同
+func TestLogCompactClock(t *testing.T) {
+	s, err := OpenLog(filepath.Join(t.TempDir(), "cache.log"), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	clock := newFakeClock() // 1970 年
+	m := NewWithOptions(newCounter().f, Options{Store: s, Clock: clock})
+	defer m.Close()
+	s.Save(Record{Key: "a", Value: "a", Expires: clock.Now().Add(time.Hour)}) // 按系统时间已经过期了
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	get(t, m, "a")
+	if st := m.Stats(); st.StoreHits != 1 {
+		t.Errorf("Stats = %+v, want the record to survive Compact", st)
+	}
+}
+
+func TestDirCorrupt(t *testing.T) {
+	s, err := OpenDir(t.TempDir(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Save(Record{Key: "a", Value: "x"})
+	data, _ := ioutil.ReadFile(s.path("a"))
+	ioutil.WriteFile(s.path("a"), data[:len(data)-1], 0644)
+	if _, ok, err := s.Load("a"); ok || err != nil {
+		t.Errorf("Load of a truncated file = %v, %v, want a miss", ok, err)
+	}
+}
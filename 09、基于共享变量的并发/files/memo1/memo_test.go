@@ -21,30 +21,30 @@ func TestConcurrent(t *testing.T) {
 
 /*
 命令：
-go test -v
+go test -v -run 'Test$|Concurrent$'
 执行结果：
 === RUN   Test
-https://golang.org, 456.236419ms, 11077 bytes
-https://godoc.org, 391.116987ms, 7159 bytes
-https://play.golang.org, 472.716751ms, 6013 bytes
-https://gopl.io, 728.935826ms, 4154 bytes
-https://golang.org, 1.729µs, 11077 bytes
-https://godoc.org, 506ns, 7159 bytes
-https://play.golang.org, 476ns, 6013 bytes
-https://gopl.io, 376ns, 4154 bytes
---- PASS: Test (2.05s)
+    memotest.go:64: http://127.0.0.1:44875/golang, 1.045977ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:44875/godoc, 198.519µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:44875/play, 132.213µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:44875/gopl, 125.724µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:44875/golang, 12.323µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:44875/godoc, 3.032µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:44875/play, 103.513µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:44875/gopl, 2.478µs, 3000 bytes
+--- PASS: Test (0.00s)
 === RUN   TestConcurrent
-https://play.golang.org, 183.455094ms, 6013 bytes
-https://golang.org, 190.565405ms, 11077 bytes
-https://golang.org, 190.615849ms, 11077 bytes
-https://godoc.org, 211.151938ms, 7159 bytes
-https://godoc.org, 224.137141ms, 7159 bytes
-https://play.golang.org, 280.114071ms, 6013 bytes
-https://gopl.io, 352.995857ms, 4154 bytes
-https://gopl.io, 356.540338ms, 4154 bytes
---- PASS: TestConcurrent (0.36s)
+    memotest.go:64: http://127.0.0.1:46331/golang, 11.301804ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:46331/godoc, 11.456291ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:46331/play, 11.669569ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:46331/gopl, 11.728314ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:46331/golang, 11.815572ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:46331/play, 11.515282ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:46331/godoc, 12.107093ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:46331/gopl, 11.565182ms, 3000 bytes
+--- PASS: TestConcurrent (0.01s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo1      2.411s
+ok      gostudy/09、基于共享变量的并发/files/memo1      0.020s
 */
 
 /*
@@ -52,82 +52,105 @@ ok      gostudy/09、基于共享变量的并发/files/memo1      2.411s
 go test -run=TestConcurrent -v -race
 执行结果：
 === RUN   TestConcurrent
-https://play.golang.org, 671.492084ms, 6013 bytes
+    memotest.go:64: http://127.0.0.1:39741/gopl, 15.661898ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:39741/gopl, 14.732349ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:39741/godoc, 15.720832ms, 4200 bytes
 ==================
 WARNING: DATA RACE
-Write at 0x00c00009ed80 by goroutine 9:
+Write at 0x00c00007fa40 by goroutine 15:
   runtime.mapassign_faststr()
-      /usr/local/go/src/runtime/map_faststr.go:202 +0x0
+      /usr/local/go/src/internal/runtime/maps/runtime_faststr.go:261 +0x0
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memo1.(*Memo).Get()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo.go:27 +0x1ce
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo.go:29 +0xf8
+  gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.get()
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:54 +0x96
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent.func1()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:72 +0xde
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:92 +0xed
+  gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent.gowrap2()
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:93 +0x46
 
-Previous write at 0x00c00009ed80 by goroutine 14:
+Previous write at 0x00c00007fa40 by goroutine 20:
   runtime.mapassign_faststr()
-      /usr/local/go/src/runtime/map_faststr.go:202 +0x0
+      /usr/local/go/src/internal/runtime/maps/runtime_faststr.go:261 +0x0
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memo1.(*Memo).Get()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo.go:27 +0x1ce
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo.go:29 +0xf8
+  gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.get()
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:54 +0x96
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent.func1()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:72 +0xde
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:92 +0xed
+  gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent.gowrap2()
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:93 +0x46
 
-Goroutine 9 (running) created at:
+Goroutine 15 (running) created at:
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:69 +0x10c
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:90 +0x29b
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memo1_test.TestConcurrent()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo_test.go:19 +0xd9
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo_test.go:19 +0xe5
   testing.tRunner()
-      /usr/local/go/src/testing/testing.go:992 +0x1eb
+      /usr/local/go/src/testing/testing.go:2193 +0x21c
+  testing.(*T).Run.gowrap1()
+      /usr/local/go/src/testing/testing.go:2258 +0x38
 
-Goroutine 14 (finished) created at:
+Goroutine 20 (finished) created at:
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:69 +0x10c
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:90 +0x29b
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memo1_test.TestConcurrent()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo_test.go:19 +0xd9
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo_test.go:19 +0xe5
   testing.tRunner()
-      /usr/local/go/src/testing/testing.go:992 +0x1eb
+      /usr/local/go/src/testing/testing.go:2193 +0x21c
+  testing.(*T).Run.gowrap1()
+      /usr/local/go/src/testing/testing.go:2258 +0x38
 ==================
-https://golang.org, 683.501458ms, 11077 bytes
+    memotest.go:64: http://127.0.0.1:39741/play, 18.25212ms, 3000 bytes
 ==================
 WARNING: DATA RACE
-Write at 0x00c0000ae0a8 by goroutine 16:
+Write at 0x00c000088a38 by goroutine 22:
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memo1.(*Memo).Get()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo.go:27 +0x1ec
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo.go:29 +0x109
+  gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.get()
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:54 +0x96
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent.func1()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:72 +0xde
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:92 +0xed
+  gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent.gowrap2()
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:93 +0x46
 
-Previous write at 0x00c0000ae0a8 by goroutine 9:
+Previous write at 0x00c000088a38 by goroutine 15:
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memo1.(*Memo).Get()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo.go:27 +0x1ec
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo.go:29 +0x109
+  gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.get()
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:54 +0x96
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent.func1()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:72 +0xde
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:92 +0xed
+  gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent.gowrap2()
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:93 +0x46
 
-Goroutine 16 (running) created at:
+Goroutine 22 (running) created at:
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:69 +0x10c
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:90 +0x29b
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memo1_test.TestConcurrent()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo_test.go:19 +0xd9
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo_test.go:19 +0xe5
   testing.tRunner()
-      /usr/local/go/src/testing/testing.go:992 +0x1eb
+      /usr/local/go/src/testing/testing.go:2193 +0x21c
+  testing.(*T).Run.gowrap1()
+      /usr/local/go/src/testing/testing.go:2258 +0x38
 
-Goroutine 9 (finished) created at:
+Goroutine 15 (finished) created at:
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memotest.Concurrent()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:69 +0x10c
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memotest/memotest.go:90 +0x29b
   gostudy/09%e3%80%81%e5%9f%ba%e4%ba%8e%e5%85%b1%e4%ba%ab%e5%8f%98%e9%87%8f%e7%9a%84%e5%b9%b6%e5%8f%91/files/memo1_test.TestConcurrent()
-      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo_test.go:19 +0xd9
+      /data/go/src/gostudy/09、基于共享变量的并发/files/memo1/memo_test.go:19 +0xe5
   testing.tRunner()
-      /usr/local/go/src/testing/testing.go:992 +0x1eb
+      /usr/local/go/src/testing/testing.go:2193 +0x21c
+  testing.(*T).Run.gowrap1()
+      /usr/local/go/src/testing/testing.go:2258 +0x38
 ==================
-https://golang.org, 684.946146ms, 11077 bytes
-https://godoc.org, 683.452239ms, 7159 bytes
-https://godoc.org, 689.321533ms, 7159 bytes
-https://play.golang.org, 741.77646ms, 6013 bytes
-https://gopl.io, 1.013736586s, 4154 bytes
-https://gopl.io, 1.023209596s, 4154 bytes
-    TestConcurrent: testing.go:906: race detected during execution of test
---- FAIL: TestConcurrent (1.03s)
-    : testing.go:906: race detected during execution of test
+    memotest.go:64: http://127.0.0.1:39741/play, 17.919384ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:39741/golang, 18.42201ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:39741/golang, 19.53922ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:39741/godoc, 20.31546ms, 4200 bytes
+    testing.go:1865: race detected during execution of test
+--- FAIL: TestConcurrent (0.02s)
+FAIL
+FAIL    gostudy/09、基于共享变量的并发/files/memo1      0.037s
 FAIL
-exit status 1
-FAIL    gostudy/09、基于共享变量的并发/files/memo1      1.038s
 */
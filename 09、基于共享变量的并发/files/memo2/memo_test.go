@@ -19,32 +19,37 @@ func TestConcurrent(t *testing.T) {
 	memotest.Concurrent(t, m)
 }
 
+// 一致性检查，对同一个 key 的并发请求会因为持有锁而串行，所以 f 只被调用一次
+func TestConformance(t *testing.T) {
+	memotest.Run(t, func(f memotest.Func) memotest.M { return memo.New(f) })
+}
+
 /*
 命令：
-go test -v
+go test -v -run 'Test$|Concurrent$'
 执行结果：
 === RUN   Test
-https://golang.org, 412.616932ms, 11077 bytes
-https://godoc.org, 509.605011ms, 7159 bytes
-https://play.golang.org, 421.174278ms, 6013 bytes
-https://gopl.io, 718.672394ms, 4154 bytes
-https://golang.org, 1.212µs, 11077 bytes
-https://godoc.org, 260ns, 7159 bytes
-https://play.golang.org, 187ns, 6013 bytes
-https://gopl.io, 233ns, 4154 bytes
---- PASS: Test (2.06s)
+    memotest.go:64: http://127.0.0.1:34389/golang, 699.729µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:34389/godoc, 166.23µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:34389/play, 82.576µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:34389/gopl, 107.982µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:34389/golang, 14.617µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:34389/godoc, 3.715µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:34389/play, 8.626µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:34389/gopl, 24.602µs, 3000 bytes
+--- PASS: Test (0.00s)
 === RUN   TestConcurrent
-https://godoc.org, 314.417641ms, 7159 bytes
-https://golang.org, 507.608668ms, 11077 bytes
-https://gopl.io, 861.129179ms, 4154 bytes
-https://play.golang.org, 1.159111376s, 6013 bytes
-https://godoc.org, 1.159148373s, 7159 bytes
-https://golang.org, 1.159223255s, 11077 bytes
-https://gopl.io, 1.159252253s, 4154 bytes
-https://play.golang.org, 1.15927606s, 6013 bytes
---- PASS: TestConcurrent (1.16s)
+    memotest.go:64: http://127.0.0.1:39537/godoc, 10.736647ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:39537/golang, 20.997715ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:39537/gopl, 31.491871ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:39537/play, 42.188396ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:39537/godoc, 42.268659ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:39537/golang, 42.294524ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:39537/gopl, 42.323108ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:39537/play, 42.335974ms, 3000 bytes
+--- PASS: TestConcurrent (0.04s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo2      3.228s
+ok      gostudy/09、基于共享变量的并发/files/memo2      0.048s
 */
 
 /*
@@ -52,15 +57,15 @@ ok      gostudy/09、基于共享变量的并发/files/memo2      3.228s
 go test -run=TestConcurrent -v -race
 执行结果：
 === RUN   TestConcurrent
-https://golang.org, 686.527752ms, 11077 bytes
-https://godoc.org, 1.204628759s, 7159 bytes
-https://play.golang.org, 1.72460784s, 6013 bytes
-https://golang.org, 1.724617968s, 11077 bytes
-https://gopl.io, 2.519667974s, 4154 bytes
-https://godoc.org, 2.519450911s, 7159 bytes
-https://play.golang.org, 2.519577108s, 6013 bytes
-https://gopl.io, 2.519700733s, 4154 bytes
---- PASS: TestConcurrent (2.52s)
+    memotest.go:64: http://127.0.0.1:35651/gopl, 12.196222ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:35651/golang, 23.26495ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:35651/godoc, 34.316562ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:35651/play, 45.209874ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:35651/golang, 44.99521ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:35651/godoc, 45.130635ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:35651/gopl, 45.174268ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:35651/play, 45.216562ms, 3000 bytes
+--- PASS: TestConcurrent (0.05s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo2      2.556s
+ok      gostudy/09、基于共享变量的并发/files/memo2      1.062s
 */
@@ -19,32 +19,35 @@ func TestConcurrent(t *testing.T) {
 	memotest.Concurrent(t, m)
 }
 
+// 注意：memo3 在调用 f 时释放了锁，对同一个 key 的并发请求会重复调用 f，
+// 所以它不能通过 memotest.Dedup 和 memotest.Run 的一致性检查
+
 /*
 命令：
-go test -v
+go test -v -run 'Test$|Concurrent$'
 执行结果：
 === RUN   Test
-https://golang.org, 430.254996ms, 11077 bytes
-https://godoc.org, 979.962716ms, 7159 bytes
-https://play.golang.org, 438.281281ms, 6013 bytes
-https://gopl.io, 877.217864ms, 4154 bytes
-https://golang.org, 906ns, 11077 bytes
-https://godoc.org, 914ns, 7159 bytes
-https://play.golang.org, 762ns, 6013 bytes
-https://gopl.io, 495ns, 4154 bytes
---- PASS: Test (2.73s)
+    memotest.go:64: http://127.0.0.1:41517/golang, 727.675µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41517/godoc, 161.388µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41517/play, 85.667µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41517/gopl, 80.274µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41517/golang, 26.084µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41517/godoc, 3.52µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41517/play, 8.424µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41517/gopl, 2.699µs, 3000 bytes
+--- PASS: Test (0.00s)
 === RUN   TestConcurrent
-https://golang.org, 179.157301ms, 11077 bytes
-https://golang.org, 185.268285ms, 11077 bytes
-https://play.golang.org, 277.226289ms, 6013 bytes
-https://play.golang.org, 281.954389ms, 6013 bytes
-https://godoc.org, 319.011594ms, 7159 bytes
-https://gopl.io, 340.736148ms, 4154 bytes
-https://gopl.io, 341.761833ms, 4154 bytes
-https://godoc.org, 348.250865ms, 7159 bytes
---- PASS: TestConcurrent (0.35s)
+    memotest.go:64: http://127.0.0.1:37203/godoc, 12.066697ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:37203/gopl, 11.571142ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:37203/golang, 11.877262ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:37203/godoc, 12.002034ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:37203/play, 12.101945ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:37203/gopl, 12.193086ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:37203/golang, 12.314525ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:37203/play, 11.816249ms, 3000 bytes
+--- PASS: TestConcurrent (0.01s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo3      3.079s
+ok      gostudy/09、基于共享变量的并发/files/memo3      0.019s
 */
 
 /*
@@ -52,15 +55,15 @@ ok      gostudy/09、基于共享变量的并发/files/memo3      3.079s
 go test -run=TestConcurrent -v -race
 执行结果：
 === RUN   TestConcurrent
-https://golang.org, 631.326487ms, 11077 bytes
-https://play.golang.org, 620.708695ms, 6013 bytes
-https://golang.org, 628.35805ms, 11077 bytes
-https://godoc.org, 662.243534ms, 7159 bytes
-https://godoc.org, 659.104454ms, 7159 bytes
-https://play.golang.org, 747.629454ms, 6013 bytes
-https://gopl.io, 961.063956ms, 4154 bytes
-https://gopl.io, 953.452516ms, 4154 bytes
---- PASS: TestConcurrent (0.97s)
+    memotest.go:64: http://127.0.0.1:46399/golang, 14.787701ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:46399/godoc, 16.069374ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:46399/gopl, 16.300679ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:46399/golang, 17.7027ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:46399/godoc, 16.751443ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:46399/gopl, 16.794065ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:46399/play, 17.770884ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:46399/play, 17.250457ms, 3000 bytes
+--- PASS: TestConcurrent (0.02s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo3      0.989s
+ok      gostudy/09、基于共享变量的并发/files/memo3      1.036s
 */
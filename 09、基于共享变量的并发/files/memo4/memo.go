@@ -1,10 +1,14 @@
 // Package memo 提供并发安全的缓存
 // 对不同 key 进行并发请求
 // 对相同 key 进行并发请求时，需要等待第一个并发请求完成
+// 等待的请求可以通过 context 放弃，所有等待者都放弃时，f 的调用会被取消
 // 使用互斥锁实现
 package memo
 
-import "sync"
+import (
+	"context"
+	"sync"
+)
 
 // Memo 会缓存 Func 的结果
 type Memo struct {
@@ -13,8 +17,8 @@ type Memo struct {
 	cache map[string]*entry
 }
 
-// Func 是要缓存的类型
-type Func func(key string) (interface{}, error)
+// Func 是要缓存的类型，它应当在 ctx 被取消时尽快返回
+type Func func(ctx context.Context, key string) (interface{}, error)
 
 type result struct {
 	value interface{}
@@ -22,8 +26,10 @@ type result struct {
 }
 
 type entry struct {
-	res   result
-	ready chan struct{} // ready 后关闭
+	res     result
+	ready   chan struct{}      // ready 后关闭
+	cancel  context.CancelFunc // 取消 f 的调用
+	waiters int                // 正在等待 ready 的请求数，由 mu 守护
 }
 
 // New *
@@ -33,21 +39,55 @@ func New(f Func) *Memo {
 
 // Get 是线程安全的
 func (memo *Memo) Get(key string) (value interface{}, err error) {
+	return memo.GetContext(context.Background(), key)
+}
+
+// GetContext 和 Get 相同，但可以在 ctx 被取消时放弃等待并返回 ctx.Err()
+// 如果 key 的所有等待者都放弃了，f 的调用会被取消，并且 entry 会被删除，
+// 之后对 key 的请求会重新调用 f，而不是永远得到 context.Canceled
+func (memo *Memo) GetContext(ctx context.Context, key string) (value interface{}, err error) {
 	memo.mu.Lock()
 	e := memo.cache[key]
 	if e == nil {
 		// 对 key 的首次请求
-		// 这个 goroutine 负责计算值并广播 ready 状态
-		e = &entry{ready: make(chan struct{})}
+		// 这个 goroutine 负责启动计算，f 的 context 不随任何一个请求取消
+		fctx, cancel := context.WithCancel(context.Background())
+		e = &entry{ready: make(chan struct{}), cancel: cancel}
 		memo.cache[key] = e
-		memo.mu.Unlock()
+		go e.call(fctx, memo.f, key)
+	}
+	e.waiters++
+	memo.mu.Unlock()
 
-		e.res.value, e.res.err = memo.f(key)
-		close(e.ready) // 广播 ready 状态
-	} else {
-		// 对 key 的重复请求
+	select {
+	case <-e.ready: // 等待 ready 状态
+		return e.res.value, e.res.err
+	case <-ctx.Done():
+		memo.mu.Lock()
+		e.waiters--
+		if e.waiters == 0 && !e.isReady() {
+			// 最后一个等待者放弃了，取消计算以免结果被缓存
+			e.cancel()
+			if memo.cache[key] == e {
+				delete(memo.cache, key)
+			}
+		}
 		memo.mu.Unlock()
-		<-e.ready // 等待 ready 状态
+		return nil, ctx.Err()
+	}
+}
+
+func (e *entry) call(ctx context.Context, f Func, key string) {
+	e.res.value, e.res.err = f(ctx, key)
+	e.cancel()     // 释放 context 的资源
+	close(e.ready) // 广播 ready 状态
+}
+
+func (e *entry) isReady() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
 	}
-	return e.res.value, e.res.err
 }
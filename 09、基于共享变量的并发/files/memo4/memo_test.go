@@ -6,7 +6,7 @@ import (
 	"testing"
 )
 
-var httpGetBody = memotest.HTTPGetBody
+var httpGetBody = memotest.HTTPGetBodyContext
 
 func Test(t *testing.T) {
 	m := memo.New(httpGetBody)
@@ -19,32 +19,37 @@ func TestConcurrent(t *testing.T) {
 	memotest.Concurrent(t, m)
 }
 
+// 一致性检查，使用 -race 运行
+func TestConformance(t *testing.T) {
+	memotest.RunContext(t, func(f memotest.ContextFunc) memotest.CM { return memo.New(f) })
+}
+
 /*
 命令：
-go test -v
+go test -v -run 'Test$|Concurrent$'
 执行结果：
 === RUN   Test
-https://golang.org, 457.849642ms, 11077 bytes
-https://godoc.org, 427.238612ms, 7159 bytes
-https://play.golang.org, 572.867886ms, 6013 bytes
-https://gopl.io, 749.680727ms, 4154 bytes
-https://golang.org, 1.328µs, 11077 bytes
-https://godoc.org, 832ns, 7159 bytes
-https://play.golang.org, 915ns, 6013 bytes
-https://gopl.io, 1.025µs, 4154 bytes
---- PASS: Test (2.21s)
+    memotest.go:64: http://127.0.0.1:36659/golang, 730.89µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:36659/godoc, 242.793µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:36659/play, 110.813µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:36659/gopl, 60.275µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:36659/golang, 14.801µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:36659/godoc, 3.387µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:36659/play, 5.806µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:36659/gopl, 2.842µs, 3000 bytes
+--- PASS: Test (0.00s)
 === RUN   TestConcurrent
-https://play.golang.org, 194.043713ms, 6013 bytes
-https://play.golang.org, 194.184387ms, 6013 bytes
-https://godoc.org, 309.036603ms, 7159 bytes
-https://godoc.org, 308.939111ms, 7159 bytes
-https://gopl.io, 336.438403ms, 4154 bytes
-https://gopl.io, 336.535976ms, 4154 bytes
-https://golang.org, 479.377886ms, 11077 bytes
-https://golang.org, 479.369195ms, 11077 bytes
---- PASS: TestConcurrent (0.48s)
+    memotest.go:64: http://127.0.0.1:41495/godoc, 11.22584ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41495/gopl, 11.129505ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41495/godoc, 11.116732ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41495/gopl, 11.165222ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41495/golang, 11.433659ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41495/play, 11.350799ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41495/golang, 11.260823ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41495/play, 11.276373ms, 3000 bytes
+--- PASS: TestConcurrent (0.01s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo4      2.695s
+ok      gostudy/09、基于共享变量的并发/files/memo4      0.019s
 */
 
 /*
@@ -52,15 +57,15 @@ ok      gostudy/09、基于共享变量的并发/files/memo4      2.695s
 go test -run=TestConcurrent -v -race
 执行结果：
 === RUN   TestConcurrent
-https://play.golang.org, 611.979811ms, 6013 bytes
-https://play.golang.org, 604.972733ms, 6013 bytes
-https://golang.org, 623.433327ms, 11077 bytes
-https://golang.org, 624.253517ms, 11077 bytes
-https://godoc.org, 752.495566ms, 7159 bytes
-https://godoc.org, 745.014887ms, 7159 bytes
-https://gopl.io, 1.051700496s, 4154 bytes
-https://gopl.io, 1.045024294s, 4154 bytes
---- PASS: TestConcurrent (1.05s)
+    memotest.go:64: http://127.0.0.1:41531/play, 13.631865ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41531/gopl, 14.800069ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41531/golang, 14.207117ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41531/golang, 15.610458ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41531/godoc, 14.777505ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41531/godoc, 15.243813ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41531/play, 15.273299ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41531/gopl, 14.373581ms, 3000 bytes
+--- PASS: TestConcurrent (0.02s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo4      1.084s
+ok      gostudy/09、基于共享变量的并发/files/memo4      1.032s
 */
@@ -1,13 +1,16 @@
 // Package memo 提供并发安全且非阻塞的缓存
 // 对不同 key 进行并发请求
 // 对相同 key 进行并发请求时，需要等待第一个并发请求完成
+// 等待的请求可以通过 context 放弃，所有等待者都放弃时，f 的调用会被取消
 // 使用 monitor goroutine 实现
 package memo
 
+import "context"
+
 // !+ Func
 
-// Func 是要缓存的类型
-type Func func(key string) (interface{}, error)
+// Func 是要缓存的类型，它应当在 ctx 被取消时尽快返回
+type Func func(ctx context.Context, key string) (interface{}, error)
 
 type result struct {
 	value interface{}
@@ -15,8 +18,10 @@ type result struct {
 }
 
 type entry struct {
-	res   result
-	ready chan struct{} // ready 后关闭
+	res     result
+	ready   chan struct{}      // ready 后关闭
+	cancel  context.CancelFunc // 取消 f 的调用
+	waiters int                // 正在等待 ready 的请求数，只限于 monitor goroutine
 }
 
 // !- Func
@@ -25,24 +30,46 @@ type entry struct {
 
 // 一个 request 是一条消息， Func 是 request 的 key
 type request struct {
+	ctx      context.Context
 	key      string
 	response chan<- result // client 想要一个结果
 }
 
+// 一个 abandonment 是一条消息，表示一个等待 e 的 request 放弃了
+type abandonment struct {
+	key string
+	e   *entry
+}
+
 // Memo *
-type Memo struct{ requests chan request }
+type Memo struct {
+	requests chan request
+	abandons chan abandonment
+	done     chan struct{} // monitor goroutine 退出后关闭
+}
 
 // New 返回 f 的缓存，客户端必须随后调用 Close
 func New(f Func) *Memo {
-	memo := &Memo{requests: make(chan request)}
+	memo := &Memo{
+		requests: make(chan request),
+		abandons: make(chan abandonment),
+		done:     make(chan struct{}),
+	}
 	go memo.server(f)
 	return memo
 }
 
 // Get *
 func (memo *Memo) Get(key string) (interface{}, error) {
+	return memo.GetContext(context.Background(), key)
+}
+
+// GetContext 和 Get 相同，但可以在 ctx 被取消时放弃等待并返回 ctx.Err()
+// 如果 key 的所有等待者都放弃了，f 的调用会被取消，并且 entry 会被删除，
+// 之后对 key 的请求会重新调用 f，而不是永远得到 context.Canceled
+func (memo *Memo) GetContext(ctx context.Context, key string) (interface{}, error) {
 	response := make(chan result)
-	memo.requests <- request{key, response}
+	memo.requests <- request{ctx, key, response}
 	res := <-response
 	return res.value, res.err
 }
@@ -55,31 +82,68 @@ func (memo *Memo) Close() { close(memo.requests) }
 // !+ monitor
 
 func (memo *Memo) server(f Func) {
+	defer close(memo.done)
 	cache := make(map[string]*entry)
-	for req := range memo.requests {
-		e := cache[req.key]
-		if e == nil {
-			// 对 key 的首次请求
-			e = &entry{ready: make(chan struct{})}
-			cache[req.key] = e
-			go e.call(f, req.key) // 调用 f(key)
+	for {
+		select {
+		case req, ok := <-memo.requests:
+			if !ok {
+				return // Close
+			}
+			e := cache[req.key]
+			if e == nil {
+				// 对 key 的首次请求，f 的 context 不随任何一个请求取消
+				ctx, cancel := context.WithCancel(context.Background())
+				e = &entry{ready: make(chan struct{}), cancel: cancel}
+				cache[req.key] = e
+				go e.call(ctx, f, req.key) // 调用 f(ctx, key)
+			}
+			e.waiters++
+			go memo.deliver(e, req)
+		case a := <-memo.abandons:
+			a.e.waiters--
+			if a.e.waiters == 0 && !a.e.isReady() {
+				// 最后一个等待者放弃了，取消计算以免结果被缓存
+				a.e.cancel()
+				if cache[a.key] == a.e {
+					delete(cache, a.key)
+				}
+			}
 		}
-		go e.deliver(req.response)
 	}
 }
 
-func (e *entry) call(f Func, key string) {
+func (e *entry) call(ctx context.Context, f Func, key string) {
 	// 评估这个函数
-	e.res.value, e.res.err = f(key)
+	e.res.value, e.res.err = f(ctx, key)
+	// 释放 context 的资源
+	e.cancel()
 	// 广播 ready 状态
 	close(e.ready)
 }
 
-func (e *entry) deliver(response chan<- result) {
-	// 等待 ready 状态
-	<-e.ready
-	// 将结果发给客户端
-	response <- e.res
+func (memo *Memo) deliver(e *entry, req request) {
+	select {
+	case <-e.ready: // 等待 ready 状态
+		// 将结果发给客户端
+		req.response <- e.res
+	case <-req.ctx.Done():
+		// 通知 monitor goroutine，Close 之后就不必了
+		select {
+		case memo.abandons <- abandonment{req.key, e}:
+		case <-memo.done:
+		}
+		req.response <- result{err: req.ctx.Err()}
+	}
+}
+
+func (e *entry) isReady() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
 }
 
 // !- monitor
@@ -6,7 +6,7 @@ import (
 	"testing"
 )
 
-var httpGetBody = memotest.HTTPGetBody
+var httpGetBody = memotest.HTTPGetBodyContext
 
 func Test(t *testing.T) {
 	m := memo.New(httpGetBody)
@@ -19,32 +19,37 @@ func TestConcurrent(t *testing.T) {
 	memotest.Concurrent(t, m)
 }
 
+// 一致性检查，使用 -race 运行
+func TestConformance(t *testing.T) {
+	memotest.RunContext(t, func(f memotest.ContextFunc) memotest.CM { return memo.New(f) })
+}
+
 /*
 命令：
-go test -v
+go test -v -run 'Test$|Concurrent$'
 执行结果：
 === RUN   Test
-https://golang.org, 435.792991ms, 11077 bytes
-https://godoc.org, 413.531218ms, 7159 bytes
-https://play.golang.org, 469.68865ms, 6013 bytes
-https://gopl.io, 739.564664ms, 4154 bytes
-https://golang.org, 8.996µs, 11077 bytes
-https://godoc.org, 4.523µs, 7159 bytes
-https://play.golang.org, 4.428µs, 6013 bytes
-https://gopl.io, 3.226µs, 4154 bytes
---- PASS: Test (2.06s)
+    memotest.go:64: http://127.0.0.1:41127/golang, 622.807µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41127/godoc, 149.228µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41127/play, 69.346µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41127/gopl, 62.659µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41127/golang, 15.775µs, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41127/godoc, 5.093µs, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41127/play, 9.779µs, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41127/gopl, 4.39µs, 3000 bytes
+--- PASS: Test (0.00s)
 === RUN   TestConcurrent
-https://golang.org, 183.731796ms, 11077 bytes
-https://golang.org, 183.010075ms, 11077 bytes
-https://play.golang.org, 186.633117ms, 6013 bytes
-https://play.golang.org, 186.725974ms, 6013 bytes
-https://godoc.org, 219.483566ms, 7159 bytes
-https://godoc.org, 218.690298ms, 7159 bytes
-https://gopl.io, 363.915084ms, 4154 bytes
-https://gopl.io, 363.045606ms, 4154 bytes
---- PASS: TestConcurrent (0.36s)
+    memotest.go:64: http://127.0.0.1:43975/gopl, 11.12712ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:43975/golang, 12.609068ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:43975/gopl, 12.497526ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:43975/golang, 12.548279ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:43975/godoc, 12.930011ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:43975/play, 12.790213ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:43975/godoc, 12.785704ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:43975/play, 12.651702ms, 3000 bytes
+--- PASS: TestConcurrent (0.01s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo5      2.428s
+ok      gostudy/09、基于共享变量的并发/files/memo5      0.019s
 */
 
 /*
@@ -52,15 +57,15 @@ ok      gostudy/09、基于共享变量的并发/files/memo5      2.428s
 go test -run=TestConcurrent -v -race
 执行结果：
 === RUN   TestConcurrent
-https://golang.org, 655.305788ms, 11077 bytes
-https://golang.org, 654.391792ms, 11077 bytes
-https://godoc.org, 840.871498ms, 7159 bytes
-https://godoc.org, 857.190799ms, 7159 bytes
-https://play.golang.org, 914.602491ms, 6013 bytes
-https://play.golang.org, 895.276347ms, 6013 bytes
-https://gopl.io, 1.180055181s, 4154 bytes
-https://gopl.io, 1.200626796s, 4154 bytes
---- PASS: TestConcurrent (1.20s)
+    memotest.go:64: http://127.0.0.1:41779/golang, 15.20601ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41779/gopl, 15.102444ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41779/play, 15.28103ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41779/golang, 15.34794ms, 5600 bytes
+    memotest.go:64: http://127.0.0.1:41779/godoc, 15.765693ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41779/godoc, 16.761584ms, 4200 bytes
+    memotest.go:64: http://127.0.0.1:41779/gopl, 14.431793ms, 3000 bytes
+    memotest.go:64: http://127.0.0.1:41779/play, 14.531904ms, 3000 bytes
+--- PASS: TestConcurrent (0.02s)
 PASS
-ok      gostudy/09、基于共享变量的并发/files/memo5      1.270s
+ok      gostudy/09、基于共享变量的并发/files/memo5      1.034s
 */
@@ -0,0 +1,147 @@
+// Package memo 提供并发安全且非阻塞的泛型缓存
+// 和 memo5 相同，使用 monitor goroutine 实现，
+// 但 key 可以是任何可比较的类型，值的类型也由调用方决定，不再需要类型断言
+package memo
+
+import "context"
+
+// !+ Func
+
+// Func 是要缓存的类型，它应当在 ctx 被取消时尽快返回
+type Func[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+type result[V any] struct {
+	value V
+	err   error
+}
+
+type entry[V any] struct {
+	res     result[V]
+	ready   chan struct{}      // ready 后关闭
+	cancel  context.CancelFunc // 取消 f 的调用
+	waiters int                // 正在等待 ready 的请求数，只限于 monitor goroutine
+}
+
+// !- Func
+
+// !+ get
+
+// 一个 request 是一条消息， Func 是 request 的 key
+type request[K comparable, V any] struct {
+	ctx      context.Context
+	key      K
+	response chan<- result[V] // client 想要一个结果
+}
+
+// 一个 abandonment 是一条消息，表示一个等待 e 的 request 放弃了
+type abandonment[K comparable, V any] struct {
+	key K
+	e   *entry[V]
+}
+
+// Memo *
+type Memo[K comparable, V any] struct {
+	requests chan request[K, V]
+	abandons chan abandonment[K, V]
+	done     chan struct{} // monitor goroutine 退出后关闭
+}
+
+// New 返回 f 的缓存，客户端必须随后调用 Close
+func New[K comparable, V any](f func(context.Context, K) (V, error)) *Memo[K, V] {
+	memo := &Memo[K, V]{
+		requests: make(chan request[K, V]),
+		abandons: make(chan abandonment[K, V]),
+		done:     make(chan struct{}),
+	}
+	go memo.server(f)
+	return memo
+}
+
+// Get *
+func (memo *Memo[K, V]) Get(key K) (V, error) {
+	return memo.GetContext(context.Background(), key)
+}
+
+// GetContext 和 Get 相同，但可以在 ctx 被取消时放弃等待并返回 ctx.Err()
+// 如果 key 的所有等待者都放弃了，f 的调用会被取消，并且 entry 会被删除
+func (memo *Memo[K, V]) GetContext(ctx context.Context, key K) (V, error) {
+	response := make(chan result[V])
+	memo.requests <- request[K, V]{ctx, key, response}
+	res := <-response
+	return res.value, res.err
+}
+
+// Close *
+func (memo *Memo[K, V]) Close() { close(memo.requests) }
+
+// !- get
+
+// !+ monitor
+
+func (memo *Memo[K, V]) server(f Func[K, V]) {
+	defer close(memo.done)
+	cache := make(map[K]*entry[V])
+	for {
+		select {
+		case req, ok := <-memo.requests:
+			if !ok {
+				return // Close
+			}
+			e := cache[req.key]
+			if e == nil {
+				// 对 key 的首次请求，f 的 context 不随任何一个请求取消
+				ctx, cancel := context.WithCancel(context.Background())
+				e = &entry[V]{ready: make(chan struct{}), cancel: cancel}
+				cache[req.key] = e
+				go memo.call(ctx, e, f, req.key) // 调用 f(ctx, key)
+			}
+			e.waiters++
+			go memo.deliver(e, req)
+		case a := <-memo.abandons:
+			a.e.waiters--
+			if a.e.waiters == 0 && !a.e.isReady() {
+				// 最后一个等待者放弃了，取消计算以免结果被缓存
+				a.e.cancel()
+				if cache[a.key] == a.e {
+					delete(cache, a.key)
+				}
+			}
+		}
+	}
+}
+
+func (memo *Memo[K, V]) call(ctx context.Context, e *entry[V], f Func[K, V], key K) {
+	// 评估这个函数
+	e.res.value, e.res.err = f(ctx, key)
+	// 释放 context 的资源
+	e.cancel()
+	// 广播 ready 状态
+	close(e.ready)
+}
+
+func (memo *Memo[K, V]) deliver(e *entry[V], req request[K, V]) {
+	select {
+	case <-e.ready: // 等待 ready 状态
+		// 将结果发给客户端
+		req.response <- e.res
+	case <-req.ctx.Done():
+		// 通知 monitor goroutine，Close 之后就不必了
+		select {
+		case memo.abandons <- abandonment[K, V]{req.key, e}:
+		case <-memo.done:
+		}
+		var zero V
+		req.response <- result[V]{zero, req.ctx.Err()}
+	}
+}
+
+func (e *entry[V]) isReady() bool {
+	select {
+	case <-e.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// !- monitor
@@ -0,0 +1,92 @@
+package memo_test
+
+import (
+	"context"
+	"errors"
+	memo "gostudy/09、基于共享变量的并发/files/memo6"
+	"gostudy/09、基于共享变量的并发/files/memotest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+var httpGetBody = memotest.Typed[[]byte](memotest.HTTPGetBodyContext)
+
+func Test(t *testing.T) {
+	m := memo.New(httpGetBody)
+	defer m.Close()
+	memotest.Sequential(t, memotest.Adapt[[]byte](m))
+}
+
+func TestConcurrent(t *testing.T) {
+	m := memo.New(httpGetBody)
+	defer m.Close()
+	memotest.Concurrent(t, memotest.Adapt[[]byte](m))
+}
+
+// 一致性检查，使用 -race 运行
+func TestConformance(t *testing.T) {
+	memotest.RunContext(t, func(f memotest.ContextFunc) memotest.CM {
+		return memotest.AdaptContext[[]byte](memo.New(memotest.Typed[[]byte](f)))
+	})
+}
+
+// key 可以是结构体，值不需要类型断言
+func TestStructKey(t *testing.T) {
+	type point struct{ X, Y int }
+	var calls int32
+	m := memo.New(func(ctx context.Context, p point) (int, error) {
+		atomic.AddInt32(&calls, 1)
+		if p.X < 0 {
+			return 0, errors.New("negative")
+		}
+		return p.X * p.Y, nil
+	})
+	defer m.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if v, err := m.Get(point{3, 4}); err != nil || v != 12 {
+				t.Errorf("Get({3, 4}) = %d, %v, want 12, nil", v, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if v, err := m.Get(point{-1, 4}); err == nil || v != 0 {
+		t.Errorf("Get({-1, 4}) = %d, %v, want 0 and an error", v, err)
+	}
+	if n := atomic.LoadInt32(&calls); n != 2 {
+		t.Errorf("f called %d times, want 2", n)
+	}
+}
+
+// Typed 不会把类型不对的值悄悄地变成零值
+func TestTyped(t *testing.T) {
+	f := memotest.Typed[[]byte](func(ctx context.Context, key string) (interface{}, error) {
+		switch key {
+		case "string":
+			return "not bytes", nil
+		case "nil":
+			return nil, nil
+		case "error":
+			return 42, errors.New("failed")
+		}
+		return []byte(key), nil
+	})
+	if v, err := f(context.Background(), "ok"); err != nil || string(v) != "ok" {
+		t.Errorf(`f("ok") = %q, %v`, v, err)
+	}
+	if v, err := f(context.Background(), "string"); err == nil || v != nil || !strings.Contains(err.Error(), "value is string, want []uint8") {
+		t.Errorf(`f("string") = %q, %v, want a type error`, v, err)
+	}
+	if v, err := f(context.Background(), "nil"); err != nil || v != nil {
+		t.Errorf(`f("nil") = %q, %v, want nil, nil`, v, err)
+	}
+	if _, err := f(context.Background(), "error"); err == nil || err.Error() != "failed" {
+		t.Errorf(`f("error") = %v, want the error from f`, err)
+	}
+}
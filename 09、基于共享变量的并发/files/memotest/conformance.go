@@ -0,0 +1,118 @@
+package memotest
+
+import (
+	"context"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// maker 用 f 或 cf 创建一个缓存，两个函数的行为相同
+type maker func(f Func, cf ContextFunc) M
+
+// Run 对 newMemo 创建的缓存运行所有一致性检查：
+// 顺序和并发请求的结果、对重复请求的去重、错误的传递，以及 Close 之后的行为
+// 被测试的缓存必须是并发安全的，并发检查需要使用 -race 运行
+func Run(t *testing.T, newMemo func(f Func) M) {
+	run(t, func(f Func, _ ContextFunc) M { return newMemo(f) })
+}
+
+// RunContext 和 Run 相同，但用于支持取消的缓存，并且还会运行 Cancel
+func RunContext(t *testing.T, newMemo func(f ContextFunc) CM) {
+	run(t, func(_ Func, cf ContextFunc) M { return newMemo(cf) })
+	t.Run("Cancel", func(t *testing.T) { Cancel(t, newMemo) })
+}
+
+func run(t *testing.T, newMemo maker) {
+	for _, test := range []struct {
+		name  string
+		check func(*testing.T, M)
+	}{
+		{"Sequential", Sequential},
+		{"Concurrent", Concurrent},
+		{"Dedup", Dedup},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			m := newMemo(HTTPGetBody, HTTPGetBodyContext)
+			defer closeM(m)
+			test.check(t, m)
+		})
+	}
+	t.Run("Errors", func(t *testing.T) { checkErrors(t, newMemo) })
+	t.Run("Close", func(t *testing.T) { checkClose(t, newMemo) })
+}
+
+func closeM(m M) {
+	if c, ok := m.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
+
+// checkErrors 检查 f 的错误会返回给调用方，并且不影响其他 key
+func checkErrors(t *testing.T, newMemo maker) {
+	s := NewServer(ServerOptions{Fail: func(path string, n int) bool { return path == "/godoc" }})
+	defer s.Close()
+	m := newMemo(HTTPGetBody, HTTPGetBodyContext)
+	defer closeM(m)
+
+	for _, url := range s.URLs() {
+		value, err := m.Get(url)
+		if strings.HasSuffix(url, "/godoc") {
+			if err == nil || !strings.Contains(err.Error(), "500") {
+				t.Errorf("Get(%s) = %v, want a 500 error", url, err)
+			}
+			continue
+		}
+		if err != nil || string(value.([]byte)) != s.Body(url) {
+			t.Errorf("Get(%s) failed: %v", url, err)
+		}
+	}
+}
+
+// checkClose 检查 Close 不会等待正在进行的调用，这些调用在 Close 之后仍然返回正确的结果，
+// 并且 Close 之后缓存的 goroutine 都会退出
+func checkClose(t *testing.T, newMemo maker) {
+	baseline := runtime.NumGoroutine()
+	entered := make(chan struct{}, 10)
+	release := make(chan struct{})
+	f := func(key string) (interface{}, error) {
+		entered <- struct{}{}
+		<-release
+		return []byte(key), nil
+	}
+	m := newMemo(f, func(ctx context.Context, key string) (interface{}, error) { return f(key) })
+	closer, ok := m.(interface{ Close() })
+	if !ok {
+		t.Skip("no Close method")
+	}
+
+	// 只检查一个请求：其他等待同一个 entry 的请求何时被接受是无法观察到的，
+	// 在它们被接受之前调用 Close 是调用方的错误
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		value, err := m.Get("key")
+		if err != nil || string(value.([]byte)) != "key" {
+			t.Errorf("Get after Close = %v, %v, want key", value, err)
+		}
+	}()
+	wait(t, entered, "f to be called")
+
+	closed := make(chan struct{})
+	go func() {
+		closer.Close()
+		close(closed)
+	}()
+	wait(t, closed, "Close to return while a call is in progress")
+	close(release)
+	wait(t, done, "Get to return after Close")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines left after Close, want %d", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,153 @@
+package memotest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func httpGetBodyContext(ctx context.Context, url string) (interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return ioutil.ReadAll(resp.Body)
+}
+
+// HTTPGetBodyContext 和 HTTPGetBody 相同，但请求会在 ctx 被取消时中止
+var HTTPGetBodyContext = httpGetBodyContext
+
+// ContextFunc 是支持取消的 Func 的类型
+type ContextFunc = func(ctx context.Context, key string) (interface{}, error)
+
+// CM 是支持取消的 M
+type CM interface {
+	M
+	GetContext(ctx context.Context, key string) (interface{}, error)
+}
+
+// gatedServer 是一个本地 HTTP 服务器，每个请求都会阻塞到 release 被关闭或请求被取消
+type gatedServer struct {
+	*httptest.Server
+	calls    int32         // 收到的请求数
+	entered  chan struct{} // 每收到一个请求发送一次
+	canceled chan struct{} // 每有一个请求被取消发送一次
+	release  chan struct{}
+}
+
+func newGatedServer() *gatedServer {
+	s := &gatedServer{
+		entered:  make(chan struct{}, 100),
+		canceled: make(chan struct{}, 100),
+		release:  make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&s.calls, 1)
+		s.entered <- struct{}{}
+		select {
+		case <-s.release:
+			fmt.Fprint(w, "ok")
+		case <-r.Context().Done():
+			s.canceled <- struct{}{}
+		}
+	}))
+	return s
+}
+
+func (s *gatedServer) Calls() int { return int(atomic.LoadInt32(&s.calls)) }
+
+// wait 等待 ch 收到一个值，超时则使测试失败
+func wait(t *testing.T, ch <-chan struct{}, what string) {
+	t.Helper()
+	select {
+	case <-ch:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("timed out waiting for %s", what)
+	}
+}
+
+// Cancel 检查 GetContext 的取消语义：
+// 所有等待者都放弃时，f 的调用被取消，之后的请求会重试；
+// 只有部分等待者放弃时，其余等待者仍然得到结果，f 只被调用一次
+func Cancel(t *testing.T, newMemo func(f ContextFunc) CM) {
+	t.Run("AllWaitersCancel", func(t *testing.T) {
+		s := newGatedServer()
+		defer s.Close()
+		m := newMemo(HTTPGetBodyContext)
+		defer closeM(m)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		go func() {
+			<-s.entered
+			cancel()
+		}()
+		if _, err := m.GetContext(ctx, s.URL); !errors.Is(err, context.Canceled) {
+			t.Fatalf("GetContext after cancel: err = %v, want context.Canceled", err)
+		}
+		wait(t, s.canceled, "the underlying request to be canceled")
+
+		close(s.release)
+		value, err := m.Get(s.URL)
+		if err != nil {
+			t.Fatalf("Get after cancel: %v, want a retry", err)
+		}
+		if got := string(value.([]byte)); got != "ok" {
+			t.Errorf("Get = %q, want %q", got, "ok")
+		}
+		if got := s.Calls(); got != 2 {
+			t.Errorf("server called %d times, want 2", got)
+		}
+	})
+
+	t.Run("SomeWaitersCancel", func(t *testing.T) {
+		s := newGatedServer()
+		defer s.Close()
+		m := newMemo(HTTPGetBodyContext)
+		defer closeM(m)
+
+		type reply struct {
+			value interface{}
+			err   error
+		}
+		patient := make(chan reply, 1)
+		go func() {
+			v, err := m.Get(s.URL)
+			patient <- reply{v, err}
+		}()
+		wait(t, s.entered, "the first request")
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		if _, err := m.GetContext(ctx, s.URL); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("GetContext with timeout: err = %v, want context.DeadlineExceeded", err)
+		}
+
+		close(s.release)
+		r := <-patient
+		if r.err != nil || string(r.value.([]byte)) != "ok" {
+			t.Errorf("patient waiter got (%v, %v), want (ok, nil)", r.value, r.err)
+		}
+		if got := s.Calls(); got != 1 {
+			t.Errorf("server called %d times, want 1", got)
+		}
+		select {
+		case <-s.canceled:
+			t.Error("underlying request canceled while a waiter remained")
+		default:
+		}
+	})
+}
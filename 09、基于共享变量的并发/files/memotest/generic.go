@@ -0,0 +1,66 @@
+package memotest
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// Getter 是 key 为 string 的泛型缓存，例如 memo6 的 *Memo[string, []byte]
+type Getter[V any] interface {
+	Get(key string) (V, error)
+}
+
+// ContextGetter 是支持取消的 Getter
+type ContextGetter[V any] interface {
+	Getter[V]
+	GetContext(ctx context.Context, key string) (V, error)
+}
+
+// Adapt 把 Getter 转换为 M，以便运行 Sequential 和 Concurrent
+func Adapt[V any](g Getter[V]) M {
+	return adapter[V]{g}
+}
+
+// AdaptContext 把 ContextGetter 转换为 CM，以便运行 Cancel
+func AdaptContext[V any](g ContextGetter[V]) CM {
+	return contextAdapter[V]{adapter[V]{g}, g}
+}
+
+// Typed 把返回 interface{} 的 ContextFunc 转换为返回 V 的函数，例如：
+//
+//	memo.New(memotest.Typed[[]byte](memotest.HTTPGetBodyContext))
+//
+// f 返回 nil 时结果是 V 的零值；f 成功返回了其他类型的值时，结果是一个错误，而不是悄悄地变成零值
+func Typed[V any](f ContextFunc) func(ctx context.Context, key string) (V, error) {
+	return func(ctx context.Context, key string) (V, error) {
+		value, err := f(ctx, key)
+		v, ok := value.(V)
+		if !ok && value != nil && err == nil {
+			err = fmt.Errorf("memotest: %s: value is %T, want %v", key, value, reflect.TypeOf(&v).Elem())
+		}
+		return v, err
+	}
+}
+
+type adapter[V any] struct{ g Getter[V] }
+
+func (a adapter[V]) Get(key string) (interface{}, error) {
+	return a.g.Get(key)
+}
+
+// Close 关闭底层的缓存，如果它有 Close 方法的话
+func (a adapter[V]) Close() {
+	if c, ok := a.g.(interface{ Close() }); ok {
+		c.Close()
+	}
+}
+
+type contextAdapter[V any] struct {
+	adapter[V]
+	g ContextGetter[V]
+}
+
+func (a contextAdapter[V]) GetContext(ctx context.Context, key string) (interface{}, error) {
+	return a.g.GetContext(ctx, key)
+}
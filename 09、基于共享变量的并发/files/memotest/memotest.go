@@ -1,10 +1,10 @@
 // Package memotest 提供测试 memo 包各种设计的通用功能
+// 所有测试都使用本地的 httptest 服务器，不需要访问网络
 package memotest
 
 import (
 	"fmt"
 	"io/ioutil"
-	"log"
 	"net/http"
 	"sync"
 	"testing"
@@ -17,65 +17,102 @@ func httpGetBody(url string) (interface{}, error) {
 		return nil, err
 	}
 	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", url, resp.Status)
+	}
 	return ioutil.ReadAll(resp.Body)
 }
 
-// HTTPGetBody *
+// HTTPGetBody 返回 url 的内容，状态码不是 200 时返回错误
 var HTTPGetBody = httpGetBody
 
-func incomingURLs() <-chan string {
+// Func 是 memo1 到 memo3 的 Func 的类型
+type Func = func(key string) (interface{}, error)
+
+// M *
+type M interface {
+	Get(key string) (interface{}, error)
+}
+
+// incomingURLs 返回 s 的每个 URL 两次
+func incomingURLs(s *Server) <-chan string {
 	ch := make(chan string)
 	go func() {
-		for _, url := range []string{
-			"https://golang.org",
-			"https://godoc.org",
-			"https://play.golang.org",
-			"https://gopl.io",
-			"https://golang.org",
-			"https://godoc.org",
-			"https://play.golang.org",
-			"https://gopl.io",
-		} {
-			ch <- url
+		for i := 0; i < 2; i++ {
+			for _, url := range s.URLs() {
+				ch <- url
+			}
 		}
 		close(ch)
 	}()
 	return ch
 }
 
-// M *
-type M interface {
-	Get(key string) (interface{}, error)
+// get 请求 url，检查结果与 s 返回的内容相同
+func get(t *testing.T, s *Server, m M, url string) {
+	start := time.Now()
+	value, err := m.Get(url)
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	body, ok := value.([]byte)
+	if !ok || string(body) != s.Body(url) {
+		t.Errorf("Get(%s) = %.20q..., want %.20q...", url, value, s.Body(url))
+		return
+	}
+	t.Logf("%s, %s, %d bytes", url, time.Since(start), len(body))
 }
 
 // Sequential 顺序的
+// m 必须使用 HTTPGetBody 或 HTTPGetBodyContext 创建，每个 URL 都应当只请求服务器一次
 func Sequential(t *testing.T, m M) {
-	for url := range incomingURLs() {
-		start := time.Now()
-		value, err := m.Get(url)
-		if err != nil {
-			log.Print(err)
-			continue
+	s := NewServer(ServerOptions{})
+	defer s.Close()
+	for url := range incomingURLs(s) {
+		get(t, s, m, url)
+	}
+	for _, url := range s.URLs() {
+		if n := s.Calls(url); n != 1 {
+			t.Errorf("%s fetched %d times, want 1", url, n)
 		}
-		fmt.Printf("%s, %s, %d bytes\n", url, time.Since(start), len(value.([]byte)))
 	}
 }
 
 // Concurrent 并发的
+// 只检查结果是否正确，需要使用 -race 运行来检查并发安全
 func Concurrent(t *testing.T, m M) {
+	s := NewServer(ServerOptions{Latency: 10 * time.Millisecond})
+	defer s.Close()
 	var n sync.WaitGroup
-	for url := range incomingURLs() {
+	for url := range incomingURLs(s) {
 		n.Add(1)
 		go func(url string) {
 			defer n.Done()
-			start := time.Now()
-			value, err := m.Get(url)
-			if err != nil {
-				log.Print(err)
-				return
-			}
-			fmt.Printf("%s, %s, %d bytes\n", url, time.Since(start), len(value.([]byte)))
+			get(t, s, m, url)
 		}(url)
 	}
 	n.Wait()
 }
+
+// Dedup 检查对同一个 URL 的并发请求只调用一次 f
+func Dedup(t *testing.T, m M) {
+	s := NewServer(ServerOptions{Latency: 50 * time.Millisecond})
+	defer s.Close()
+	var n sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		for _, url := range s.URLs() {
+			n.Add(1)
+			go func(url string) {
+				defer n.Done()
+				get(t, s, m, url)
+			}(url)
+		}
+	}
+	n.Wait()
+	for _, url := range s.URLs() {
+		if n := s.Calls(url); n != 1 {
+			t.Errorf("%s fetched %d times, want 1", url, n)
+		}
+	}
+}
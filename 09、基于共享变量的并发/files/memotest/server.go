@@ -0,0 +1,80 @@
+package memotest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ServerOptions 配置测试服务器
+type ServerOptions struct {
+	Latency time.Duration // 每个请求的延迟
+	// Fail 决定对 path 的第 n 次请求（从 1 开始）是否返回 500，为 nil 时所有请求都成功
+	Fail func(path string, n int) bool
+}
+
+// Server 是一个本地 HTTP 服务器，代替原来测试中访问的网站
+// 它记录每个 URL 被请求的次数，用来检查 f 被调用了几次
+type Server struct {
+	*httptest.Server
+	opts  ServerOptions
+	mu    sync.Mutex
+	calls map[string]int
+}
+
+// paths 是服务器提供的页面，内容的长度各不相同
+var paths = []string{"/golang", "/godoc", "/play", "/gopl"}
+
+// NewServer 启动一个测试服务器，客户端必须随后调用 Close
+func NewServer(opts ServerOptions) *Server {
+	s := &Server{opts: opts, calls: make(map[string]int)}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.calls[r.URL.Path]++
+	n := s.calls[r.URL.Path]
+	s.mu.Unlock()
+
+	if s.opts.Latency > 0 {
+		select {
+		case <-time.After(s.opts.Latency):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if s.opts.Fail != nil && s.opts.Fail(r.URL.Path, n) {
+		http.Error(w, "injected failure", http.StatusInternalServerError)
+		return
+	}
+	w.Write([]byte(body(r.URL.Path)))
+}
+
+func body(path string) string {
+	return strings.Repeat(path+"\n", 100*len(path))
+}
+
+// URLs 返回服务器提供的所有页面的 URL
+func (s *Server) URLs() []string {
+	var urls []string
+	for _, p := range paths {
+		urls = append(urls, s.URL+p)
+	}
+	return urls
+}
+
+// Body 返回 url 的内容
+func (s *Server) Body(url string) string {
+	return body(strings.TrimPrefix(url, s.URL))
+}
+
+// Calls 返回 url 被请求的次数
+func (s *Server) Calls(url string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[strings.TrimPrefix(url, s.URL)]
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"log"
+	"sort"
+	"time"
+)
+
+// Daemon 定期扫描用量，然后检查每个用户的配额
+type Daemon struct {
+	Scanner  *Scanner
+	Checker  *Checker
+	Interval time.Duration
+	// Users 返回除扫描到的用户之外还需要检查的用户，例如配置文件中列出的用户，可以为 nil
+	Users func() []string
+	// Logf 记录扫描和通知的错误，nil 表示 log.Printf
+	Logf func(format string, args ...interface{})
+
+	last []string // 上一轮级别不是 OK 的用户
+}
+
+// Run 立即执行一轮，之后每隔 Interval 执行一轮，直到 ctx 被取消
+func (d *Daemon) Run(ctx context.Context) error {
+	ticker := time.NewTicker(d.Interval)
+	defer ticker.Stop()
+	for {
+		d.RunOnce(ctx)
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// RunOnce 扫描一次并检查所有用户的配额，返回每个用户的级别
+// 扫描被取消时不检查配额，返回 nil
+func (d *Daemon) RunOnce(ctx context.Context) map[string]Level {
+	logf := d.Logf
+	if logf == nil {
+		logf = log.Printf
+	}
+	if err := d.Scanner.Scan(ctx); err != nil {
+		logf("scan: %v", err)
+		return nil
+	}
+	if st := d.Scanner.Stats(); st.Errors > 0 {
+		logf("scan: %d directories unreadable, first error: %v", st.Errors, st.Err)
+	}
+
+	// 上一轮的用户也要检查：文件全部被删除的用户不会出现在扫描结果中，但他们的提醒状态需要清除
+	users := append(d.Scanner.Users(), d.last...)
+	if d.Users != nil {
+		users = append(users, d.Users()...)
+	}
+	sort.Strings(users)
+	levels := make(map[string]Level)
+	for _, user := range users {
+		if _, ok := levels[user]; ok {
+			continue // 重复的用户
+		}
+		level, err := d.Checker.CheckQuota(user)
+		if err != nil {
+			logf("notify %s: %v", user, err)
+		}
+		levels[user] = level
+	}
+	d.last = d.last[:0]
+	for user, level := range levels {
+		if level != OK {
+			d.last = append(d.last, user)
+		}
+	}
+	return levels
+}
@@ -0,0 +1,191 @@
+package storage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level 是用量相对配额的级别
+type Level int
+
+const (
+	OK       Level = iota
+	Warn           // 默认 80%
+	Critical       // 默认 95%
+	Block          // 默认 100%，调用方应拒绝新的写入
+)
+
+var levelNames = [...]string{"ok", "warn", "critical", "block"}
+
+func (l Level) String() string {
+	if l >= 0 && int(l) < len(levelNames) {
+		return levelNames[l]
+	}
+	return fmt.Sprintf("Level(%d)", int(l))
+}
+
+// MarshalJSON 把级别编码为名字，例如 "warn"
+func (l Level) MarshalJSON() ([]byte, error) {
+	return json.Marshal(l.String())
+}
+
+// UnmarshalJSON 解码 MarshalJSON 的结果
+func (l *Level) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err != nil {
+		return err
+	}
+	for i, n := range levelNames {
+		if n == name {
+			*l = Level(i)
+			return nil
+		}
+	}
+	return fmt.Errorf("storage: unknown level %q", name)
+}
+
+// Notice 是发给用户的一条配额提醒
+type Notice struct {
+	User    string    `json:"user"`
+	Level   Level     `json:"level"`
+	Used    int64     `json:"used"`
+	Quota   int64     `json:"quota"`
+	Percent int64     `json:"percent"`
+	Time    time.Time `json:"time"`
+}
+
+const template = `Warning: you are using %d bytes of storage, %d%% of your quota.`
+
+// Message 返回提醒的正文，与 storage1 的邮件内容相同，超过 Critical 时附加一句说明
+func (n Notice) Message() string {
+	msg := fmt.Sprintf(template, n.Used, n.Percent)
+	switch n.Level {
+	case Critical:
+		msg += " Writes will be blocked when the quota is reached."
+	case Block:
+		msg += " Writes are blocked until usage is reduced."
+	}
+	return msg
+}
+
+// Notifier 把提醒发给用户，Notify 需要是并发安全的
+type Notifier interface {
+	Notify(n Notice) error
+}
+
+// !+ SMTP
+
+// SMTPNotifier 通过 SMTP 发送邮件，收件人为用户名（storage1 中用户名就是邮件地址）
+// Auth 为 nil 时不认证；smtp.PlainAuth 只允许在 TLS 连接或 localhost 上使用
+type SMTPNotifier struct {
+	Addr string // 服务器地址，例如 "smtp.example.com:587"
+	Auth smtp.Auth
+	From string
+}
+
+// Notify 发送一封邮件
+func (s *SMTPNotifier) Notify(n Notice) error {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", s.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", n.User)
+	fmt.Fprintf(&msg, "Subject: Storage quota %s\r\n", n.Level)
+	fmt.Fprintf(&msg, "\r\n%s\r\n", n.Message())
+	if err := smtp.SendMail(s.Addr, s.Auth, s.From, []string{n.User}, msg.Bytes()); err != nil {
+		return fmt.Errorf("smtp.SendMail(%s): %v", n.User, err)
+	}
+	return nil
+}
+
+// !- SMTP
+
+// !+ webhook
+
+// WebhookNotifier 把提醒以 JSON 格式 POST 到 URL，非 2xx 的响应视为失败
+type WebhookNotifier struct {
+	URL    string
+	Client *http.Client // nil 表示 http.DefaultClient
+}
+
+// Notify 发送一个 POST 请求
+func (w *WebhookNotifier) Notify(n Notice) error {
+	body, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+	client := w.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Post(w.URL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		return fmt.Errorf("webhook %s: %s", w.URL, resp.Status)
+	}
+	return nil
+}
+
+// !- webhook
+
+// LogNotifier 把提醒写入日志，Logger 为 nil 时使用 log 包的标准 logger
+type LogNotifier struct {
+	Logger *log.Logger
+}
+
+// Notify 写一行日志
+func (l *LogNotifier) Notify(n Notice) error {
+	line := fmt.Sprintf("quota %s for %s: %s", n.Level, n.User, n.Message())
+	if l.Logger == nil {
+		log.Print(line)
+	} else {
+		l.Logger.Print(line)
+	}
+	return nil
+}
+
+// MemoryNotifier 把提醒保存在内存中，用于测试
+type MemoryNotifier struct {
+	mu      sync.Mutex
+	notices []Notice
+}
+
+// Notify 记录提醒
+func (m *MemoryNotifier) Notify(n Notice) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.notices = append(m.notices, n)
+	return nil
+}
+
+// Notices 返回记录的提醒的副本
+func (m *MemoryNotifier) Notices() []Notice {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Notice(nil), m.notices...)
+}
+
+// Multi 把提醒依次发给所有 Notifier，返回遇到的所有错误
+type Multi []Notifier
+
+// Notify 发给每个 Notifier，一个失败不影响其他的
+func (m Multi) Notify(n Notice) error {
+	var errs []string
+	for _, nf := range m {
+		if err := nf.Notify(n); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if errs != nil {
+		return fmt.Errorf("storage: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/smtp"
+	"strings"
+	"testing"
+	"time"
+)
+
+var notice = Notice{User: "joe@example.com", Level: Critical, Used: 960, Quota: 1000, Percent: 96}
+
+// smtpServer 是一个只接收邮件的本地 SMTP 服务器，它把收到的邮件发送到 mails
+type smtpServer struct {
+	l     net.Listener
+	mails chan mail
+}
+
+type mail struct {
+	auth, from string
+	to         []string
+	data       string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{l, make(chan mail, 10)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go s.handleConn(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpServer) handleConn(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(format string, args ...interface{}) {
+		fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	reply("220 localhost fake SMTP")
+	var m mail
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case "AUTH":
+			// AUTH PLAIN base64("\x00user\x00password")
+			fields := strings.Fields(line)
+			b, _ := base64.StdEncoding.DecodeString(fields[len(fields)-1])
+			m.auth = string(b)
+			reply("235 authenticated")
+		case "MAIL":
+			m.from = line[len("MAIL FROM:"):]
+			reply("250 ok")
+		case "RCPT":
+			m.to = append(m.to, line[len("RCPT TO:"):])
+			reply("250 ok")
+		case "DATA":
+			reply("354 go ahead")
+			var data bytes.Buffer
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			m.data = data.String()
+			s.mails <- m
+			m = mail{}
+			reply("250 queued")
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPNotifier(t *testing.T) {
+	srv := newSMTPServer(t)
+	defer srv.l.Close()
+	addr := srv.l.Addr().String()
+	host, _, _ := net.SplitHostPort(addr)
+
+	n := &SMTPNotifier{
+		Addr: addr,
+		Auth: smtp.PlainAuth("", "notifications@example.com", "correcthorsebatterystaple", host),
+		From: "notifications@example.com",
+	}
+	if err := n.Notify(notice); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case m := <-srv.mails:
+		if m.auth != "\x00notifications@example.com\x00correcthorsebatterystaple" {
+			t.Errorf("auth = %q", m.auth)
+		}
+		if m.from != "<notifications@example.com>" || len(m.to) != 1 || m.to[0] != "<joe@example.com>" {
+			t.Errorf("from %s to %v", m.from, m.to)
+		}
+		for _, want := range []string{"Subject: Storage quota critical", "96% of your quota"} {
+			if !strings.Contains(m.data, want) {
+				t.Errorf("mail does not contain %q:\n%s", want, m.data)
+			}
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("no mail received")
+	}
+
+	// 服务器不可用时返回错误
+	srv.l.Close()
+	if err := n.Notify(notice); err == nil {
+		t.Error("Notify succeeded after server closed")
+	}
+}
+
+func TestWebhookNotifier(t *testing.T) {
+	var got Notice
+	status := http.StatusOK
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Error(err)
+		}
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	n := &WebhookNotifier{URL: srv.URL}
+	if err := n.Notify(notice); err != nil {
+		t.Fatal(err)
+	}
+	if got != notice {
+		t.Errorf("webhook received %+v, want %+v", got, notice)
+	}
+	status = http.StatusInternalServerError
+	if err := n.Notify(notice); err == nil {
+		t.Error("Notify succeeded on 500 response")
+	}
+}
+
+func TestLogNotifier(t *testing.T) {
+	var buf bytes.Buffer
+	n := &LogNotifier{Logger: log.New(&buf, "", 0)}
+	n.Notify(notice)
+	const want = "quota critical for joe@example.com: Warning: you are using 960 bytes"
+	if !strings.HasPrefix(buf.String(), want) {
+		t.Errorf("log = %q, want prefix %q", buf.String(), want)
+	}
+}
+
+func TestMulti(t *testing.T) {
+	var m MemoryNotifier
+	var f failingNotifier
+	if err := (Multi{&f, &m}).Notify(notice); err == nil {
+		t.Error("Multi.Notify succeeded, want error")
+	}
+	if len(m.Notices()) != 1 {
+		t.Error("failing notifier prevented later notifiers")
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !unix
+
+package storage
+
+import "os"
+
+// fileOwner 在不是 Unix 的系统上不可用，请使用 ByTopDir
+func fileOwner(fi os.FileInfo) (uint32, bool) { return 0, false }
@@ -0,0 +1,303 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Thresholds 是各级别的百分比，0 表示沿用上一级配置的值
+type Thresholds struct {
+	Warn     int64 `json:"warn"`
+	Critical int64 `json:"critical"`
+	Block    int64 `json:"block"`
+}
+
+// Duration 在 JSON 中写作 time.ParseDuration 能解析的字符串，例如 "24h"
+type Duration time.Duration
+
+// UnmarshalJSON 解析 "24h" 这样的字符串
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(v)
+	return nil
+}
+
+// MarshalJSON 把 d 编码为字符串
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// Policy 是一个用户的配额策略，零值字段表示沿用上一级配置的值
+type Policy struct {
+	Quota      int64      `json:"quota"` // 字节数
+	Thresholds Thresholds `json:"thresholds"`
+	Cooldown   Duration   `json:"cooldown"` // 同一级别的两次提醒之间至少间隔多久
+}
+
+// DefaultPolicy 是 storage1 中写死的配额：1GB，但级别改为 80%、95% 和 100%，每天最多提醒一次
+var DefaultPolicy = Policy{
+	Quota:      1000000000,
+	Thresholds: Thresholds{Warn: 80, Critical: 95, Block: 100},
+	Cooldown:   Duration(24 * time.Hour),
+}
+
+// over 返回用 q 中的非零字段覆盖 p 的结果
+func (p Policy) over(q Policy) Policy {
+	if q.Quota != 0 {
+		p.Quota = q.Quota
+	}
+	if q.Thresholds.Warn != 0 {
+		p.Thresholds.Warn = q.Thresholds.Warn
+	}
+	if q.Thresholds.Critical != 0 {
+		p.Thresholds.Critical = q.Thresholds.Critical
+	}
+	if q.Thresholds.Block != 0 {
+		p.Thresholds.Block = q.Thresholds.Block
+	}
+	if q.Cooldown != 0 {
+		p.Cooldown = q.Cooldown
+	}
+	return p
+}
+
+// Level 返回用量 used 的级别和百分比，Quota 为 0 表示不限制
+func (p Policy) Level(used int64) (Level, int64) {
+	if p.Quota <= 0 {
+		return OK, 0
+	}
+	percent := 100 * used / p.Quota
+	switch t := p.Thresholds; {
+	case t.Block > 0 && percent >= t.Block:
+		return Block, percent
+	case t.Critical > 0 && percent >= t.Critical:
+		return Critical, percent
+	case t.Warn > 0 && percent >= t.Warn:
+		return Warn, percent
+	}
+	return OK, percent
+}
+
+// Group 是共用一个策略的一组用户
+type Group struct {
+	Name    string   `json:"name"`
+	Members []string `json:"members"`
+	Policy
+}
+
+// Config 是配额配置文件的内容，例如：
+//
+//	{
+//	  "default": {"quota": 1000000000, "cooldown": "24h"},
+//	  "groups": [
+//	    {"name": "staff", "members": ["alice@example.com"], "quota": 5000000000}
+//	  ],
+//	  "users": {
+//	    "bob@example.com": {"quota": 2000000000, "thresholds": {"warn": 70}}
+//	  }
+//	}
+//
+// 用户的策略依次由 DefaultPolicy、default、用户所在的第一个组和 users 中的配置叠加而成
+type Config struct {
+	Default Policy            `json:"default"`
+	Groups  []Group           `json:"groups"`
+	Users   map[string]Policy `json:"users"`
+}
+
+// LoadConfig 读取并检查配置文件
+func LoadConfig(filename string) (*Config, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	c, err := ParseConfig(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", filename, err)
+	}
+	return c, nil
+}
+
+// ParseConfig 从 r 中读取并检查配置
+func ParseConfig(r io.Reader) (*Config, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	var c Config
+	if err := dec.Decode(&c); err != nil {
+		return nil, err
+	}
+	check := func(who string, p Policy) error {
+		if p.Quota < 0 || p.Cooldown < 0 {
+			return fmt.Errorf("%s: negative quota or cooldown", who)
+		}
+		return nil
+	}
+	// 叠加后的级别必须递增，否则较高的级别永远不会到达
+	increasing := func(who string, p Policy) error {
+		if t := p.Thresholds; !(t.Warn <= t.Critical && t.Critical <= t.Block) {
+			return fmt.Errorf("%s: thresholds %+v not increasing", who, t)
+		}
+		return nil
+	}
+	if err := check("default", c.Default); err != nil {
+		return nil, err
+	}
+	if err := increasing("default", DefaultPolicy.over(c.Default)); err != nil {
+		return nil, err
+	}
+	for _, g := range c.Groups {
+		if err := check("group "+g.Name, g.Policy); err != nil {
+			return nil, err
+		}
+		for _, user := range g.Members {
+			if err := increasing("group "+g.Name, c.Policy(user)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for user, p := range c.Users {
+		if err := check("user "+user, p); err != nil {
+			return nil, err
+		}
+		if err := increasing("user "+user, c.Policy(user)); err != nil {
+			return nil, err
+		}
+	}
+	return &c, nil
+}
+
+// Policy 返回用户 user 的策略，c 为 nil 时返回 DefaultPolicy
+func (c *Config) Policy(user string) Policy {
+	p := DefaultPolicy
+	if c == nil {
+		return p
+	}
+	p = p.over(c.Default)
+	for _, g := range c.Groups {
+		if contains(g.Members, user) {
+			p = p.over(g.Policy)
+			break
+		}
+	}
+	if u, ok := c.Users[user]; ok {
+		p = p.over(u)
+	}
+	return p
+}
+
+func contains(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Usage 报告用户使用的字节数
+type Usage interface {
+	BytesInUse(user string) int64
+}
+
+// MapUsage 是手工填写的用量，与 storage2 的 usage 变量相同
+type MapUsage map[string]int64
+
+// BytesInUse 返回 m[user]
+func (m MapUsage) BytesInUse(user string) int64 { return m[user] }
+
+// Checker 检查用户的配额并发送提醒
+// 用户的级别上升时立即提醒；级别不变时，距上次提醒不足 Cooldown 就不再提醒
+// 用量回到 Warn 以下后状态被清除，下次超过时重新提醒
+type Checker struct {
+	usage    Usage
+	notifier Notifier
+	now      func() time.Time // 测试时可以替换
+
+	mu     sync.Mutex // 守护以下字段
+	config *Config
+	state  map[string]*userState
+}
+
+type userState struct {
+	level Level     // 上次检查时的级别
+	sent  time.Time // 上次提醒的时间，零值表示需要重新提醒
+}
+
+// NewChecker 返回一个 Checker，config 为 nil 时所有用户使用 DefaultPolicy
+func NewChecker(config *Config, usage Usage, notifier Notifier) *Checker {
+	return &Checker{
+		usage:    usage,
+		notifier: notifier,
+		now:      time.Now,
+		config:   config,
+		state:    make(map[string]*userState),
+	}
+}
+
+// SetConfig 替换配置，例如在重新读取配置文件之后，已有的提醒状态保留
+func (c *Checker) SetConfig(config *Config) {
+	c.mu.Lock()
+	c.config = config
+	c.mu.Unlock()
+}
+
+// CheckQuota 检查用户的用量，必要时发送提醒，返回当前级别
+// 返回的错误来自 Notifier，发送失败的提醒会在下次检查时重试
+func (c *Checker) CheckQuota(user string) (Level, error) {
+	used := c.usage.BytesInUse(user)
+	now := c.now()
+
+	c.mu.Lock()
+	p := c.config.Policy(user)
+	level, percent := p.Level(used)
+	st := c.state[user]
+	if level == OK {
+		delete(c.state, user)
+		c.mu.Unlock()
+		return OK, nil
+	}
+	if st == nil {
+		st = new(userState)
+		c.state[user] = st
+	}
+	notify := level > st.level || st.sent.IsZero() || now.Sub(st.sent) >= time.Duration(p.Cooldown)
+	st.level = level
+	if notify {
+		st.sent = now
+	}
+	c.mu.Unlock()
+
+	if !notify {
+		return level, nil
+	}
+	err := c.notifier.Notify(Notice{
+		User: user, Level: level, Used: used, Quota: p.Quota, Percent: percent, Time: now,
+	})
+	if err != nil {
+		c.mu.Lock()
+		if c.state[user] == st && st.sent.Equal(now) {
+			st.sent = time.Time{}
+		}
+		c.mu.Unlock()
+	}
+	return level, err
+}
+
+// Blocked 报告上次检查时用户的用量是否达到了 Block 级别
+func (c *Checker) Blocked(user string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	st := c.state[user]
+	return st != nil && st.level == Block
+}
@@ -0,0 +1,146 @@
+package storage
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// 与 storage2 的 TestCheckQuotaNotifiesUser 相同，但不需要替换包级变量
+func TestCheckQuotaNotifiesUser(t *testing.T) {
+	const user = "joe@example.com"
+	var n MemoryNotifier
+	c := NewChecker(nil, MapUsage{user: 980000000}, &n) // 模拟 980MB 的使用情况
+
+	if level, err := c.CheckQuota(user); level != Critical || err != nil {
+		t.Fatalf("CheckQuota = %v, %v; want critical", level, err)
+	}
+	notices := n.Notices()
+	if len(notices) != 1 {
+		t.Fatalf("got %d notices, want 1", len(notices))
+	}
+	if notices[0].User != user {
+		t.Errorf("wrong user (%s) notified, want %s", notices[0].User, user)
+	}
+	const wantSubString = "98% of your quota"
+	if msg := notices[0].Message(); !strings.Contains(msg, wantSubString) {
+		t.Errorf("unexpected notification message <<%s>>, want substring %q", msg, wantSubString)
+	}
+}
+
+// fakeNow 返回一个可以手动推进的时钟
+func fakeNow(c *Checker) func(time.Duration) {
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	c.now = func() time.Time { return now }
+	return func(d time.Duration) { now = now.Add(d) }
+}
+
+func TestThresholdsAndCooldown(t *testing.T) {
+	const user = "joe@example.com"
+	usage := MapUsage{}
+	var n MemoryNotifier
+	c := NewChecker(nil, usage, &n)
+	advance := fakeNow(c)
+
+	steps := []struct {
+		advance time.Duration
+		used    int64
+		level   Level
+		notify  bool
+	}{
+		{0, 500000000, OK, false},
+		{time.Hour, 810000000, Warn, true},
+		{time.Hour, 820000000, Warn, false},    // 冷却中
+		{time.Hour, 960000000, Critical, true}, // 级别上升，立即提醒
+		{time.Hour, 970000000, Critical, false},
+		{24 * time.Hour, 970000000, Critical, true}, // 冷却结束
+		{time.Hour, 1000000000, Block, true},
+		{time.Hour, 850000000, Warn, false}, // 级别下降不提醒
+		{time.Hour, 100000000, OK, false},
+		{time.Hour, 810000000, Warn, true}, // 回到 OK 之后重新开始
+	}
+	for i, step := range steps {
+		advance(step.advance)
+		usage[user] = step.used
+		before := len(n.Notices())
+		level, err := c.CheckQuota(user)
+		if err != nil {
+			t.Fatal(err)
+		}
+		notified := len(n.Notices()) > before
+		if level != step.level || notified != step.notify {
+			t.Errorf("step %d: used %d: level %v, notified %t; want %v, %t",
+				i, step.used, level, notified, step.level, step.notify)
+		}
+		if got, want := c.Blocked(user), step.level == Block; got != want {
+			t.Errorf("step %d: Blocked = %t, want %t", i, got, want)
+		}
+	}
+}
+
+type failingNotifier struct{ calls int }
+
+func (f *failingNotifier) Notify(Notice) error {
+	f.calls++
+	return errors.New("mail server down")
+}
+
+// 发送失败的提醒在下次检查时重试，不受冷却限制
+func TestNotifyFailureRetries(t *testing.T) {
+	var f failingNotifier
+	c := NewChecker(nil, MapUsage{"joe": 900000000}, &f)
+	fakeNow(c)
+	for i := 0; i < 3; i++ {
+		if _, err := c.CheckQuota("joe"); err == nil {
+			t.Fatal("CheckQuota succeeded, want error")
+		}
+	}
+	if f.calls != 3 {
+		t.Errorf("Notify called %d times, want 3", f.calls)
+	}
+}
+
+const config = `{
+  "default": {"quota": 1000, "cooldown": "1h"},
+  "groups": [
+    {"name": "staff", "members": ["alice", "bob"], "quota": 5000, "thresholds": {"warn": 50}},
+    {"name": "everyone", "members": ["alice", "carol"], "quota": 9999}
+  ],
+  "users": {
+    "bob": {"quota": 2000, "cooldown": "10m"}
+  }
+}`
+
+func TestConfig(t *testing.T) {
+	c, err := ParseConfig(strings.NewReader(config))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hour, tenMinutes := Duration(time.Hour), Duration(10*time.Minute)
+	for _, test := range []struct {
+		user string
+		want Policy
+	}{
+		{"dave", Policy{1000, Thresholds{80, 95, 100}, hour}},
+		{"alice", Policy{5000, Thresholds{50, 95, 100}, hour}}, // 第一个匹配的组
+		{"carol", Policy{9999, Thresholds{80, 95, 100}, hour}},
+		{"bob", Policy{2000, Thresholds{50, 95, 100}, tenMinutes}}, // 组，然后是用户
+	} {
+		if got := c.Policy(test.user); got != test.want {
+			t.Errorf("Policy(%s) = %+v, want %+v", test.user, got, test.want)
+		}
+	}
+
+	for _, bad := range []string{
+		`{"default": {"quota": -1}}`,
+		`{"default": {"cooldown": "soon"}}`,
+		`{"users": {"joe": {"thresholds": {"critical": 99, "block": 90}}}}`,
+		`{"groups": [{"name": "g", "members": ["joe"], "thresholds": {"warn": 96}}]}`,
+		`{"defaults": {}}`,
+	} {
+		if _, err := ParseConfig(strings.NewReader(bad)); err == nil {
+			t.Errorf("ParseConfig(%s) succeeded, want error", bad)
+		}
+	}
+}
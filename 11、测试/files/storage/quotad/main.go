@@ -0,0 +1,99 @@
+// quotad 定期扫描家目录，检查每个用户的配额并发送提醒
+// go run quotad/main.go -by dir -interval 10m -notify log /home
+// go run quotad/main.go -config quota.json -notify smtp -smtp smtp.example.com:587 -from notifications@example.com /home
+// SMTP 密码从环境变量 QUOTAD_SMTP_PASSWORD 读取；发送 SIGHUP 重新读取配置文件
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"gostudy/11、测试/files/storage"
+)
+
+var (
+	configFile = flag.String("config", "", "配额配置文件，为空时所有用户使用默认配额")
+	by         = flag.String("by", "owner", "按文件所有者（owner）或第一级目录名（dir）统计用量")
+	interval   = flag.Duration("interval", 10*time.Minute, "扫描间隔")
+	fullEvery  = flag.Int("full-every", 6, "每隔多少次扫描做一次完整扫描")
+	notify     = flag.String("notify", "log", "提醒方式：log、smtp 或 webhook")
+	smtpAddr   = flag.String("smtp", "", "SMTP 服务器地址")
+	from       = flag.String("from", "", "发件人，同时用作 SMTP 用户名")
+	webhook    = flag.String("webhook", "", "webhook 的 URL")
+)
+
+func main() {
+	flag.Parse()
+	log.SetPrefix("quotad: ")
+
+	opts := storage.ScanOptions{Roots: flag.Args(), FullScanEvery: *fullEvery}
+	if len(opts.Roots) == 0 {
+		opts.Roots = []string{"/home"}
+	}
+	switch *by {
+	case "owner":
+		opts.By = storage.ByOwner
+	case "dir":
+		opts.By = storage.ByTopDir
+	default:
+		log.Fatalf("unknown -by %q", *by)
+	}
+
+	var notifier storage.Notifier
+	switch *notify {
+	case "log":
+		notifier = &storage.LogNotifier{}
+	case "smtp":
+		var auth smtp.Auth
+		if password := os.Getenv("QUOTAD_SMTP_PASSWORD"); password != "" {
+			host, _, _ := net.SplitHostPort(*smtpAddr)
+			auth = smtp.PlainAuth("", *from, password, host)
+		}
+		notifier = &storage.SMTPNotifier{Addr: *smtpAddr, Auth: auth, From: *from}
+	case "webhook":
+		notifier = &storage.WebhookNotifier{URL: *webhook}
+	default:
+		log.Fatalf("unknown -notify %q", *notify)
+	}
+
+	config, err := loadConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+	scanner := storage.NewScanner(opts)
+	checker := storage.NewChecker(config, scanner, notifier)
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			c, err := loadConfig()
+			if err != nil {
+				log.Print(err) // 继续使用原来的配置
+				continue
+			}
+			checker.SetConfig(c)
+			log.Print("config reloaded")
+		}
+	}()
+
+	d := &storage.Daemon{Scanner: scanner, Checker: checker, Interval: *interval}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	d.Run(ctx)
+}
+
+// loadConfig 读取 -config，没有指定时返回 nil，即所有用户使用默认配额
+func loadConfig() (*storage.Config, error) {
+	if *configFile == "" {
+		return nil, nil
+	}
+	return storage.LoadConfig(*configFile)
+}
@@ -0,0 +1,277 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Attribution 决定文件算在哪个用户名下
+type Attribution int
+
+const (
+	ByOwner  Attribution = iota // 按文件所有者的 UID，只在 Unix 上可用
+	ByTopDir                    // 按根目录下的第一级目录名，例如 /home/alice/... 算作 alice
+)
+
+// ScanOptions 配置 Scanner
+type ScanOptions struct {
+	Roots []string
+	By    Attribution
+	// Name 把 UID 转换为用户名，nil 表示使用 user.LookupId，查不到时使用 UID 的十进制形式
+	Name func(uid uint32) string
+	// Concurrency 是同时读取的目录数，0 表示 20（与 du4 相同）
+	Concurrency int
+	// FullScanEvery 表示每隔多少次扫描做一次完整扫描，0 表示从不
+	// 修改文件的内容不会改变目录的 mtime，增量扫描发现不了，需要定期完整扫描来纠正
+	FullScanEvery int
+}
+
+// ScanStats 描述最近一次扫描
+type ScanStats struct {
+	Dirs     int           // 访问的目录数
+	Skipped  int           // 其中 mtime 未变、没有重新读取的目录数
+	Files    int           // 重新读取的目录中的文件数
+	Errors   int           // 无法读取的目录数
+	Err      error         // 第一个错误
+	Full     bool          // 是否是完整扫描
+	Duration time.Duration // 耗时
+}
+
+// Scanner 通过遍历根目录统计每个用户使用的字节数，它实现了 Usage 接口
+// 遍历方式与 08 章的 du4 相同：每个目录一个 goroutine，用计数信号量限制同时读取的目录数
+// 再次扫描时，mtime 没有变化的目录不再读取，直接使用上次的结果，但仍然会进入它的子目录
+type Scanner struct {
+	opts ScanOptions
+	sema chan struct{} // 限制 dirents 中的并发数量
+
+	scan  sync.Mutex // 使扫描串行执行，守护 count 和 racy
+	count int
+	racy  time.Time // 这之后修改过的目录不缓存，见 readDir
+
+	mu    sync.Mutex // 守护以下字段
+	dirs  map[string]*dirInfo
+	usage map[string]int64
+	stats ScanStats
+	names map[uint32]string // 缓存 UID -> 用户名
+}
+
+// dirInfo 是一个目录的扫描结果，只包含直接位于该目录下的文件
+type dirInfo struct {
+	path    string
+	mtime   time.Time // 零值表示下次必须重新读取（读取出错或刚刚修改过）
+	files   map[string]int64
+	nfiles  int
+	subdirs []string
+	skipped bool
+	err     error
+}
+
+// NewScanner 返回一个还没有扫描过的 Scanner
+func NewScanner(opts ScanOptions) *Scanner {
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = 20
+	}
+	return &Scanner{
+		opts:  opts,
+		sema:  make(chan struct{}, opts.Concurrency),
+		names: make(map[uint32]string),
+	}
+}
+
+// Scan 扫描一次所有的根目录并更新用量
+// 无法读取的目录不会使扫描失败，只记录在 Stats 中；ctx 被取消时返回 ctx.Err()，用量保持不变
+func (s *Scanner) Scan(ctx context.Context) error {
+	s.scan.Lock()
+	defer s.scan.Unlock()
+	start := time.Now()
+	s.count++
+	s.racy = start.Add(-time.Second)
+
+	s.mu.Lock()
+	old := s.dirs
+	s.mu.Unlock()
+	full := old == nil || s.opts.FullScanEvery > 0 && s.count%s.opts.FullScanEvery == 0
+	if full {
+		old = nil
+	}
+
+	// 并行遍历文件树的每个根
+	results := make(chan *dirInfo)
+	var n sync.WaitGroup
+	for _, root := range s.opts.Roots {
+		n.Add(1)
+		go s.walkDir(ctx, filepath.Clean(root), "", old, &n, results)
+	}
+	go func() {
+		n.Wait()
+		close(results)
+	}()
+
+	dirs := make(map[string]*dirInfo)
+	usage := make(map[string]int64)
+	stats := ScanStats{Full: full}
+	for info := range results {
+		dirs[info.path] = info
+		stats.Dirs++
+		if info.skipped {
+			stats.Skipped++
+		}
+		stats.Files += info.nfiles
+		if info.err != nil {
+			stats.Errors++
+			if stats.Err == nil {
+				stats.Err = info.err
+			}
+		}
+		for name, size := range info.files {
+			usage[name] += size
+		}
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	stats.Duration = time.Since(start)
+
+	s.mu.Lock()
+	s.dirs, s.usage, s.stats = dirs, usage, stats
+	s.mu.Unlock()
+	return nil
+}
+
+// walkDir 递归遍历以 dir 为根的文件树，并在 results 上发送每个目录的结果
+// owner 是 ByTopDir 时 dir 所属的用户，根目录为空字符串
+func (s *Scanner) walkDir(ctx context.Context, dir, owner string, old map[string]*dirInfo,
+	n *sync.WaitGroup, results chan<- *dirInfo) {
+	defer n.Done()
+	if ctx.Err() != nil {
+		return
+	}
+	info := &dirInfo{path: dir}
+	fi, err := os.Lstat(dir)
+	if err != nil {
+		info.err = err
+		results <- info
+		return
+	}
+	if prev := old[dir]; prev != nil && !prev.mtime.IsZero() && prev.mtime.Equal(fi.ModTime()) {
+		info = &dirInfo{path: dir, mtime: prev.mtime, files: prev.files, subdirs: prev.subdirs, skipped: true}
+	} else {
+		info = s.readDir(ctx, dir, owner, fi.ModTime())
+	}
+	results <- info
+
+	for _, subdir := range info.subdirs {
+		sub := owner
+		if s.opts.By == ByTopDir && owner == "" {
+			sub = filepath.Base(subdir)
+		}
+		n.Add(1)
+		go s.walkDir(ctx, subdir, sub, old, n, results)
+	}
+}
+
+// readDir 读取目录 dir 并按用户汇总其中文件的大小
+func (s *Scanner) readDir(ctx context.Context, dir, owner string, mtime time.Time) *dirInfo {
+	info := &dirInfo{path: dir, files: make(map[string]int64)}
+	entries, err := s.dirents(ctx, dir)
+	// 出错时 mtime 保持零值，下次重新读取
+	// 刚刚修改过的目录也不缓存：在我们读取之后、同一个时间戳内的修改不会改变 mtime
+	if err != nil {
+		info.err = err
+	} else if mtime.Before(s.racy) {
+		info.mtime = mtime
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			info.subdirs = append(info.subdirs, filepath.Join(dir, entry.Name()))
+			continue
+		}
+		info.nfiles++
+		switch s.opts.By {
+		case ByTopDir:
+			if owner != "" { // 直接位于根目录下的文件不属于任何用户
+				info.files[owner] += entry.Size()
+			}
+		case ByOwner:
+			if uid, ok := fileOwner(entry); ok {
+				info.files[s.name(uid)] += entry.Size()
+			}
+		}
+	}
+	return info
+}
+
+// dirents 返回目录 dir 的条目，与 du4 一样在获取信号量时也响应取消
+func (s *Scanner) dirents(ctx context.Context, dir string) ([]os.FileInfo, error) {
+	select {
+	case s.sema <- struct{}{}: // 获取 token
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	defer func() { <-s.sema }() // 释放 token
+
+	f, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	// Readdir 出错时可能只返回部分结果，仍然使用它们
+	entries, err := f.Readdir(0) // 0 => 不限，读取所有条目
+	if err != nil {
+		err = fmt.Errorf("%s: %v", dir, err)
+	}
+	return entries, err
+}
+
+func (s *Scanner) name(uid uint32) string {
+	s.mu.Lock()
+	name, ok := s.names[uid]
+	s.mu.Unlock()
+	if ok {
+		return name
+	}
+	if s.opts.Name != nil {
+		name = s.opts.Name(uid)
+	} else if u, err := user.LookupId(strconv.Itoa(int(uid))); err == nil {
+		name = u.Username
+	} else {
+		name = strconv.Itoa(int(uid))
+	}
+	s.mu.Lock()
+	s.names[uid] = name
+	s.mu.Unlock()
+	return name
+}
+
+// BytesInUse 返回最近一次扫描中用户 user 使用的字节数
+func (s *Scanner) BytesInUse(user string) int64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage[user]
+}
+
+// Users 返回最近一次扫描中有文件的用户，按名字排序
+func (s *Scanner) Users() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var users []string
+	for name := range s.usage {
+		users = append(users, name)
+	}
+	sort.Strings(users)
+	return users
+}
+
+// Stats 返回最近一次扫描的统计
+func (s *Scanner) Stats() ScanStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.stats
+}
@@ -0,0 +1,184 @@
+package storage
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+)
+
+// makeTree 在 root 下创建文件，files 是相对路径 -> 大小
+// 所有目录的 mtime 都被设为一小时之前，这样它们不会被当作刚刚修改过
+func makeTree(t *testing.T, root string, files map[string]int) {
+	t.Helper()
+	for name, size := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, make([]byte, size), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	touchDirs(t, root, time.Now().Add(-time.Hour))
+}
+
+func touchDirs(t *testing.T, root string, mtime time.Time) {
+	t.Helper()
+	filepath.Walk(root, func(path string, fi os.FileInfo, err error) error {
+		if err == nil && fi.IsDir() {
+			os.Chtimes(path, mtime, mtime)
+		}
+		return err
+	})
+}
+
+func checkUsage(t *testing.T, s *Scanner, want map[string]int64) {
+	t.Helper()
+	for user, bytes := range want {
+		if got := s.BytesInUse(user); got != bytes {
+			t.Errorf("BytesInUse(%s) = %d, want %d", user, got, bytes)
+		}
+	}
+	if users := s.Users(); len(users) != len(want) {
+		t.Errorf("Users = %v, want %d users", users, len(want))
+	}
+}
+
+func TestScanByTopDir(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, map[string]int{
+		"alice/a":         100,
+		"alice/src/b":     200,
+		"alice/src/x/y/c": 300,
+		"bob/d":           1000,
+		"README":          5, // 不属于任何用户
+	})
+	s := NewScanner(ScanOptions{Roots: []string{root}, By: ByTopDir, Concurrency: 2})
+	if err := s.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, map[string]int64{"alice": 600, "bob": 1000})
+	if st := s.Stats(); st.Dirs != 6 || st.Skipped != 0 || !st.Full {
+		t.Errorf("first scan: %+v", st)
+	}
+
+	// 没有任何修改：所有目录都不需要重新读取
+	if err := s.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, map[string]int64{"alice": 600, "bob": 1000})
+	if st := s.Stats(); st.Dirs != 6 || st.Skipped != 6 || st.Full {
+		t.Errorf("second scan: %+v", st)
+	}
+
+	// 在一个深层目录中增加文件，删除 bob 的所有文件
+	ioutil.WriteFile(filepath.Join(root, "alice/src/x/y/e"), make([]byte, 50), 0644)
+	os.RemoveAll(filepath.Join(root, "bob"))
+	touchDirs(t, root, time.Now().Add(-time.Minute))
+	if err := s.Scan(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	checkUsage(t, s, map[string]int64{"alice": 650})
+}
+
+// 修改文件的内容不改变目录的 mtime，只有完整扫描才能发现
+func TestScanFullScanEvery(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, map[string]int{"alice/a": 100})
+	s := NewScanner(ScanOptions{Roots: []string{root}, By: ByTopDir, FullScanEvery: 3})
+	s.Scan(context.Background()) // 1：完整扫描
+	fi, _ := os.Stat(root)
+	ioutil.WriteFile(filepath.Join(root, "alice/a"), make([]byte, 150), 0644)
+	touchDirs(t, root, fi.ModTime())
+
+	s.Scan(context.Background()) // 2：增量扫描
+	checkUsage(t, s, map[string]int64{"alice": 100})
+	s.Scan(context.Background()) // 3：完整扫描
+	checkUsage(t, s, map[string]int64{"alice": 150})
+}
+
+// 刚刚修改过的目录不缓存，即使之后的修改没有改变它的 mtime
+func TestScanRacyDir(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, map[string]int{"alice/a": 100})
+	now := time.Now()
+	touchDirs(t, root, now)
+	s := NewScanner(ScanOptions{Roots: []string{root}, By: ByTopDir})
+	s.Scan(context.Background())
+	ioutil.WriteFile(filepath.Join(root, "alice/b"), make([]byte, 10), 0644)
+	touchDirs(t, root, now) // 在同一个时间戳内修改
+	s.Scan(context.Background())
+	checkUsage(t, s, map[string]int64{"alice": 110})
+}
+
+func TestScanByOwner(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("ByOwner requires Unix")
+	}
+	root := t.TempDir()
+	makeTree(t, root, map[string]int{"a": 10, "x/b": 20})
+	uid := uint32(os.Getuid())
+	s := NewScanner(ScanOptions{
+		Roots: []string{root},
+		Name: func(u uint32) string {
+			if u == uid {
+				return "me"
+			}
+			return "other"
+		},
+	})
+	s.Scan(context.Background())
+	checkUsage(t, s, map[string]int64{"me": 30})
+}
+
+func TestScanCancel(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, map[string]int{"alice/a": 100})
+	s := NewScanner(ScanOptions{Roots: []string{root}, By: ByTopDir})
+	s.Scan(context.Background())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := s.Scan(ctx); err != context.Canceled {
+		t.Errorf("Scan = %v, want context.Canceled", err)
+	}
+	// 被取消的扫描不影响上次的结果
+	checkUsage(t, s, map[string]int64{"alice": 100})
+}
+
+func TestDaemon(t *testing.T) {
+	root := t.TempDir()
+	makeTree(t, root, map[string]int{"alice/a": 900, "bob/b": 100})
+	var n MemoryNotifier
+	scanner := NewScanner(ScanOptions{Roots: []string{root}, By: ByTopDir})
+	config := &Config{Default: Policy{Quota: 1000}}
+	d := &Daemon{
+		Scanner: scanner,
+		Checker: NewChecker(config, scanner, &n),
+		Users:   func() []string { return []string{"carol"} },
+		Logf:    t.Logf,
+	}
+	levels := d.RunOnce(context.Background())
+	if levels["alice"] != Warn || levels["bob"] != OK || len(levels) != 3 {
+		t.Errorf("levels = %v", levels)
+	}
+	if notices := n.Notices(); len(notices) != 1 || notices[0].User != "alice" {
+		t.Errorf("notices = %+v", notices)
+	}
+
+	// 删除 alice 的所有文件后状态被清除，再次超过时重新提醒
+	os.RemoveAll(filepath.Join(root, "alice"))
+	touchDirs(t, root, time.Now().Add(-time.Minute))
+	if levels := d.RunOnce(context.Background()); levels["alice"] != OK {
+		t.Errorf("after delete: levels = %v", levels)
+	}
+	makeTree(t, root, map[string]int{"alice/a": 900})
+	d.RunOnce(context.Background())
+	if notices := n.Notices(); len(notices) != 2 {
+		t.Errorf("got %d notices, want 2", len(notices))
+	}
+}
@@ -1,47 +1,514 @@
-// format 提供可以格式化任何值的 Any 函数
+// Package format 提供可以格式化任何值的 Any 函数
+// 以及可以生成 Go 语法、单行紧凑格式和按宽度折行格式的 Config
 package format
 
 import (
+	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
 )
 
-// Any 将任何值格式为字符串
+// Config 控制值的格式化方式，零值即为 Any 使用的单行紧凑格式
+type Config struct {
+	GoSyntax bool   // 生成可以编译的 Go 复合字面量，此时忽略 Stringer 和 Error
+	Width    int    // 大于 0 时，超过该宽度的复合值会被拆成多行
+	Indent   string // 多行时的缩进，默认为一个制表符
+	Package  string // 该包路径中的类型名不带包名限定，用于生成与类型位于同一个包的代码
+	Stringer bool   // 对实现了 fmt.Stringer 的值调用 String 方法
+	Error    bool   // 对实现了 error 的值调用 Error 方法，优先于 Stringer
+	Raw      bool   // 不把可打印的 []byte 显示为字符串
+	// rune 是 int32 的别名，反射无法区分 []rune 和 []int32，
+	// 所以只有设置了 Runes 时，可打印的 []int32 才显示为字符串
+	Runes bool
+}
+
+var (
+	compact  = &Config{}
+	goSyntax = &Config{GoSyntax: true}
+)
+
+// Any 将任何值格式化为单行的字符串，例如 []int64{1, 2}
+// map 的键按顺序排列，带有环的值显示为 <cycle>
 func Any(value interface{}) string {
-	return formatAtom(reflect.ValueOf(value))
+	return compact.Format(value)
+}
+
+// GoSyntax 将任何值格式化为可以编译的 Go 表达式，可用于生成测试数据
+// 非 nil 的 func 和 chan 以及带有环的指针无法用字面量表示，会被格式化为 nil
+func GoSyntax(value interface{}) string {
+	return goSyntax.Format(value)
+}
+
+// Multiline 将任何值格式化为字符串，超过 width 的复合值会被拆成多行
+func Multiline(value interface{}, width int) string {
+	return (&Config{Width: width}).Format(value)
+}
+
+// Format 按照 c 的配置格式化 value
+func (c *Config) Format(value interface{}) string {
+	p := &printer{Config: c, path: make(map[visit]bool)}
+	n := p.value(reflect.ValueOf(value), ctxIface)
+	return p.layout(n, 0, 0)
+}
+
+// context 描述一个值所在的位置，它决定了是否可以省略类型
+type context int
+
+const (
+	ctxIface context = iota // 顶层或 interface 类型的位置，需要写出完整的类型
+	ctxField                // 结构体字段等静态类型已知的位置，无类型常量可以直接使用
+	ctxElem                 // array、slice 和 map 的元素，复合字面量可以省略类型
+)
+
+// visit 标识当前路径上的一个引用，用于检查循环
+type visit struct {
+	ptr uintptr
+	t   reflect.Type
+}
+
+type printer struct {
+	*Config
+	path map[visit]bool
+}
+
+// node 是格式化的中间结果，layout 再根据宽度决定是否折行
+// 原子节点只有 text；组合节点是 open、elems、close，可以折行；
+// parts 非空时是若干个不可折行地依次拼接的节点
+type node struct {
+	text  string
+	open  string
+	elems []*node
+	close string
+	parts []*node
+	flat  string
+}
+
+func atom(s string) *node { return &node{text: s} }
+
+func concat(parts ...*node) *node { return &node{parts: parts} }
+
+func (n *node) isGroup() bool { return n.open != "" || n.close != "" }
+
+func (n *node) String() string {
+	if n.flat != "" {
+		return n.flat
+	}
+	switch {
+	case n.parts != nil:
+		var b strings.Builder
+		for _, part := range n.parts {
+			b.WriteString(part.String())
+		}
+		n.flat = b.String()
+	case n.isGroup():
+		elems := make([]string, len(n.elems))
+		for i, e := range n.elems {
+			elems[i] = e.String()
+		}
+		n.flat = n.open + strings.Join(elems, ", ") + n.close
+	default:
+		n.flat = n.text
+	}
+	return n.flat
 }
 
-// formatAtom 格式化值而不检查其内部结构
-func formatAtom(v reflect.Value) string {
+func (p *printer) value(v reflect.Value, ctx context) *node {
+	if !v.IsValid() {
+		return atom("nil")
+	}
+	t := v.Type()
+	if !p.GoSyntax && v.CanInterface() && v.Kind() != reflect.Interface {
+		if s, ok := p.method(v); ok {
+			return atom(s)
+		}
+	}
+
 	switch v.Kind() {
-	case reflect.Invalid:
-		return "invalid"
-	case reflect.Int,
-		reflect.Int8,
-		reflect.Int16,
-		reflect.Int32,
-		reflect.Int64:
-		return strconv.FormatInt(v.Int(), 10)
-	case reflect.Uint,
-		reflect.Uint8,
-		reflect.Uint16,
-		reflect.Uint32,
-		reflect.Uint64,
-		reflect.Uintptr:
-		return strconv.FormatUint(v.Uint(), 10)
-	// 为简洁，省略了浮点和复杂的情况
 	case reflect.Bool:
-		return strconv.FormatBool(v.Bool())
+		return p.basic(t, strconv.FormatBool(v.Bool()), ctx)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return p.basic(t, strconv.FormatInt(v.Int(), 10), ctx)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return p.basic(t, strconv.FormatUint(v.Uint(), 10), ctx)
+	case reflect.Float32, reflect.Float64:
+		return p.basic(t, p.float(v.Float(), t.Bits()), ctx)
+	case reflect.Complex64, reflect.Complex128:
+		return p.basic(t, strconv.FormatComplex(v.Complex(), 'g', -1, t.Bits()), ctx)
 	case reflect.String:
-		return strconv.Quote(v.String())
-	case reflect.Chan,
-		reflect.Func,
-		reflect.Ptr,
-		reflect.Slice,
-		reflect.Map:
-		return v.Type().String() + " 0x" +
-			strconv.FormatUint(uint64(v.Pointer()), 16)
-	default: // reflect.Array, reflect.Struct, reflect.Interface
-		return v.Type().String() + " value"
+		return p.basic(t, strconv.Quote(v.String()), ctx)
+	case reflect.Chan, reflect.Func, reflect.UnsafePointer:
+		if v.IsNil() || p.GoSyntax {
+			return p.nilValue(t, ctx)
+		}
+		return atom("(" + p.typeName(t) + ")(0x" + strconv.FormatUint(uint64(v.Pointer()), 16) + ")")
+	case reflect.Interface:
+		if v.IsNil() {
+			return atom("nil")
+		}
+		return p.value(v.Elem(), ctxIface)
+	case reflect.Ptr:
+		return p.pointer(v, ctx)
+	case reflect.Array:
+		return p.list(v, ctx)
+	case reflect.Slice:
+		if v.IsNil() {
+			return p.nilValue(t, ctx)
+		}
+		if s, ok := p.text(v); ok {
+			return atom(p.convType(t) + "(" + strconv.Quote(s) + ")")
+		}
+		key := visit{v.Pointer(), t}
+		if p.path[key] {
+			return p.cycle(t, ctx)
+		}
+		p.path[key] = true
+		defer delete(p.path, key)
+		return p.list(v, ctx)
+	case reflect.Map:
+		if v.IsNil() {
+			return p.nilValue(t, ctx)
+		}
+		key := visit{v.Pointer(), t}
+		if p.path[key] {
+			return p.cycle(t, ctx)
+		}
+		p.path[key] = true
+		defer delete(p.path, key)
+		return p.mapValue(v, ctx)
+	case reflect.Struct:
+		n := &node{open: p.prefix(t, ctx) + "{", close: "}"}
+		for i := 0; i < v.NumField(); i++ {
+			n.elems = append(n.elems, concat(atom(t.Field(i).Name+": "), p.value(v.Field(i), ctxField)))
+		}
+		return n
+	}
+	return atom(t.String() + " value")
+}
+
+// method 在配置允许时调用 v 的 Error 或 String 方法
+func (p *printer) method(v reflect.Value) (s string, ok bool) {
+	var call func() string
+	x := v.Interface()
+	if e, ok := x.(error); ok && p.Error {
+		call = e.Error
+	} else if st, ok := x.(interface{ String() string }); ok && p.Stringer {
+		call = st.String
+	}
+	if call == nil {
+		return "", false
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			ok = true
+			if v.Kind() == reflect.Ptr && v.IsNil() {
+				s = "<nil>"
+			} else {
+				s = "<panic>"
+			}
+		}
+	}()
+	return call(), true
+}
+
+// basic 格式化基础类型的值 lit
+// Go 语法中，位于 interface 位置且不是字面量默认类型的值需要显式转换
+func (p *printer) basic(t reflect.Type, lit string, ctx context) *node {
+	if !p.GoSyntax || ctx != ctxIface || isDefault(t, lit) {
+		return atom(lit)
+	}
+	return atom(p.convType(t) + "(" + lit + ")")
+}
+
+// isDefault 报告字面量 lit 的默认类型是否为 t
+func isDefault(t reflect.Type, lit string) bool {
+	switch t {
+	case reflect.TypeOf(false), reflect.TypeOf(""), reflect.TypeOf(0), reflect.TypeOf(complex128(0)):
+		return true
+	case reflect.TypeOf(0.0):
+		return strings.ContainsAny(lit, ".eEIN(")
+	}
+	return false
+}
+
+func (p *printer) float(f float64, bits int) string {
+	switch {
+	case math.IsInf(f, 1):
+		if p.GoSyntax {
+			return "math.Inf(1)"
+		}
+		return "+Inf"
+	case math.IsInf(f, -1):
+		if p.GoSyntax {
+			return "math.Inf(-1)"
+		}
+		return "-Inf"
+	case math.IsNaN(f):
+		if p.GoSyntax {
+			return "math.NaN()"
+		}
+		return "NaN"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, bits)
+	if p.GoSyntax && !strings.ContainsAny(s, ".e") {
+		s += ".0" // 保证在 interface 位置也是浮点数
+	}
+	return s
+}
+
+func (p *printer) nilValue(t reflect.Type, ctx context) *node {
+	if ctx == ctxIface {
+		return atom("(" + p.typeName(t) + ")(nil)")
+	}
+	return atom("nil")
+}
+
+func (p *printer) cycle(t reflect.Type, ctx context) *node {
+	if p.GoSyntax {
+		return concat(p.nilValue(t, ctx), atom(" /* cycle */"))
+	}
+	return atom("<cycle>")
+}
+
+func (p *printer) pointer(v reflect.Value, ctx context) *node {
+	t := v.Type()
+	if v.IsNil() {
+		return p.nilValue(t, ctx)
+	}
+	key := visit{v.Pointer(), t}
+	if p.path[key] {
+		return p.cycle(t, ctx)
+	}
+	p.path[key] = true
+	defer delete(p.path, key)
+
+	elem := v.Elem()
+	if !p.GoSyntax {
+		if ctx != ctxElem {
+			ctx = ctxField
+		}
+		return concat(atom("&"), p.value(elem, ctx))
+	}
+	if p.literal(elem) {
+		if ctx == ctxElem {
+			return p.value(elem, ctxElem) // &T{...} 在元素中可以省略为 {...}
+		}
+		return concat(atom("&"), p.value(elem, ctxField))
+	}
+	// 其它值没有可以取地址的字面量，借助一个立即调用的函数取得地址
+	et := p.typeName(elem.Type())
+	return concat(
+		atom("func() *"+et+" { v := "+p.convType(elem.Type())+"("),
+		p.value(elem, ctxField),
+		atom("); return &v }()"))
+}
+
+// literal 报告 v 在 Go 语法中是否会被格式化为复合字面量
+func (p *printer) literal(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Struct, reflect.Array:
+		return true
+	case reflect.Map:
+		return !v.IsNil()
+	case reflect.Slice:
+		_, text := p.text(v)
+		return !v.IsNil() && !text
+	}
+	return false
+}
+
+// list 格式化 array 和 slice
+func (p *printer) list(v reflect.Value, ctx context) *node {
+	n := &node{open: p.prefix(v.Type(), ctx) + "{", close: "}"}
+	hex := v.Type().Elem().Kind() == reflect.Uint8
+	for i := 0; i < v.Len(); i++ {
+		if hex {
+			n.elems = append(n.elems, atom("0x"+strconv.FormatUint(v.Index(i).Uint(), 16)))
+			continue
+		}
+		n.elems = append(n.elems, p.value(v.Index(i), ctxElem))
+	}
+	return n
+}
+
+func (p *printer) mapValue(v reflect.Value, ctx context) *node {
+	keys := v.MapKeys()
+	sortKeys(keys)
+	n := &node{open: p.prefix(v.Type(), ctx) + "{", close: "}"}
+	for _, k := range keys {
+		n.elems = append(n.elems, concat(p.value(k, ctxElem), atom(": "), p.value(v.MapIndex(k), ctxElem)))
+	}
+	return n
+}
+
+// sortKeys 对 map 的键排序，数值按大小，其它按格式化后的字符串
+func sortKeys(keys []reflect.Value) {
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		switch a.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			return a.Int() < b.Int()
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+			return a.Uint() < b.Uint()
+		case reflect.Float32, reflect.Float64:
+			return a.Float() < b.Float()
+		case reflect.String:
+			return a.String() < b.String()
+		case reflect.Bool:
+			return !a.Bool() && b.Bool()
+		}
+		return compact.key(a) < compact.key(b)
+	})
+}
+
+func (c *Config) key(v reflect.Value) string {
+	p := &printer{Config: c, path: make(map[visit]bool)}
+	return p.value(v, ctxIface).String()
+}
+
+// text 报告 []byte 或 []rune（需要设置 Runes）是否为可打印的文本
+func (p *printer) text(v reflect.Value) (string, bool) {
+	if p.Raw || v.Len() == 0 {
+		return "", false
+	}
+	et := v.Type().Elem()
+	var s string
+	switch {
+	case et.Kind() == reflect.Uint8:
+		// 不能用 reflect.Copy 或 v.Bytes()，它们对未导出字段中的值会 panic
+		b := make([]byte, v.Len())
+		for i := range b {
+			b[i] = byte(v.Index(i).Uint())
+		}
+		if !utf8.Valid(b) {
+			return "", false
+		}
+		s = string(b)
+	case et.Kind() == reflect.Int32 && et.Name() == "int32" && p.Runes:
+		r := make([]rune, v.Len())
+		for i := range r {
+			r[i] = rune(v.Index(i).Int())
+			if !utf8.ValidRune(r[i]) {
+				return "", false
+			}
+		}
+		s = string(r)
+	default:
+		return "", false
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) && !unicode.IsSpace(r) {
+			return "", false
+		}
+	}
+	return s, true
+}
+
+// prefix 返回复合字面量的类型，可以省略时返回空
+func (p *printer) prefix(t reflect.Type, ctx context) string {
+	if ctx == ctxElem {
+		return ""
+	}
+	return p.typeName(t)
+}
+
+// convType 返回用于类型转换的类型名，必要时加上括号
+func (p *printer) convType(t reflect.Type) string {
+	s := p.typeName(t)
+	if strings.HasPrefix(s, "*") || strings.HasPrefix(s, "<-") || strings.HasPrefix(s, "func") {
+		return "(" + s + ")"
+	}
+	return s
+}
+
+// typeName 返回 t 的名称，属于 Package 的类型不带包名限定
+func (p *printer) typeName(t reflect.Type) string {
+	if t.Name() != "" {
+		if p.Package != "" && t.PkgPath() == p.Package {
+			return t.Name()
+		}
+		return t.String()
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return "*" + p.typeName(t.Elem())
+	case reflect.Slice:
+		return "[]" + p.typeName(t.Elem())
+	case reflect.Array:
+		return "[" + strconv.Itoa(t.Len()) + "]" + p.typeName(t.Elem())
+	case reflect.Map:
+		return "map[" + p.typeName(t.Key()) + "]" + p.typeName(t.Elem())
+	case reflect.Chan:
+		switch t.ChanDir() {
+		case reflect.RecvDir:
+			return "<-chan " + p.typeName(t.Elem())
+		case reflect.SendDir:
+			return "chan<- " + p.typeName(t.Elem())
+		}
+		return "chan " + p.typeName(t.Elem())
+	}
+	return t.String()
+}
+
+// layout 把节点写成字符串，col 是当前所在的列，depth 是缩进层级
+func (p *printer) layout(n *node, col, depth int) string {
+	flat := n.String()
+	if p.Width <= 0 || col+width(flat) <= p.Width {
+		return flat
+	}
+	switch {
+	case n.parts != nil:
+		var b strings.Builder
+		for _, part := range n.parts {
+			s := p.layout(part, col, depth)
+			b.WriteString(s)
+			if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+				col = width(s[i+1:])
+			} else {
+				col += width(s)
+			}
+		}
+		return b.String()
+	case n.isGroup() && len(n.elems) > 0:
+		indent := p.Indent
+		if indent == "" {
+			indent = "\t"
+		}
+		var b strings.Builder
+		b.WriteString(n.open + "\n")
+		inner := strings.Repeat(indent, depth+1)
+		for _, e := range n.elems {
+			b.WriteString(inner)
+			b.WriteString(p.layout(e, p.indentWidth(depth+1), depth+1))
+			b.WriteString(",\n")
+		}
+		b.WriteString(strings.Repeat(indent, depth) + n.close)
+		return b.String()
+	}
+	return flat
+}
+
+// indentWidth 返回 depth 层缩进的宽度
+func (p *printer) indentWidth(depth int) int {
+	indent := p.Indent
+	if indent == "" {
+		indent = "\t"
+	}
+	return width(indent) * depth
+}
+
+// width 返回 s 显示的宽度，制表符按 8 列计算
+func width(s string) int {
+	w := 0
+	for _, r := range s {
+		if r == '\t' {
+			w += 8
+		} else {
+			w++
+		}
 	}
+	return w
 }
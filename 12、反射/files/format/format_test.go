@@ -1,18 +1,227 @@
 package format_test
 
 import (
+	"errors"
 	"fmt"
-	"gostudy/12、反射/files/format"
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"gostudy/12、反射/files/format"
 )
 
 func Test(t *testing.T) {
-	// 指针值只是示例，可能会因运行情况不同而有所差异
 	var x int64 = 1
 	var d time.Duration = 1 * time.Nanosecond
 	fmt.Println(format.Any(x))                  // 1
 	fmt.Println(format.Any(d))                  // 1
-	fmt.Println(format.Any([]int64{x}))         // []int64 0xc000016210
-	fmt.Println(format.Any([]time.Duration{d})) // []time.Duration 0xc000016218
+	fmt.Println(format.Any([]int64{x}))         // []int64{1}
+	fmt.Println(format.Any([]time.Duration{d})) // []time.Duration{1}
+}
+
+type Point struct{ X, Y float64 }
+
+type Line struct {
+	Start, End *Point
+	Label      string
+	color      uint8
+}
+
+type Celsius float64
+
+func (c Celsius) String() string { return fmt.Sprintf("%g°C", float64(c)) }
+
+type node struct {
+	Value int
+	Next  *node
+}
+
+func TestAny(t *testing.T) {
+	var nilMap map[string]int
+	n := &node{Value: 1}
+	n.Next = n
+	var w fmt.Stringer
+
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{nil, "nil"},
+		{42, "42"},
+		{int8(-1), "-1"},
+		{3.5, "3.5"},
+		{float32(0.1), "0.1"},
+		{math.Inf(-1), "-Inf"},
+		{complex(1, -2), "(1-2i)"},
+		{"hi\n", `"hi\n"`},
+		{true, "true"},
+		{[]int64{1, 2}, "[]int64{1, 2}"},
+		{[]int(nil), "([]int)(nil)"},
+		{[]string{}, "[]string{}"},
+		{[2]bool{true}, "[2]bool{true, false}"},
+		{map[string]int{"b": 2, "a": 1, "c": 3}, `map[string]int{"a": 1, "b": 2, "c": 3}`},
+		{map[int]bool{10: true, 9: false, -1: true}, "map[int]bool{-1: true, 9: false, 10: true}"},
+		{nilMap, "(map[string]int)(nil)"},
+		{Point{1, 2}, "format_test.Point{X: 1, Y: 2}"},
+		{&Point{1, 2}, "&format_test.Point{X: 1, Y: 2}"},
+		{[]*Point{{1, 2}, nil}, "[]*format_test.Point{&{X: 1, Y: 2}, nil}"},
+		{Line{Start: &Point{}, Label: "l", color: 7}, `format_test.Line{Start: &format_test.Point{X: 0, Y: 0}, End: nil, Label: "l", color: 7}`},
+		{[]interface{}{1, "a", Point{}}, `[]interface {}{1, "a", format_test.Point{X: 0, Y: 0}}`},
+		{struct{ W fmt.Stringer }{w}, "struct { W fmt.Stringer }{W: nil}"},
+		{[]byte("hello\n"), `[]uint8("hello\n")`},
+		{[]byte{0, 0xff}, "[]uint8{0x0, 0xff}"},
+		{[]rune("hé"), "[]int32{104, 233}"}, // 与 []int32 无法区分，见 TestRunes
+		{[]int32{72, 105}, "[]int32{72, 105}"},
+		{struct{ b []byte }{[]byte("hi")}, `struct { b []uint8 }{b: []uint8("hi")}`}, // 未导出的字段
+		{Celsius(21.5), "21.5"},
+		{n, "&format_test.node{Value: 1, Next: <cycle>}"},
+	} {
+		if got := format.Any(test.v); got != test.want {
+			t.Errorf("Any(%#v) = %s, want %s", test.v, got, test.want)
+		}
+	}
+}
+
+func TestMethods(t *testing.T) {
+	c := &format.Config{Stringer: true, Error: true}
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{Celsius(21.5), "21.5°C"},
+		{[]Celsius{1, 2}, "[]format_test.Celsius{1°C, 2°C}"},
+		{2 * time.Second, "2s"},
+		{errors.New("boom"), "boom"},
+		{(*strings.Builder)(nil), "<nil>"},
+	} {
+		if got := c.Format(test.v); got != test.want {
+			t.Errorf("Format(%#v) = %s, want %s", test.v, got, test.want)
+		}
+	}
+	if got := format.Any(errors.New("boom")); !strings.HasPrefix(got, "&errors.errorString{") {
+		t.Errorf("Any(error) = %s, methods should be off by default", got)
+	}
+}
+
+func TestRunes(t *testing.T) {
+	c := &format.Config{Runes: true}
+	for _, test := range []struct {
+		v    interface{}
+		want string
+	}{
+		{[]rune("héllo"), `[]int32("héllo")`},
+		{[]rune{-1}, "[]int32{-1}"},
+		{[]rune{0}, "[]int32{0}"},
+		{[]byte("hi"), `[]uint8("hi")`},
+	} {
+		if got := c.Format(test.v); got != test.want {
+			t.Errorf("Format(%#v) = %s, want %s", test.v, got, test.want)
+		}
+	}
+}
+
+func TestMultiline(t *testing.T) {
+	v := map[string][]Point{
+		"short": {{1, 2}},
+		"long":  {{1, 2}, {3, 4}, {5, 6}},
+	}
+	got := format.Multiline(v, 50)
+	want := `map[string][]format_test.Point{
+	"long": {
+		{X: 1, Y: 2},
+		{X: 3, Y: 4},
+		{X: 5, Y: 6},
+	},
+	"short": {{X: 1, Y: 2}},
+}`
+	if got != want {
+		t.Errorf("Multiline =\n%s\nwant\n%s", got, want)
+	}
+	if got := format.Multiline([]int{1, 2}, 60); got != "[]int{1, 2}" {
+		t.Errorf("short value was split: %s", got)
+	}
+}
+
+// TestGoSyntax 对生成的代码做类型检查，确保它可以被编译
+func TestGoSyntax(t *testing.T) {
+	one := 1
+	n := &node{Value: 1}
+	n.Next = n
+	text := []byte("x")
+	c := &format.Config{GoSyntax: true, Width: 40, Package: reflect.TypeOf(Point{}).PkgPath()}
+
+	for _, v := range []interface{}{
+		int64(1), 1, 1.0, float32(2), uint8(3), "s", 'x', complex64(1i), math.NaN(),
+		time.Duration(5), Celsius(1),
+		[]int(nil), map[string]int(nil), []byte("text"), []byte{0, 1},
+		&one, &[]int{1}, []*int{&one, nil}, &text,
+		Point{1, 2}, &Point{1, 2}, []*Point{{1, 2}, nil}, map[Point]*Point{{1, 2}: {3, 4}},
+		Line{Start: &Point{}, Label: "l"},
+		[]interface{}{1, int32(2), 2.5, nil, Point{}, []string{"a"}},
+		struct {
+			A int
+			B []struct{ C string }
+		}{1, []struct{ C string }{{"c"}}},
+		(func())(nil), make(chan int), n,
+	} {
+		src := c.Format(v)
+		if _, err := parser.ParseExpr(src); err != nil {
+			t.Errorf("GoSyntax(%#v) = %s: %v", v, src, err)
+			continue
+		}
+		if err := typeCheck(src); err != nil {
+			t.Errorf("GoSyntax(%#v) = %s: %v", v, src, err)
+		}
+	}
+
+	if got, want := format.GoSyntax([]interface{}{int64(1), 1, 1.0}), "[]interface {}{int64(1), 1, 1.0}"; got != want {
+		t.Errorf("GoSyntax = %s, want %s", got, want)
+	}
+}
+
+// sourceImporter 在多次类型检查之间缓存导入的包
+var sourceImporter = importer.ForCompiler(token.NewFileSet(), "source", nil)
+
+// typeCheck 在声明了测试类型的包中对表达式 src 做类型检查
+func typeCheck(src string) error {
+	const decls = `package p
+
+import (
+	"math"
+	"time"
+)
+
+type Point struct{ X, Y float64 }
+
+type Line struct {
+	Start, End *Point
+	Label      string
+	color      uint8
+}
+
+type Celsius float64
+
+type node struct {
+	Value int
+	Next  *node
+}
+
+var _ = math.Pi
+var _ time.Duration
+`
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", decls+"var _ interface{} = "+src+"\n", 0)
+	if err != nil {
+		return err
+	}
+	conf := types.Config{Importer: sourceImporter}
+	_, err = conf.Check("p", fset, []*ast.File{f}, nil)
+	return err
 }
@@ -0,0 +1,371 @@
+// Package typeinfo 在 methods.Print 的基础上提供了一个完整的类型检查器
+// 它报告结构体的字段（标签、偏移量和大小）、值接收器和指针接收器的方法集、
+// 通过内嵌提升的方法，以及一组接口中哪些被满足、哪些差一点被满足
+// 用于排查 “does not implement” 一类的编译错误
+package typeinfo
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// Info 描述一个类型
+type Info struct {
+	Type       reflect.Type // 被检查的类型，指针会被解引用一层
+	Size       uintptr
+	Align      int
+	Fields     []Field     // 仅结构体有，内嵌结构体的字段会被展开
+	Methods    []Method    // T 与 *T 方法集的并集，按名称排序
+	Satisfied  []Satisfied // 被 T 或 *T 满足的接口
+	NearMisses []NearMiss  // 差一点被满足的接口
+}
+
+// Field 描述一个结构体字段
+type Field struct {
+	Path     string // 例如 “Point.X”
+	Index    []int  // 可用于 reflect.Value.FieldByIndex
+	Type     reflect.Type
+	Tag      reflect.StructTag
+	Offset   uintptr // 相对于最外层结构体的偏移量
+	Size     uintptr
+	Embedded bool
+	Exported bool
+}
+
+// Method 描述方法集中的一个方法
+type Method struct {
+	Name    string
+	Type    reflect.Type // 不含接收器的函数类型
+	Value   bool         // 在 T 的方法集中
+	Pointer bool         // 在 *T 的方法集中
+	From    string       // 提升来源的内嵌字段路径，例如 “Point”，直接声明时为空
+}
+
+// Satisfied 描述一个被满足的接口
+type Satisfied struct {
+	Interface reflect.Type
+	Value     bool // T 满足该接口，此时 *T 一定也满足
+}
+
+// NearMiss 描述一个差一点被满足的接口
+type NearMiss struct {
+	Interface reflect.Type
+	Missing   []Mismatch
+}
+
+// Mismatch 描述接口中一个未被满足的方法
+type Mismatch struct {
+	Name   string
+	Want   reflect.Type // 接口要求的签名
+	Have   reflect.Type // 类型实际的签名，方法不存在时为 nil
+	Reason string
+}
+
+func (m Mismatch) String() string {
+	s := m.Name + strings.TrimPrefix(m.Want.String(), "func") + ": " + m.Reason
+	if m.Have != nil && m.Have != m.Want {
+		s += " (have " + m.Name + strings.TrimPrefix(m.Have.String(), "func") + ")"
+	}
+	return s
+}
+
+// Interface 返回 ptr 所指向的接口类型，ptr 形如 (*io.Reader)(nil)
+func Interface(ptr interface{}) reflect.Type {
+	t := reflect.TypeOf(ptr)
+	if t == nil || t.Kind() != reflect.Ptr || t.Elem().Kind() != reflect.Interface {
+		panic(fmt.Sprintf("typeinfo: %T 不是指向接口的指针", ptr))
+	}
+	return t.Elem()
+}
+
+// Inspect 检查 x 的类型，x 也可以是一个 reflect.Type
+// ifaces 中的每个元素都是指向接口的 nil 指针，例如 (*io.Reader)(nil)
+func Inspect(x interface{}, ifaces ...interface{}) *Info {
+	t, ok := x.(reflect.Type)
+	if !ok {
+		t = reflect.TypeOf(x)
+	}
+	if t == nil {
+		panic("typeinfo: nil 没有类型")
+	}
+	if t.Kind() == reflect.Ptr && t.Name() == "" && t.Elem().Kind() != reflect.Ptr &&
+		t.Elem().Kind() != reflect.Interface {
+		t = t.Elem()
+	}
+
+	info := &Info{Type: t, Size: t.Size(), Align: t.Align()}
+	if t.Kind() == reflect.Struct {
+		info.Fields = fields(t, "", nil, 0)
+	}
+	info.Methods = methods(t)
+	for _, p := range ifaces {
+		it := Interface(p)
+		switch {
+		case t.Implements(it):
+			info.Satisfied = append(info.Satisfied, Satisfied{it, true})
+		case t.Kind() != reflect.Interface && reflect.PtrTo(t).Implements(it):
+			info.Satisfied = append(info.Satisfied, Satisfied{it, false})
+		default:
+			if miss, near := missing(t, it); near {
+				info.NearMisses = append(info.NearMisses, NearMiss{it, miss})
+			}
+		}
+	}
+	return info
+}
+
+// fields 展开结构体 t 的字段，base 为 t 相对于最外层结构体的偏移量
+func fields(t reflect.Type, prefix string, index []int, base uintptr) []Field {
+	var list []Field
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		idx := append(append([]int(nil), index...), i)
+		list = append(list, Field{
+			Path:     prefix + f.Name,
+			Index:    idx,
+			Type:     f.Type,
+			Tag:      f.Tag,
+			Offset:   base + f.Offset,
+			Size:     f.Type.Size(),
+			Embedded: f.Anonymous,
+			Exported: f.PkgPath == "",
+		})
+		// 内嵌指针的字段不在本结构体的内存中，因此不展开
+		if f.Anonymous && f.Type.Kind() == reflect.Struct {
+			list = append(list, fields(f.Type, prefix+f.Name+".", idx, base+f.Offset)...)
+		}
+	}
+	return list
+}
+
+// methods 返回 T 与 *T 方法集的并集，reflect 已经按名称排好序
+func methods(t reflect.Type) []Method {
+	var list []Method
+	byName := make(map[string]int)
+	add := func(m reflect.Method, value bool) {
+		i, ok := byName[m.Name]
+		if !ok {
+			i = len(list)
+			byName[m.Name] = i
+			list = append(list, Method{Name: m.Name, Type: signature(t, m)})
+		}
+		if value {
+			list[i].Value = true
+		} else {
+			list[i].Pointer = true
+		}
+	}
+	for i := 0; i < t.NumMethod(); i++ {
+		add(t.Method(i), true)
+	}
+	if t.Kind() != reflect.Interface {
+		pt := reflect.PtrTo(t)
+		for i := 0; i < pt.NumMethod(); i++ {
+			add(pt.Method(i), false)
+		}
+	}
+
+	for i := range list {
+		list[i].From = promotedFrom(t, list[i].Name)
+	}
+	// 合并后保持按名称排序
+	for i := 1; i < len(list); i++ {
+		for j := i; j > 0 && list[j].Name < list[j-1].Name; j-- {
+			list[j], list[j-1] = list[j-1], list[j]
+		}
+	}
+	return list
+}
+
+// signature 返回方法 m 去掉接收器后的函数类型
+func signature(t reflect.Type, m reflect.Method) reflect.Type {
+	if t.Kind() == reflect.Interface {
+		return m.Type // 接口方法本身不含接收器
+	}
+	ft := m.Type
+	in := make([]reflect.Type, 0, ft.NumIn()-1)
+	for i := 1; i < ft.NumIn(); i++ {
+		in = append(in, ft.In(i))
+	}
+	out := make([]reflect.Type, 0, ft.NumOut())
+	for i := 0; i < ft.NumOut(); i++ {
+		out = append(out, ft.Out(i))
+	}
+	return reflect.FuncOf(in, out, ft.IsVariadic())
+}
+
+// promotedFrom 返回提供方法 name 的内嵌字段路径
+// reflect 无法区分直接声明的方法和提升的方法，
+// 因此先按内嵌层级做广度优先查找，再检查 t 上的方法是否为编译器生成的包装方法
+func promotedFrom(t reflect.Type, name string) string {
+	if t.Kind() != reflect.Struct {
+		return ""
+	}
+	if m, ok := t.MethodByName(name); ok && !autogenerated(m) {
+		return ""
+	}
+	if m, ok := reflect.PtrTo(t).MethodByName(name); ok && !autogenerated(m) {
+		if _, ok := t.MethodByName(name); !ok {
+			return "" // 以指针接收器直接声明
+		}
+	}
+
+	type level struct {
+		t    reflect.Type
+		path string
+	}
+	current := []level{{t, ""}}
+	seen := make(map[reflect.Type]bool)
+	for len(current) > 0 {
+		var next []level
+		for _, l := range current {
+			if seen[l.t] {
+				continue
+			}
+			seen[l.t] = true
+			for i := 0; i < l.t.NumField(); i++ {
+				f := l.t.Field(i)
+				if !f.Anonymous {
+					continue
+				}
+				path := l.path + f.Name
+				ft := f.Type
+				if _, ok := ft.MethodByName(name); ok {
+					return path
+				}
+				if ft.Kind() != reflect.Ptr && ft.Kind() != reflect.Interface {
+					if _, ok := reflect.PtrTo(ft).MethodByName(name); ok {
+						return path
+					}
+				}
+				if ft.Kind() == reflect.Ptr {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					next = append(next, level{ft, path + "."})
+				}
+			}
+		}
+		current = next
+	}
+	return ""
+}
+
+// autogenerated 报告方法 m 的实现是否为编译器生成的包装方法
+func autogenerated(m reflect.Method) bool {
+	fn := runtime.FuncForPC(m.Func.Pointer())
+	if fn == nil {
+		return true
+	}
+	file, _ := fn.FileLine(fn.Entry())
+	return file == "<autogenerated>"
+}
+
+// missing 返回 t 未能满足接口 it 的方法
+// 只要有一个方法同名存在，就认为是差一点满足
+func missing(t, it reflect.Type) (list []Mismatch, near bool) {
+	for i := 0; i < it.NumMethod(); i++ {
+		want := it.Method(i)
+		if want.PkgPath != "" && want.PkgPath != t.PkgPath() {
+			list = append(list, Mismatch{want.Name, want.Type, nil, "unexported method of another package"})
+			continue
+		}
+		if m, ok := t.MethodByName(want.Name); ok {
+			near = true
+			if have := signature(t, m); have != want.Type {
+				list = append(list, Mismatch{want.Name, want.Type, have, "wrong signature"})
+			}
+			continue
+		}
+		if t.Kind() != reflect.Interface {
+			if m, ok := reflect.PtrTo(t).MethodByName(want.Name); ok {
+				near = true
+				have := signature(t, m)
+				if have != want.Type {
+					list = append(list, Mismatch{want.Name, want.Type, have, "wrong signature"})
+				} else {
+					list = append(list, Mismatch{want.Name, want.Type, have, "pointer receiver"})
+				}
+				continue
+			}
+		}
+		list = append(list, Mismatch{want.Name, want.Type, nil, "missing method"})
+	}
+	return list, near
+}
+
+// Print 打印 x 的类型信息
+func Print(x interface{}, ifaces ...interface{}) {
+	Fprint(os.Stdout, Inspect(x, ifaces...))
+}
+
+// Fprint 将 info 以文本形式写入 w
+func Fprint(w io.Writer, info *Info) {
+	t := info.Type
+	fmt.Fprintf(w, "type %s %s (size %d, align %d)\n", t, t.Kind(), info.Size, info.Align)
+
+	if len(info.Fields) > 0 {
+		fmt.Fprintln(w, "fields:")
+		for _, f := range info.Fields {
+			fmt.Fprintf(w, "\t%s %s offset=%d size=%d", f.Path, f.Type, f.Offset, f.Size)
+			if f.Embedded {
+				fmt.Fprint(w, " embedded")
+			}
+			if !f.Exported {
+				fmt.Fprint(w, " unexported")
+			}
+			if f.Tag != "" {
+				fmt.Fprintf(w, " `%s`", f.Tag)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if len(info.Methods) > 0 {
+		fmt.Fprintln(w, "methods:")
+		for _, m := range info.Methods {
+			fmt.Fprintf(w, "\t%s %s%s", receivers(t, m), m.Name,
+				strings.TrimPrefix(m.Type.String(), "func"))
+			if m.From != "" {
+				fmt.Fprintf(w, " (promoted from %s)", m.From)
+			}
+			fmt.Fprintln(w)
+		}
+	}
+
+	if len(info.Satisfied) > 0 || len(info.NearMisses) > 0 {
+		fmt.Fprintln(w, "interfaces:")
+		for _, s := range info.Satisfied {
+			if s.Value {
+				fmt.Fprintf(w, "\t%s: satisfied by %s and *%s\n", s.Interface, t, t)
+			} else {
+				fmt.Fprintf(w, "\t%s: satisfied by *%s only\n", s.Interface, t)
+			}
+		}
+		for _, n := range info.NearMisses {
+			fmt.Fprintf(w, "\t%s: not satisfied\n", n.Interface)
+			for _, m := range n.Missing {
+				fmt.Fprintf(w, "\t\t%s\n", m)
+			}
+		}
+	}
+}
+
+// receivers 返回方法所在的方法集，形如 “T *T”
+func receivers(t reflect.Type, m Method) string {
+	if t.Kind() == reflect.Interface {
+		return "iface"
+	}
+	switch {
+	case m.Value && m.Pointer:
+		return "T *T"
+	case m.Pointer:
+		return "  *T"
+	default:
+		return "T   "
+	}
+}
@@ -0,0 +1,108 @@
+package typeinfo_test
+
+import (
+	"fmt"
+	"image/color"
+	"io"
+	"math"
+	"testing"
+
+	"gostudy/12、反射/files/typeinfo"
+)
+
+// Point 和 ColoredPoint 与 06、方法/src/005_coloredpoint.go 中的定义相同
+type Point struct{ X, Y float64 }
+
+func (p Point) Distance(q Point) float64 { return math.Hypot(q.X-p.X, q.Y-p.Y) }
+
+func (p *Point) ScaleBy(factor float64) {
+	p.X *= factor
+	p.Y *= factor
+}
+
+type ColoredPoint struct {
+	Point
+	Color color.RGBA `json:"color"`
+}
+
+func (p ColoredPoint) String() string { return fmt.Sprintf("%v %v", p.Point, p.Color) }
+
+type Scaler interface{ ScaleBy(float64) }
+
+type Measurer interface {
+	Distance(Point) float64
+	Area() float64
+}
+
+type Resizer interface{ ScaleBy(int) }
+
+func ExamplePrint() {
+	typeinfo.Print(ColoredPoint{},
+		(*fmt.Stringer)(nil), (*Scaler)(nil), (*Measurer)(nil), (*Resizer)(nil), (*io.Reader)(nil))
+	// Output:
+	// type typeinfo_test.ColoredPoint struct (size 24, align 8)
+	// fields:
+	// 	Point typeinfo_test.Point offset=0 size=16 embedded
+	// 	Point.X float64 offset=0 size=8
+	// 	Point.Y float64 offset=8 size=8
+	// 	Color color.RGBA offset=16 size=4 `json:"color"`
+	// methods:
+	// 	T *T Distance(typeinfo_test.Point) float64 (promoted from Point)
+	// 	  *T ScaleBy(float64) (promoted from Point)
+	// 	T *T String() string
+	// interfaces:
+	// 	fmt.Stringer: satisfied by typeinfo_test.ColoredPoint and *typeinfo_test.ColoredPoint
+	// 	typeinfo_test.Scaler: satisfied by *typeinfo_test.ColoredPoint only
+	// 	typeinfo_test.Measurer: not satisfied
+	// 		Area() float64: missing method
+	// 	typeinfo_test.Resizer: not satisfied
+	// 		ScaleBy(int): wrong signature (have ScaleBy(float64))
+}
+
+func TestPointerReceiver(t *testing.T) {
+	info := typeinfo.Inspect(Point{}, (*Scaler)(nil), (*io.Writer)(nil))
+	if len(info.Satisfied) != 1 || info.Satisfied[0].Value {
+		t.Errorf("Scaler: got %+v, want satisfied by *Point only", info.Satisfied)
+	}
+	if len(info.NearMisses) != 0 {
+		t.Errorf("io.Writer is unrelated to Point, got near miss %+v", info.NearMisses)
+	}
+
+	// 接口类型本身也可以被检查
+	info = typeinfo.Inspect(typeinfo.Interface((*Measurer)(nil)), (*Scaler)(nil))
+	if len(info.Satisfied) != 0 || len(info.Methods) != 2 {
+		t.Errorf("Measurer: got %+v", info)
+	}
+}
+
+func TestNearMissPointerReceiver(t *testing.T) {
+	type wrapper struct{ Point }
+	info := typeinfo.Inspect(wrapper{}, (*Scaler)(nil))
+	if len(info.Satisfied) != 1 || info.Satisfied[0].Value {
+		t.Fatalf("got %+v, want satisfied by *wrapper only", info.Satisfied)
+	}
+
+	type byPtr struct{ *Point }
+	info = typeinfo.Inspect(byPtr{}, (*Scaler)(nil))
+	if len(info.Satisfied) != 1 || !info.Satisfied[0].Value {
+		t.Errorf("embedding *Point promotes ScaleBy to the value method set, got %+v", info.Satisfied)
+	}
+	for _, m := range info.Methods {
+		if m.Name == "ScaleBy" && (!m.Value || m.From != "Point") {
+			t.Errorf("ScaleBy = %+v, want value method promoted from Point", m)
+		}
+	}
+
+	info = typeinfo.Inspect(&readOnly{}, (*io.ReadWriter)(nil))
+	if len(info.NearMisses) != 1 {
+		t.Fatalf("got %+v, want one near miss", info.NearMisses)
+	}
+	miss := info.NearMisses[0].Missing
+	if len(miss) != 2 || miss[0].Reason != "pointer receiver" || miss[1].Reason != "missing method" {
+		t.Errorf("missing = %v", miss)
+	}
+}
+
+type readOnly struct{}
+
+func (*readOnly) Read(p []byte) (int, error) { return 0, io.EOF }
@@ -0,0 +1,93 @@
+package bzip
+
+// bwt 返回 data 的 Burrows-Wheeler 变换：把 data 的所有循环移位排序，
+// last 是排序后每个循环移位的最后一个字节，origPtr 是 data 本身在排序中的位置
+//
+// 排序使用倍增法：第 k 轮之后，rank 表示每个循环移位前 2^k 个字节的顺序，
+// 下一轮按 (rank[i], rank[i+2^k]) 排序，两个键都已经是整数，可以用计数排序，
+// 所以每一轮是线性的，最多 log n 轮；相同的循环移位（如 “abab”）不需要区分，它们的最后一个字节也相同
+func bwt(data []byte) (last []byte, origPtr int) {
+	n := len(data)
+	sa := make([]int32, n)   // 排序后的循环移位的起点
+	rank := make([]int32, n) // 循环移位 i 的等价类
+	tmp := make([]int32, n)
+	cnt := make([]int32, 256)
+	if n > 256 {
+		cnt = make([]int32, n)
+	}
+
+	// 第一轮按第一个字节排序
+	for _, b := range data {
+		cnt[b]++
+	}
+	for i := 1; i < 256; i++ {
+		cnt[i] += cnt[i-1]
+	}
+	for i := n - 1; i >= 0; i-- {
+		cnt[data[i]]--
+		sa[cnt[data[i]]] = int32(i)
+	}
+	classes := int32(0)
+	for i, j := range sa {
+		if i > 0 && data[j] != data[sa[i-1]] {
+			classes++
+		}
+		rank[j] = classes
+	}
+	classes++
+
+	for k := 1; k < n && int(classes) < n; k *= 2 {
+		// sa 已经按前 k 个字节排好序，所以 sa[i]-k 按第二个键排好了序
+		for i, j := range sa {
+			j -= int32(k)
+			if j < 0 {
+				j += int32(n)
+			}
+			tmp[i] = j
+		}
+		// 按第一个键稳定地计数排序
+		for i := int32(0); i < classes; i++ {
+			cnt[i] = 0
+		}
+		for _, j := range tmp {
+			cnt[rank[j]]++
+		}
+		for i := int32(1); i < classes; i++ {
+			cnt[i] += cnt[i-1]
+		}
+		for i := n - 1; i >= 0; i-- {
+			j := tmp[i]
+			cnt[rank[j]]--
+			sa[cnt[rank[j]]] = j
+		}
+		// 重新计算等价类，tmp 用来保存新的 rank
+		second := func(j int32) int32 {
+			j += int32(k)
+			if j >= int32(n) {
+				j -= int32(n)
+			}
+			return rank[j]
+		}
+		classes = 0
+		tmp[sa[0]] = 0
+		for i := 1; i < n; i++ {
+			a, b := sa[i], sa[i-1]
+			if rank[a] != rank[b] || second(a) != second(b) {
+				classes++
+			}
+			tmp[a] = classes
+		}
+		classes++
+		rank, tmp = tmp, rank
+	}
+
+	last = make([]byte, n)
+	for i, j := range sa {
+		if j == 0 {
+			origPtr = i
+			j = int32(n)
+		}
+		last[i] = data[j-1]
+	}
+	return last, origPtr
+}
@@ -1,3 +1,5 @@
+//go:build cgo
+
 // Copyright © 2016 Alan A. A. Donovan & Brian W. Kernighan.
 // License: https://creativecommons.org/licenses/by-nc-sa/4.0/
 
@@ -30,3 +32,17 @@ int bz2compress(bz_stream *s, int action,
 }
 
 //!-
+
+/* bz2decompress 与 bz2compress 相同，只是调用的是 BZ2_bzDecompress */
+int bz2decompress(bz_stream *s,
+                  char *in, unsigned *inlen, char *out, unsigned *outlen) {
+  s->next_in = in;
+  s->avail_in = *inlen;
+  s->next_out = out;
+  s->avail_out = *outlen;
+  int r = BZ2_bzDecompress(s);
+  *inlen -= s->avail_in;
+  *outlen -= s->avail_out;
+  s->next_in = s->next_out = NULL;
+  return r;
+}
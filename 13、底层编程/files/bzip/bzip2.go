@@ -1,4 +1,5 @@
-// Package bzip 提供了一个使用 bzip2 压缩的写入器
+//go:build cgo
+
 package bzip
 
 /*
@@ -33,6 +34,22 @@ func NewWriter(out io.Writer) io.WriteCloser {
 	return w
 }
 
+// NewWriterLevel 与 NewWriter 相同，但是块大小为 level × 100k，level 必须在 1 到 9 之间
+// 较小的块压缩得较快，占用的内存也较少，但是压缩率较低
+func NewWriterLevel(out io.Writer, level int) (io.WriteCloser, error) {
+	if level < 1 || level > 9 {
+		return nil, ErrLevel
+	}
+	const verbosity = 0
+	const workFactor = 30
+	w := &writer{w: out, stream: C.bz2alloc()}
+	if r := C.BZ2_bzCompressInit(w.stream, C.int(level), verbosity, workFactor); r != C.BZ_OK {
+		C.bz2free(w.stream)
+		return nil, bzError(r)
+	}
+	return w, nil
+}
+
 func (w *writer) Write(data []byte) (int, error) {
 	if w.stream == nil {
 		panic("closed")
@@ -0,0 +1,6 @@
+// Package bzip 提供了使用 bzip2 压缩的写入器和解压的读取器
+//
+// 启用 cgo 时它们调用 libbz2（见 bzip2.go 和 reader.go）；
+// 没有 cgo 时（如 CGO_ENABLED=0 或交叉编译），写入器使用纯 Go 的压缩器（见 encode.go），
+// 读取器使用标准库的 compress/bzip2，两种实现的输出都可以用 bzip2 -d 解压
+package bzip
@@ -0,0 +1,259 @@
+package bzip
+
+import "io"
+
+// 纯 Go 的 bzip2 压缩器，没有 cgo 时 NewWriter 使用它（见 writer_nocgo.go）
+// 压缩分为以下几步，每一步都对应 bzip2 格式中的一层：
+//
+//	1. 游程编码（RLE1）：4 到 255 个相同的字节写成 4 个字节加一个计数
+//	2. Burrows-Wheeler 变换（BWT）：把相同上下文中的字节聚在一起（见 bwt.go）
+//	3. Move-to-front（MTF）和零游程编码（RLE2）：把聚在一起的字节变成大量的小整数和 0
+//	4. Huffman 编码：每 50 个符号从最多 6 张码表中选一张（见 huffman.go）
+//
+// 输出可以用 bzip2 -d、compress/bzip2 或这个包的 NewReader 解压
+
+const (
+	blockMagic = 0x314159265359 // π
+	endMagic   = 0x177245385090 // √π
+)
+
+type goWriter struct {
+	bw       bitWriter
+	block    []byte // 当前块经过 RLE1 之后的数据
+	max      int    // block 的最大长度
+	crc      uint32 // 当前块原始数据的 CRC
+	combined uint32 // 整个流的 CRC
+	runByte  byte   // 还没有写入 block 的游程
+	runLen   int
+	closed   bool
+}
+
+// newGoWriter 返回纯 Go 实现的 bzip2 写入器，块大小为 level × 100k
+func newGoWriter(out io.Writer, level int) (io.WriteCloser, error) {
+	if level < 1 || level > 9 {
+		return nil, ErrLevel
+	}
+	w := &goWriter{bw: bitWriter{w: out}}
+	// 与 bzip2 相同，留出一些空间，保证解压时一个块不会超过 level × 100000 字节
+	w.max = level*100000 - 19
+	w.block = make([]byte, 0, w.max)
+	w.bw.writeBits(24, 'B'<<16|'Z'<<8|'h')
+	w.bw.writeBits(8, uint64('0'+level))
+	return w, nil
+}
+
+func (w *goWriter) Write(data []byte) (int, error) {
+	if w.closed {
+		panic("closed")
+	}
+	for _, b := range data {
+		if w.runLen > 0 && b == w.runByte && w.runLen < 255 {
+			w.runLen++
+			continue
+		}
+		if w.runLen > 0 {
+			w.flushRun()
+		}
+		w.runByte, w.runLen = b, 1
+	}
+	if w.bw.err != nil {
+		return 0, w.bw.err // 不清楚有多少数据真正写入了，与 bufio.Writer 相同
+	}
+	return len(data), nil
+}
+
+// flushRun 将当前的游程写入 block，block 放不下时先压缩并输出 block
+func (w *goWriter) flushRun() {
+	if len(w.block)+5 > w.max {
+		w.writeBlock()
+	}
+	for i := 0; i < w.runLen; i++ {
+		w.crc = crcUpdate(w.crc, w.runByte)
+	}
+	if w.runLen < 4 {
+		for i := 0; i < w.runLen; i++ {
+			w.block = append(w.block, w.runByte)
+		}
+	} else {
+		b := w.runByte
+		w.block = append(w.block, b, b, b, b, byte(w.runLen-4))
+	}
+	w.runLen = 0
+}
+
+// Close 输出剩下的数据和流的结尾，它不会关闭底层的 io.Writer
+func (w *goWriter) Close() error {
+	if w.closed {
+		panic("closed")
+	}
+	w.closed = true
+	if w.runLen > 0 {
+		w.flushRun()
+	}
+	if len(w.block) > 0 {
+		w.writeBlock()
+	}
+	w.bw.writeBits(48, endMagic)
+	w.bw.writeBits(32, uint64(w.combined))
+	w.bw.flush()
+	return w.bw.err
+}
+
+// writeBlock 压缩并输出 block
+func (w *goWriter) writeBlock() {
+	crc := w.crc
+	w.combined = (w.combined<<1 | w.combined>>31) ^ crc
+
+	last, origPtr := bwt(w.block)
+	var inUse [256]bool
+	for _, b := range w.block {
+		inUse[b] = true
+	}
+	syms, alphaSize := mtf(last, &inUse)
+
+	bw := &w.bw
+	bw.writeBits(48, blockMagic)
+	bw.writeBits(32, uint64(crc))
+	bw.writeBits(1, 0) // 不使用已经废弃的随机化
+	bw.writeBits(24, uint64(origPtr))
+
+	// 用到的字节：16 位表示每 16 个字节中是否有用到的，然后是每个有用到的 16 字节的位图
+	var ranges uint64
+	for i := 0; i < 16; i++ {
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				ranges |= 1 << uint(15-i)
+				break
+			}
+		}
+	}
+	bw.writeBits(16, ranges)
+	for i := 0; i < 16; i++ {
+		if ranges&(1<<uint(15-i)) == 0 {
+			continue
+		}
+		var bits uint64
+		for j := 0; j < 16; j++ {
+			if inUse[i*16+j] {
+				bits |= 1 << uint(15-j)
+			}
+		}
+		bw.writeBits(16, bits)
+	}
+
+	writeHuffman(bw, syms, alphaSize)
+
+	w.block = w.block[:0]
+	w.crc = 0
+}
+
+// mtf 对 BWT 的输出做 move-to-front 和零游程编码，返回符号序列和字母表的大小
+// 符号 0 和 1 是 RUNA 和 RUNB，用双射二进制表示连续的 0 的个数；
+// MTF 的值 v（v ≥ 1）写成 v+1；最后一个符号 alphaSize-1 是块的结束（EOB）
+func mtf(last []byte, inUse *[256]bool) (syms []uint16, alphaSize int) {
+	var seq [256]byte // 字节在用到的字节中的序号
+	var list [256]byte
+	n := 0
+	for b := 0; b < 256; b++ {
+		if inUse[b] {
+			seq[b] = byte(n)
+			list[n] = byte(n)
+			n++
+		}
+	}
+	alphaSize = n + 2
+
+	syms = make([]uint16, 0, len(last)+1)
+	zeros := 0
+	run := func() {
+		// 与 bzip2 相同：zeros-1 的二进制从低位起，1 写成 RUNB，0 写成 RUNA
+		for z := zeros - 1; ; z = (z - 2) / 2 {
+			syms = append(syms, uint16(z&1))
+			if z < 2 {
+				break
+			}
+		}
+		zeros = 0
+	}
+	for _, b := range last {
+		s := seq[b]
+		if list[0] == s {
+			zeros++
+			continue
+		}
+		if zeros > 0 {
+			run()
+		}
+		j := 1
+		for list[j] != s {
+			j++
+		}
+		copy(list[1:j+1], list[:j])
+		list[0] = s
+		syms = append(syms, uint16(j+1))
+	}
+	if zeros > 0 {
+		run()
+	}
+	return append(syms, uint16(alphaSize-1)), alphaSize
+}
+
+// bitWriter 按高位在前的顺序输出比特
+type bitWriter struct {
+	w     io.Writer
+	bits  uint64 // 还没有输出的比特在低位
+	nbits uint
+	buf   []byte
+	err   error
+}
+
+// writeBits 输出 v 的低 n 位，n 最多为 48
+func (bw *bitWriter) writeBits(n uint, v uint64) {
+	bw.bits = bw.bits<<n | v&(1<<n-1)
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.nbits -= 8
+		bw.buf = append(bw.buf, byte(bw.bits>>bw.nbits))
+	}
+	if len(bw.buf) >= 64*1024 {
+		bw.write()
+	}
+}
+
+// flush 用 0 补齐最后一个字节，并输出所有缓冲的数据
+func (bw *bitWriter) flush() {
+	if bw.nbits > 0 {
+		bw.writeBits(8-bw.nbits, 0)
+	}
+	bw.write()
+}
+
+func (bw *bitWriter) write() {
+	if bw.err == nil && len(bw.buf) > 0 {
+		_, bw.err = bw.w.Write(bw.buf)
+	}
+	bw.buf = bw.buf[:0]
+}
+
+// bzip2 使用高位在前的 CRC-32（多项式 0x04c11db7），与 hash/crc32 的位序相反
+var crcTable = func() (t [256]uint32) {
+	for i := range t {
+		c := uint32(i) << 24
+		for j := 0; j < 8; j++ {
+			if c&0x80000000 != 0 {
+				c = c<<1 ^ 0x04c11db7
+			} else {
+				c <<= 1
+			}
+		}
+		t[i] = c
+	}
+	return
+}()
+
+// crcUpdate 用 b 更新 crc，crc 以取反的形式保存，所以初始值是 0
+func crcUpdate(crc uint32, b byte) uint32 {
+	crc = ^crc
+	crc = crc<<8 ^ crcTable[byte(crc>>24)^b]
+	return ^crc
+}
@@ -0,0 +1,172 @@
+package bzip_test
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os/exec"
+	"sort"
+	"strings"
+	"testing"
+
+	"gostudy/13、底层编程/files/bzip"
+)
+
+// goCompress 用纯 Go 的压缩器压缩 data，每次写入 chunk 字节
+func goCompress(t testing.TB, data []byte, level, chunk int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w, err := bzip.NewGoWriter(&buf, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// 边界情况：空输入、各种长度的游程、所有的字节值、不可压缩的数据、周期性的数据
+func encodeCases() map[string][]byte {
+	rng := rand.New(rand.NewSource(1))
+	random := make([]byte, 300<<10)
+	rng.Read(random)
+	var all []byte
+	for i := 0; i < 256; i++ {
+		all = append(all, byte(i))
+	}
+	runs := []byte{}
+	for n := 1; n < 600; n += 37 {
+		runs = append(runs, bytes.Repeat([]byte{byte(n)}, n)...)
+	}
+	return map[string][]byte{
+		"empty":    nil,
+		"one byte": {'x'},
+		"run 3":    []byte("aaa"),
+		"run 4":    []byte("aaaa"),
+		"run 5":    []byte("aaaaa"),
+		"run 255":  bytes.Repeat([]byte{0}, 255),
+		"run 256":  bytes.Repeat([]byte{0}, 256),
+		"long run": bytes.Repeat([]byte{0xff}, 1<<20),
+		"runs":     runs,
+		"all":      bytes.Repeat(all, 100),
+		"random":   random,
+		"periodic": bytes.Repeat([]byte("ab"), 50000),
+		"text":     testData(1 << 20),
+		"hello":    []byte(strings.Repeat("hello", 100000)),
+	}
+}
+
+func TestGoWriter(t *testing.T) {
+	for name, data := range encodeCases() {
+		for _, level := range []int{1, 9} {
+			compressed := goCompress(t, data, level, 4096)
+			if want := fmt.Sprintf("BZh%d", level); !bytes.HasPrefix(compressed, []byte(want)) {
+				t.Errorf("%s, level %d: header %q", name, level, compressed[:4])
+			}
+			got, err := ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(compressed)))
+			if err != nil {
+				t.Errorf("%s, level %d: compress/bzip2: %v", name, level, err)
+				continue
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%s, level %d: compress/bzip2 decompressed %d bytes, want %d", name, level, len(got), len(data))
+			}
+			if got, err := decompress(bytes.NewReader(compressed)); err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%s, level %d: NewReader: %v", name, level, err)
+			}
+		}
+	}
+}
+
+// 所有的块大小；数据跨越多个块，每次写入的大小不影响输出
+func TestGoWriterLevels(t *testing.T) {
+	data := testData(400 << 10)
+	for level := 1; level <= 9; level++ {
+		compressed := goCompress(t, data, level, 1<<20)
+		if small := goCompress(t, data, level, 3); !bytes.Equal(small, compressed) {
+			t.Errorf("level %d: output depends on write size", level)
+		}
+		got, err := ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(compressed)))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("level %d: %v", level, err)
+		}
+	}
+	if _, err := bzip.NewGoWriter(ioutil.Discard, 0); err != bzip.ErrLevel {
+		t.Errorf("level 0: %v", err)
+	}
+	if _, err := bzip.NewWriterLevel(ioutil.Discard, 10); err != bzip.ErrLevel {
+		t.Errorf("NewWriterLevel(10): %v", err)
+	}
+}
+
+// 系统的 bzip2 命令能够解压，并且压缩率与它相近
+func TestGoWriterCommand(t *testing.T) {
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		t.Skip("bzip2 command not found")
+	}
+	for name, data := range encodeCases() {
+		compressed := goCompress(t, data, 9, 1<<16)
+		cmd := exec.Command("bzip2", "-d")
+		cmd.Stdin = bytes.NewReader(compressed)
+		got, err := cmd.Output()
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("%s: bzip2 -d: %v", name, err)
+			continue
+		}
+		cmd = exec.Command("bzip2", "-9")
+		cmd.Stdin = bytes.NewReader(data)
+		ref, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(compressed) > len(ref)+len(ref)/20+16 {
+			t.Errorf("%s: %d bytes, bzip2 -9 gives %d", name, len(compressed), len(ref))
+		}
+	}
+}
+
+// 与直接排序所有循环移位的结果比较
+func TestBWT(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 500; i++ {
+		data := make([]byte, 1+rng.Intn(40))
+		for j := range data {
+			data[j] = "abc"[rng.Intn(1+i%3)]
+		}
+		n := len(data)
+		rot := make([]string, n)
+		for j := range rot {
+			rot[j] = string(data[j:]) + string(data[:j])
+		}
+		sort.Strings(rot)
+		var want []byte
+		for _, r := range rot {
+			want = append(want, r[n-1])
+		}
+		last, ptr := bzip.BWT(data)
+		if string(last) != string(want) || rot[ptr] != string(data) {
+			t.Fatalf("BWT(%q) = %q, %d; want %q and rotation %q", data, last, ptr, want, data)
+		}
+	}
+}
+
+func BenchmarkGoWriter(b *testing.B) {
+	data := testData(1 << 20)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		goCompress(b, data, 9, len(data))
+	}
+}
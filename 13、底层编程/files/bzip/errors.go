@@ -0,0 +1,11 @@
+package bzip
+
+import "errors"
+
+// 压缩和解压的错误，cgo 和纯 Go 的实现返回相同的错误
+var (
+	ErrHeader = errors.New("bzip2: invalid header")                // 不是 bzip2 数据
+	ErrData   = errors.New("bzip2: data integrity error")          // 数据损坏，包括 CRC 校验失败
+	ErrMem    = errors.New("bzip2: insufficient memory")           // libbz2 无法分配内存
+	ErrLevel  = errors.New("bzip2: level must be between 1 and 9") // NewWriterLevel 的 level 不正确
+)
@@ -0,0 +1,10 @@
+package bzip
+
+// 使测试在启用 cgo 时也能检查纯 Go 的压缩器
+var (
+	NewGoWriter = newGoWriter
+	BWT         = bwt
+)
+
+// ParallelChunk 使测试可以用较小的块检查并行压缩
+var ParallelChunk = &parallelChunk
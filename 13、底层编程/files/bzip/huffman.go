@@ -0,0 +1,214 @@
+package bzip
+
+import "sort"
+
+const (
+	groupSize  = 50 // 每个码表选择子管理的符号数
+	maxCodeLen = 17 // 与 bzip2 相同；解压器允许最长 20 位
+	iterations = 4  // 码表的优化次数
+)
+
+// writeHuffman 用若干张 Huffman 码表编码 syms 并输出
+// 符号每 50 个分为一组，每组选择一张码表；码表和每组的选择交替优化：
+// 先按频率把字母表划分为几段，每张码表偏向其中一段，然后反复地为每组选择代价最小的码表，
+// 再用每张码表被选中的组中的符号频率重新构造它
+func writeHuffman(bw *bitWriter, syms []uint16, alphaSize int) {
+	nGroups := 6
+	switch n := len(syms); {
+	case n < 200:
+		nGroups = 2
+	case n < 600:
+		nGroups = 3
+	case n < 1200:
+		nGroups = 4
+	case n < 2400:
+		nGroups = 5
+	}
+	nSelectors := (len(syms) + groupSize - 1) / groupSize
+
+	var freq [258]int32
+	for _, s := range syms {
+		freq[s]++
+	}
+
+	// 初始码表：第 t 张码表中 [lo, hi] 之间的符号代价为 0，其他的为 15
+	lens := make([][]uint8, nGroups)
+	remaining := int32(len(syms))
+	lo := 0
+	for t := nGroups; t > 0; t-- {
+		target := remaining / int32(t)
+		hi, sum := lo-1, int32(0)
+		for sum < target && hi < alphaSize-1 {
+			hi++
+			sum += freq[hi]
+		}
+		// 与 bzip2 相同：偶数次的划分把多出的最后一个符号留给下一段
+		if hi > lo && t != nGroups && t != 1 && (nGroups-t)%2 == 1 {
+			sum -= freq[hi]
+			hi--
+		}
+		table := make([]uint8, alphaSize)
+		for s := range table {
+			if s < lo || s > hi {
+				table[s] = 15
+			}
+		}
+		lens[nGroups-t] = table
+		remaining -= sum
+		lo = hi + 1
+	}
+
+	selectors := make([]uint8, nSelectors)
+	choose := func() (gfreq [][258]int32) {
+		gfreq = make([][258]int32, nGroups)
+		for g := 0; g < nSelectors; g++ {
+			group := syms[g*groupSize:]
+			if len(group) > groupSize {
+				group = group[:groupSize]
+			}
+			best, bestCost := 0, -1
+			for t := 0; t < nGroups; t++ {
+				cost := 0
+				for _, s := range group {
+					cost += int(lens[t][s])
+				}
+				if bestCost < 0 || cost < bestCost {
+					best, bestCost = t, cost
+				}
+			}
+			selectors[g] = uint8(best)
+			for _, s := range group {
+				gfreq[best][s]++
+			}
+		}
+		return gfreq
+	}
+	for i := 0; i < iterations; i++ {
+		gfreq := choose()
+		for t := range lens {
+			lens[t] = codeLengths(gfreq[t][:alphaSize], maxCodeLen)
+		}
+	}
+	choose() // 用最终的码表重新选择
+
+	// 码表数、选择子数和 MTF 编码的选择子（一元编码）
+	bw.writeBits(3, uint64(nGroups))
+	bw.writeBits(15, uint64(nSelectors))
+	var order [6]uint8
+	for i := range order {
+		order[i] = uint8(i)
+	}
+	for _, sel := range selectors {
+		j := 0
+		for order[j] != sel {
+			j++
+		}
+		copy(order[1:j+1], order[:j])
+		order[0] = sel
+		bw.writeBits(uint(j+1), 1<<uint(j+1)-2) // j 个 1 和一个 0
+	}
+
+	// 码长：起始长度，然后每个符号相对于前一个的增减，"10" 加一，"11" 减一，"0" 结束
+	codes := make([][]uint32, nGroups)
+	for t, table := range lens {
+		cur := table[0]
+		bw.writeBits(5, uint64(cur))
+		for _, l := range table {
+			for cur < l {
+				bw.writeBits(2, 2)
+				cur++
+			}
+			for cur > l {
+				bw.writeBits(2, 3)
+				cur--
+			}
+			bw.writeBits(1, 0)
+		}
+		codes[t] = canonical(table)
+	}
+
+	for g, sel := range selectors {
+		group := syms[g*groupSize:]
+		if len(group) > groupSize {
+			group = group[:groupSize]
+		}
+		l, c := lens[sel], codes[sel]
+		for _, s := range group {
+			bw.writeBits(uint(l[s]), uint64(c[s]))
+		}
+	}
+}
+
+// codeLengths 返回频率为 freq 的符号的 Huffman 码长，最长不超过 maxLen
+// 频率为 0 的符号也有码长，因为 bzip2 的码表必须包括字母表中的所有符号；
+// 码长超过 maxLen 时，与 bzip2 相同，把频率减半后重新构造
+func codeLengths(freq []int32, maxLen int) []uint8 {
+	n := len(freq)
+	weight := make([]int64, n)
+	for i, f := range freq {
+		weight[i] = int64(f)
+		if weight[i] == 0 {
+			weight[i] = 1
+		}
+	}
+	lens := make([]uint8, n)
+	for {
+		// 两个队列的 Huffman 算法：叶子按权重排序，合并出的内部节点的权重是递增的
+		leaves := make([]int, n)
+		for i := range leaves {
+			leaves[i] = i
+		}
+		sort.SliceStable(leaves, func(i, j int) bool { return weight[leaves[i]] < weight[leaves[j]] })
+		parent := make([]int, 2*n-1) // 节点 0..n-1 是叶子，n.. 是内部节点
+		w := make([]int64, 2*n-1)
+		copy(w, weight)
+		li, ni, next := 0, n, n
+		pop := func() int {
+			if li < n && (ni >= next || w[leaves[li]] <= w[ni]) {
+				li++
+				return leaves[li-1]
+			}
+			ni++
+			return ni - 1
+		}
+		for next < 2*n-1 {
+			a, b := pop(), pop()
+			w[next] = w[a] + w[b]
+			parent[a], parent[b] = next, next
+			next++
+		}
+		depth := make([]int, 2*n-1)
+		longest := 0
+		for i := 2*n - 3; i >= 0; i-- { // 内部节点的下标总是大于它的子节点
+			depth[i] = depth[parent[i]] + 1
+			if i < n && depth[i] > longest {
+				longest = depth[i]
+			}
+		}
+		if longest <= maxLen {
+			for i := 0; i < n; i++ {
+				lens[i] = uint8(depth[i])
+			}
+			return lens
+		}
+		for i := range weight {
+			weight[i] = 1 + weight[i]/2
+		}
+	}
+}
+
+// canonical 返回码长为 lens 的规范 Huffman 编码：码长较短的在前，码长相同时按符号的顺序
+func canonical(lens []uint8) []uint32 {
+	codes := make([]uint32, len(lens))
+	code := uint32(0)
+	for l := uint8(1); l <= 20; l++ {
+		for s, sl := range lens {
+			if sl == l {
+				codes[s] = code
+				code++
+			}
+		}
+		code <<= 1
+	}
+	return codes
+}
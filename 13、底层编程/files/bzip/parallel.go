@@ -0,0 +1,152 @@
+package bzip
+
+import (
+	"bytes"
+	"io"
+	"runtime"
+	"sync"
+)
+
+// parallelChunk 是并行压缩时每一块未压缩数据的大小，与 bzip2 -9 的块大小相同
+var parallelChunk = 900000
+
+// chunk 是并行压缩中的一块数据
+type chunk struct {
+	data  []byte
+	out   bytes.Buffer // 压缩后的数据，一个完整的 bzip2 压缩流
+	err   error
+	ready chan struct{} // 压缩完成后关闭
+}
+
+type parallelWriter struct {
+	w     io.Writer
+	buf   []byte      // 当前还没有填满的块
+	jobs  chan *chunk // 送给 worker 压缩
+	queue chan *chunk // 按输入的顺序送给输出 goroutine，它的容量限制了同时存在的块数
+	done  chan struct{}
+	wg    sync.WaitGroup
+	empty bool // 还没有送出任何块
+
+	mu  sync.Mutex
+	err error // 第一个错误，由 mu 守护
+}
+
+// NewParallelWriter 返回用 workers 个 goroutine 并行压缩的写入器，workers 为 0 时使用 runtime.NumCPU()
+// 与 pbzip2 相同，输入被分为 900k 的块，每一块被独立地压缩为一个完整的 bzip2 压缩流，然后按顺序输出；
+// 首尾相接的压缩流可以用 bzip2 -d、compress/bzip2 或 NewReader 解压
+// 同时存在的块最多为 workers+2 个：队列中的 workers 个、输出 goroutine 正在等待或输出的 1 个，
+// 以及 Write 正在填充或等待送入队列的 1 个；压缩完成的块释放原始数据，但在输出之前保留压缩后的数据，
+// 所以占用的内存不超过 (workers+2)×900k 加上压缩后的数据
+// 压缩或输出出错之后，Write 和 Close 返回第一个错误
+func NewParallelWriter(out io.Writer, workers int) io.WriteCloser {
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	w := &parallelWriter{
+		w:     out,
+		buf:   make([]byte, 0, parallelChunk),
+		jobs:  make(chan *chunk),
+		queue: make(chan *chunk, workers),
+		done:  make(chan struct{}),
+		empty: true,
+	}
+	for i := 0; i < workers; i++ {
+		w.wg.Add(1)
+		go func() {
+			defer w.wg.Done()
+			for c := range w.jobs {
+				c.err = compressChunk(&c.out, c.data)
+				c.data = nil
+				close(c.ready)
+			}
+		}()
+	}
+	go w.output()
+	return w
+}
+
+// compressChunk 将 data 压缩为一个 bzip2 压缩流写入 out
+func compressChunk(out io.Writer, data []byte) error {
+	z := NewWriter(out)
+	if _, err := z.Write(data); err != nil {
+		z.Close()
+		return err
+	}
+	return z.Close()
+}
+
+// output 按顺序等待每一块压缩完成并输出；出错之后它继续接收，但不再输出，这样 Write 不会被阻塞
+func (w *parallelWriter) output() {
+	defer close(w.done)
+	for c := range w.queue {
+		<-c.ready
+		err := c.err
+		if err == nil && w.error() == nil {
+			_, err = w.w.Write(c.out.Bytes())
+		}
+		if err != nil {
+			w.setError(err)
+		}
+	}
+}
+
+func (w *parallelWriter) error() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.err
+}
+
+func (w *parallelWriter) setError(err error) {
+	w.mu.Lock()
+	if w.err == nil {
+		w.err = err
+	}
+	w.mu.Unlock()
+}
+
+func (w *parallelWriter) Write(data []byte) (int, error) {
+	if w.buf == nil {
+		panic("closed")
+	}
+	if err := w.error(); err != nil {
+		return 0, err
+	}
+	total := len(data)
+	for len(data) > 0 {
+		n := parallelChunk - len(w.buf)
+		if n > len(data) {
+			n = len(data)
+		}
+		w.buf = append(w.buf, data[:n]...)
+		data = data[n:]
+		if len(w.buf) == parallelChunk {
+			w.send()
+		}
+	}
+	return total, nil
+}
+
+// send 把当前的块交给 worker，队列满时等待
+func (w *parallelWriter) send() {
+	c := &chunk{data: w.buf, ready: make(chan struct{})}
+	w.queue <- c // 先占住输出的位置，再交给 worker
+	w.jobs <- c
+	w.buf = make([]byte, 0, parallelChunk)
+	w.empty = false
+}
+
+// Close 压缩剩下的数据，等待所有的块输出之后返回，它不会关闭底层的 io.Writer
+func (w *parallelWriter) Close() error {
+	if w.buf == nil {
+		panic("closed")
+	}
+	if len(w.buf) > 0 || w.empty {
+		w.send() // 空的输入也要输出一个空的压缩流
+	}
+	close(w.jobs)
+	close(w.queue)
+	<-w.done
+	w.wg.Wait()
+	w.buf = nil
+	return w.error()
+}
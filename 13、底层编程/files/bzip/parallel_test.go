@@ -0,0 +1,178 @@
+package bzip_test
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os/exec"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gostudy/13、底层编程/files/bzip"
+)
+
+// smallChunks 把并行压缩的块设为 n 字节，返回的函数恢复原来的大小
+func smallChunks(n int) func() {
+	old := *bzip.ParallelChunk
+	*bzip.ParallelChunk = n
+	return func() { *bzip.ParallelChunk = old }
+}
+
+func parallelCompress(t testing.TB, data []byte, workers, chunk int) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := bzip.NewParallelWriter(&buf, workers)
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		if _, err := w.Write(data[:n]); err != nil {
+			t.Fatal(err)
+		}
+		data = data[n:]
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParallelWriter(t *testing.T) {
+	defer smallChunks(10000)()
+	for _, n := range []int{0, 1, 9999, 10000, 10001, 123456} {
+		data := testData(n)
+		for _, workers := range []int{1, 3, 8} {
+			compressed := parallelCompress(t, data, workers, 777)
+			got, err := decompress(bytes.NewReader(compressed))
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%d bytes, %d workers: NewReader: %v", n, workers, err)
+			}
+			got, err = ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(compressed)))
+			if err != nil || !bytes.Equal(got, data) {
+				t.Errorf("%d bytes, %d workers: compress/bzip2: %v", n, workers, err)
+			}
+			// 输出只取决于输入和块的大小，与 worker 数无关
+			if workers > 1 {
+				if serial := parallelCompress(t, data, 1, 1<<20); !bytes.Equal(compressed, serial) {
+					t.Errorf("%d bytes: output with %d workers differs from 1 worker", n, workers)
+				}
+			}
+		}
+	}
+}
+
+func TestParallelWriterCommand(t *testing.T) {
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		t.Skip("bzip2 command not found")
+	}
+	data := testData(2 << 20)
+	cmd := exec.Command("bzip2", "-d")
+	cmd.Stdin = bytes.NewReader(parallelCompress(t, data, 4, 1<<16))
+	got, err := cmd.Output()
+	if err != nil || !bytes.Equal(got, data) {
+		t.Errorf("bzip2 -d: %v", err)
+	}
+}
+
+// failWriter 在写入 n 次之后出错
+type failWriter struct {
+	n   int
+	err error
+}
+
+func (w *failWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, w.err
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestParallelWriterError(t *testing.T) {
+	defer smallChunks(1000)()
+	before := runtime.NumGoroutine()
+	errDisk := errors.New("disk full")
+	w := bzip.NewParallelWriter(&failWriter{2, errDisk}, 4)
+	data := testData(1000)
+	var err error
+	for i := 0; i < 1000 && err == nil; i++ {
+		_, err = w.Write(data)
+	}
+	if err != errDisk {
+		t.Errorf("Write = %v, want %v", err, errDisk)
+	}
+	if err := w.Close(); err != errDisk {
+		t.Errorf("Close = %v, want %v", err, errDisk)
+	}
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left, want %d", n, before)
+	}
+}
+
+// blockedWriter 在 release 关闭之前阻塞所有的写入
+type blockedWriter struct{ release chan struct{} }
+
+func (w blockedWriter) Write(p []byte) (int, error) {
+	<-w.release
+	return len(p), nil
+}
+
+// 输出被阻塞时，Write 接收 workers+1 个块之后就阻塞，不会把所有的输入都留在内存中
+func TestParallelWriterBounded(t *testing.T) {
+	defer smallChunks(1000)()
+	out := blockedWriter{make(chan struct{})}
+	w := bzip.NewParallelWriter(out, 2)
+	data := testData(1000)
+	var written int32
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < 50; i++ {
+			w.Write(data)
+			atomic.AddInt32(&written, 1)
+		}
+		close(done)
+	}()
+	// 输出被阻塞时：输出 goroutine 拿着第 1 块，队列中有 2 块，第 4 次 Write 拿着第 4 块等待队列，
+	// 所以恰好有 workers+1 次 Write 返回，同时存在 workers+2 块
+	const want = 2 + 1
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&written) < want && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // 再等一会儿，确认没有更多的 Write 返回
+	if n := atomic.LoadInt32(&written); n != want {
+		t.Errorf("%d chunks accepted while output is blocked, want %d", n, want)
+	}
+	close(out.release)
+	<-done
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func benchmarkWriter(b *testing.B, newWriter func(io.Writer) io.WriteCloser) {
+	data := testData(4 << 20)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w := newWriter(ioutil.Discard)
+		w.Write(data)
+		if err := w.Close(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkWriter(b *testing.B) { benchmarkWriter(b, bzip.NewWriter) }
+
+func BenchmarkParallelWriter(b *testing.B) {
+	benchmarkWriter(b, func(w io.Writer) io.WriteCloser { return bzip.NewParallelWriter(w, 0) })
+}
@@ -0,0 +1,162 @@
+//go:build cgo
+
+package bzip
+
+/*
+#cgo CFLAGS: -I/usr/include
+#cgo LDFLAGS: -L/usr/lib -lbz2
+#include <bzlib.h>
+bz_stream* bz2alloc();
+void bz2free(bz_stream* s);
+int bz2decompress(bz_stream *s,
+                  char *in, unsigned *inlen, char *out, unsigned *outlen);
+*/
+import "C"
+import (
+	"fmt"
+	"io"
+	"unsafe"
+)
+
+// bzError 将 libbz2 的返回值转换为 Go 的错误
+func bzError(r C.int) error {
+	switch r {
+	case C.BZ_DATA_ERROR_MAGIC:
+		return ErrHeader
+	case C.BZ_DATA_ERROR:
+		return ErrData
+	case C.BZ_MEM_ERROR:
+		return ErrMem
+	case C.BZ_UNEXPECTED_EOF:
+		return io.ErrUnexpectedEOF
+	}
+	return fmt.Errorf("bzip2: libbz2 error %d", int(r)) // 参数或调用顺序错误，是这个包的 bug
+}
+
+type reader struct {
+	r      io.Reader // 基础输入流
+	stream *C.bz_stream
+	inbuf  [64 * 1024]byte
+	in     []byte // inbuf 中还没有解压的部分
+	eof    bool   // r 已经读完
+	active bool   // stream 已经初始化，正在解压一个压缩流
+	more   bool   // 至少已经解压完一个压缩流，之后的头部错误是尾部的垃圾数据
+	err    error  // 出错之后 Read 总是返回它
+}
+
+// NewReader 返回从 r 中读取并解压 bzip2 压缩流的读取器
+// r 中可以有多个首尾相接的压缩流（如 cat a.bz2 b.bz2 的输出），它们被依次解压；
+// 与 bzip2 -d 相同，压缩流之后不是 bzip2 头部的数据被当作尾部的垃圾忽略，
+// 只是 bzip2 -d 会打印一条警告，这里则不读取剩下的数据，直接返回 io.EOF
+// NewReader 读取并检查压缩流的头部，r 为空时返回 io.EOF，不是 bzip2 数据时返回 ErrHeader
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	z := &reader{r: r, stream: C.bz2alloc()}
+	// 头部是 “BZh” 和块大小 '1' 到 '9'
+	n, err := io.ReadFull(r, z.inbuf[:4])
+	if err == io.ErrUnexpectedEOF || err == nil && (string(z.inbuf[:3]) != "BZh" || z.inbuf[3] < '1' || z.inbuf[3] > '9') {
+		err = ErrHeader
+	}
+	if err != nil {
+		C.bz2free(z.stream)
+		return nil, err
+	}
+	z.in = z.inbuf[:n]
+	if err := z.init(); err != nil {
+		C.bz2free(z.stream)
+		return nil, err
+	}
+	return z, nil
+}
+
+// init 开始解压一个新的压缩流
+func (z *reader) init() error {
+	const verbosity = 0
+	const small = 0 // 为 1 时使用较慢但内存少一半的算法
+	if r := C.BZ2_bzDecompressInit(z.stream, verbosity, small); r != C.BZ_OK {
+		return bzError(r)
+	}
+	z.active = true
+	return nil
+}
+
+// end 释放当前压缩流的资源
+func (z *reader) end() {
+	if z.active {
+		C.BZ2_bzDecompressEnd(z.stream)
+		z.active = false
+	}
+}
+
+func (z *reader) Read(p []byte) (int, error) {
+	if z.stream == nil {
+		panic("closed")
+	}
+	for z.err == nil && len(p) > 0 {
+		if len(z.in) == 0 && !z.eof {
+			n, err := z.r.Read(z.inbuf[:])
+			z.in = z.inbuf[:n]
+			if err == io.EOF {
+				z.eof = true
+			} else if err != nil {
+				z.err = err
+				break
+			}
+		}
+
+		if !z.active {
+			// 上一个压缩流结束了：没有更多输入时整个读取结束，否则后面应该是另一个压缩流
+			if len(z.in) == 0 {
+				if z.eof {
+					z.err = io.EOF
+				}
+				continue
+			}
+			if z.err = z.init(); z.err != nil {
+				break
+			}
+		}
+
+		var in *C.char
+		if len(z.in) > 0 {
+			in = (*C.char)(unsafe.Pointer(&z.in[0]))
+		}
+		inlen, outlen := C.uint(len(z.in)), C.uint(len(p))
+		r := C.bz2decompress(z.stream, in, &inlen, (*C.char)(unsafe.Pointer(&p[0])), &outlen)
+		z.in = z.in[inlen:]
+		switch r {
+		case C.BZ_OK:
+			if outlen == 0 && inlen == 0 && len(z.in) == 0 && z.eof {
+				z.err = io.ErrUnexpectedEOF // 压缩流没有结束，输入却没有了
+			}
+		case C.BZ_STREAM_END:
+			z.end()
+			z.more = true
+		case C.BZ_DATA_ERROR_MAGIC:
+			if z.more {
+				z.err = io.EOF // 尾部的垃圾数据
+			} else {
+				z.err = ErrHeader
+			}
+		default:
+			z.err = bzError(r)
+		}
+		if outlen > 0 {
+			return int(outlen), nil // 错误在下一次 Read 时返回
+		}
+	}
+	if len(p) == 0 {
+		return 0, nil
+	}
+	return 0, z.err
+}
+
+// Close 释放 libbz2 的资源，它不会关闭底层的 io.Reader
+func (z *reader) Close() error {
+	if z.stream == nil {
+		panic("closed")
+	}
+	z.end()
+	C.bz2free(z.stream)
+	z.stream = nil
+	return nil
+}
@@ -0,0 +1,53 @@
+//go:build !cgo
+
+package bzip
+
+import (
+	"compress/bzip2"
+	"io"
+	"strings"
+)
+
+type reader struct {
+	r io.Reader
+}
+
+// NewReader 返回从 r 中读取并解压 bzip2 压缩流的读取器，与 cgo 的版本一样，
+// 它检查头部，依次解压首尾相接的多个压缩流，并忽略压缩流之后不是 bzip2 头部的垃圾数据
+func NewReader(r io.Reader) (io.ReadCloser, error) {
+	var header [4]byte
+	if _, err := io.ReadFull(r, header[:]); err == io.ErrUnexpectedEOF {
+		return nil, ErrHeader
+	} else if err != nil {
+		return nil, err
+	}
+	if string(header[:3]) != "BZh" || header[3] < '1' || header[3] > '9' {
+		return nil, ErrHeader
+	}
+	r = io.MultiReader(strings.NewReader(string(header[:])), r)
+	return &reader{bzip2.NewReader(r)}, nil
+}
+
+func (z *reader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	if _, ok := err.(bzip2.StructuralError); ok {
+		// compress/bzip2 用 StructuralError 报告所有格式错误
+		// NewReader 已经检查了第一个压缩流的头部，所以头部错误只会出现在后续的压缩流中，
+		// 它们与 libbz2 的 BZ_DATA_ERROR_MAGIC 对应，是尾部的垃圾数据；
+		// 块或流结尾的 magic 错误（"bad magic value found"）是数据损坏
+		switch err {
+		case bzip2.StructuralError("bad magic value in continuation file"),
+			bzip2.StructuralError("non-Huffman entropy encoding"),
+			bzip2.StructuralError("invalid compression level"):
+			err = io.EOF
+		case bzip2.StructuralError("bad magic value"):
+			err = ErrHeader
+		default:
+			err = ErrData
+		}
+	}
+	return n, err
+}
+
+// Close 什么也不做，它不会关闭底层的 io.Reader
+func (z *reader) Close() error { return nil }
@@ -0,0 +1,189 @@
+package bzip_test
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"os/exec"
+	"testing"
+	"testing/iotest"
+
+	"gostudy/13、底层编程/files/bzip"
+)
+
+// compress 用 bzip.NewWriter 压缩 data
+func compress(t testing.TB, data []byte) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	w := bzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// decompress 用 bzip.NewReader 解压 r
+func decompress(r io.Reader) ([]byte, error) {
+	z, err := bzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer z.Close()
+	return ioutil.ReadAll(z)
+}
+
+// testData 返回 n 字节可压缩但不太规则的文本
+func testData(n int) []byte {
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"hello", "world", "bzip2", "Burrows", "Wheeler", "\n", " ", "的", "压缩"}
+	var buf bytes.Buffer
+	for buf.Len() < n {
+		buf.WriteString(words[rng.Intn(len(words))])
+		if rng.Intn(50) == 0 {
+			buf.WriteByte(byte(rng.Intn(256)))
+		}
+	}
+	return buf.Bytes()[:n]
+}
+
+func TestReader(t *testing.T) {
+	for _, n := range []int{0, 1, 1000, 100 << 10, 2 << 20} {
+		data := testData(n)
+		compressed := compress(t, data)
+		for _, r := range []struct {
+			name string
+			r    io.Reader
+		}{
+			{"bytes", bytes.NewReader(compressed)},
+			{"one byte", iotest.OneByteReader(bytes.NewReader(compressed))},
+			{"half", iotest.HalfReader(bytes.NewReader(compressed))},
+		} {
+			got, err := decompress(r.r)
+			if err != nil {
+				t.Fatalf("%d bytes, %s reader: %v", n, r.name, err)
+			}
+			if !bytes.Equal(got, data) {
+				t.Errorf("%d bytes, %s reader: decompressed %d bytes, differ", n, r.name, len(got))
+			}
+		}
+
+		// 与标准库的解压结果相同
+		std, err := ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(compressed)))
+		if err != nil || !bytes.Equal(std, data) {
+			t.Errorf("%d bytes: compress/bzip2 disagrees: %v", n, err)
+		}
+	}
+}
+
+// 小的读取缓冲区：每次 Read 只返回几个字节，libbz2 要多次调用才能输出一个块
+func TestReaderSmallReads(t *testing.T) {
+	data := testData(300 << 10)
+	z, err := bzip.NewReader(bytes.NewReader(compress(t, data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer z.Close()
+	var got []byte
+	buf := make([]byte, 7)
+	for {
+		n, err := z.Read(buf)
+		got = append(got, buf[:n]...)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("decompressed data differs")
+	}
+	if n, err := z.Read(buf); n != 0 || err != io.EOF {
+		t.Errorf("Read after EOF = %d, %v", n, err)
+	}
+}
+
+// 首尾相接的多个压缩流依次解压，与 bzip2 -d 相同
+func TestReaderConcatenated(t *testing.T) {
+	a, b := testData(5000), []byte("second stream\n")
+	cat := append(compress(t, a), compress(t, b)...)
+	cat = append(cat, compress(t, nil)...)
+	got, err := decompress(iotest.HalfReader(bytes.NewReader(cat)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := append(append([]byte{}, a...), b...); !bytes.Equal(got, want) {
+		t.Errorf("got %d bytes, want %d", len(got), len(want))
+	}
+	std, err := ioutil.ReadAll(bzip2.NewReader(bytes.NewReader(cat)))
+	if err != nil || !bytes.Equal(std, got) {
+		t.Errorf("compress/bzip2 disagrees: %v", err)
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	good := compress(t, testData(10000))
+	corrupt := append([]byte{}, good...)
+	corrupt[len(corrupt)/2] ^= 0x55
+	// 流结尾的 magic 损坏：它不是头部错误，cgo 和纯 Go 的实现都应该返回 ErrData
+	badEnd := append([]byte{}, good...)
+	badEnd[len(badEnd)-8] ^= 0x01
+	tests := []struct {
+		name  string
+		input []byte
+		err   error
+	}{
+		{"empty", nil, io.EOF},
+		{"short header", []byte("BZ"), bzip.ErrHeader},
+		{"not bzip2", []byte("hello, world"), bzip.ErrHeader},
+		{"bad block size", []byte("BZh0rest"), bzip.ErrHeader},
+		{"corrupt", corrupt, bzip.ErrData},
+		{"corrupt end of stream", badEnd, bzip.ErrData},
+		{"truncated", good[:len(good)-10], io.ErrUnexpectedEOF},
+		// 与 bzip2 -d 相同：不是头部的尾部数据被忽略，看起来像头部的则按照压缩流解压
+		{"trailing garbage", append(append([]byte{}, good...), "garbage"...), nil},
+		{"trailing bad level", append(append([]byte{}, good...), "BZh0"...), nil},
+		{"trailing short header", append(append([]byte{}, good...), "B"...), io.ErrUnexpectedEOF},
+		{"trailing corrupt stream", append(append([]byte{}, good...), "BZh91AY&SY"...), io.ErrUnexpectedEOF},
+	}
+	for _, test := range tests {
+		got, err := decompress(bytes.NewReader(test.input))
+		if err != test.err {
+			t.Errorf("%s: error %v, want %v", test.name, err, test.err)
+		}
+		if err == nil && !bytes.Equal(got, testData(10000)) {
+			t.Errorf("%s: decompressed data differs", test.name)
+		}
+	}
+
+	// 底层 io.Reader 的错误原样返回
+	_, err := decompress(iotest.TimeoutReader(bytes.NewReader(good)))
+	if err != iotest.ErrTimeout {
+		t.Errorf("reader error: %v, want %v", err, iotest.ErrTimeout)
+	}
+}
+
+// 系统的 bzip2 命令压缩的数据也能解压
+func TestReaderCommand(t *testing.T) {
+	if _, err := exec.LookPath("bzip2"); err != nil {
+		t.Skip("bzip2 command not found")
+	}
+	data := testData(500 << 10)
+	for _, level := range []int{1, 9} {
+		cmd := exec.Command("bzip2", fmt.Sprintf("-%d", level))
+		cmd.Stdin = bytes.NewReader(data)
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := decompress(bytes.NewReader(out))
+		if err != nil || !bytes.Equal(got, data) {
+			t.Errorf("bzip2 -%d: %v", level, err)
+		}
+	}
+}
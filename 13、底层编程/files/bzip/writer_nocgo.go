@@ -0,0 +1,17 @@
+//go:build !cgo
+
+package bzip
+
+import "io"
+
+// NewWriter 返回 bzip2 压缩流的写入器
+func NewWriter(out io.Writer) io.WriteCloser {
+	w, _ := newGoWriter(out, 9)
+	return w
+}
+
+// NewWriterLevel 与 NewWriter 相同，但是块大小为 level × 100k，level 必须在 1 到 9 之间
+// 较小的块压缩得较快，占用的内存也较少，但是压缩率较低
+func NewWriterLevel(out io.Writer, level int) (io.WriteCloser, error) {
+	return newGoWriter(out, level)
+}
@@ -1,7 +1,9 @@
 // bzipper 读取输入，bzip2 对其进行压缩，然后将其写入
+// 使用 -d 时解压输入；使用 -p n 时用 n 个 goroutine 并行压缩（-p 0 表示使用所有的 CPU）
 package main
 
 import (
+	"flag"
 	"io"
 	"log"
 	"os"
@@ -9,8 +11,31 @@ import (
 	"gostudy/13、底层编程/files/bzip"
 )
 
+var (
+	decompress = flag.Bool("d", false, "解压而不是压缩")
+	parallel   = flag.Int("p", -1, "并行压缩的 goroutine 数，0 表示 CPU 数，默认不并行")
+)
+
 func main() {
-	w := bzip.NewWriter(os.Stdout)
+	flag.Parse()
+	if *decompress {
+		r, err := bzip.NewReader(os.Stdin)
+		if err != nil {
+			log.Fatalf("bzipper: %v\n", err)
+		}
+		if _, err := io.Copy(os.Stdout, r); err != nil {
+			log.Fatalf("bzipper: %v\n", err)
+		}
+		r.Close()
+		return
+	}
+
+	var w io.WriteCloser
+	if *parallel >= 0 {
+		w = bzip.NewParallelWriter(os.Stdout, *parallel)
+	} else {
+		w = bzip.NewWriter(os.Stdout)
+	}
 	if _, err := io.Copy(w, os.Stdin); err != nil {
 		log.Fatalf("bzipper: %v\n", err)
 	}
@@ -0,0 +1,204 @@
+// Package clone 为任意值提供了深度拷贝，它是 equal 包的补充：
+// 对任意 x，equal.Equal(x, clone.Deep(x)) 总是成立
+//
+// 拷贝会保留值之间的共享关系：同一个指针、map 或 slice 在副本中仍然是共享的，
+// 因此带有环的数据也可以被拷贝；未导出的字段借助 unsafe 进行读写
+// 指向某个结构体字段或数组元素的内部指针不会与其所在的值共享
+package clone
+
+import (
+	"reflect"
+	"unsafe"
+)
+
+// Option 配置 DeepWith 的拷贝方式
+type Option func(*copier)
+
+// Shallow 对与 samples 中的值类型相同的值只做浅拷贝（直接赋值），
+// 例如 Shallow(time.Time{}, (*os.File)(nil))
+func Shallow(samples ...interface{}) Option {
+	return func(c *copier) {
+		for _, s := range samples {
+			c.shallow[reflect.TypeOf(s)] = true
+		}
+	}
+}
+
+// CloneMethods 使值在拥有 Clone() T 方法时（T 是值自身的类型），调用该方法来拷贝
+// 值可寻址时，也会使用 *T 上返回 *T 的 Clone 方法
+func CloneMethods(c *copier) { c.cloneMethods = true }
+
+type copier struct {
+	shallow      map[reflect.Type]bool
+	cloneMethods bool
+	seen         map[visit]reflect.Value // 已经拷贝过的指针、map 和 slice
+}
+
+// visit 标识一个已经拷贝过的引用
+// 记录类型和长度的原因和 equal 包的 comparison 一样：不同的值可能对应相同的地址
+type visit struct {
+	ptr unsafe.Pointer
+	t   reflect.Type
+	len int
+}
+
+// Deep 返回 x 的深度拷贝，其动态类型与 x 相同
+func Deep(x interface{}) interface{} {
+	return DeepWith(x)
+}
+
+// DeepWith 按照 opts 返回 x 的深度拷贝
+func DeepWith(x interface{}, opts ...Option) interface{} {
+	if x == nil {
+		return nil
+	}
+	c := &copier{
+		shallow: make(map[reflect.Type]bool),
+		seen:    make(map[visit]reflect.Value),
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	// 将 x 放到一个可寻址的变量中，这样它的未导出字段才能通过 unsafe 读取
+	v := reflect.ValueOf(x)
+	src := reflect.New(v.Type()).Elem()
+	src.Set(v)
+	dst := reflect.New(v.Type()).Elem()
+	c.copy(dst, src)
+	return dst.Interface()
+}
+
+// copy 将 src 深度拷贝到 dst，dst 总是一个新分配的零值
+func (c *copier) copy(dst, src reflect.Value) {
+	dst, src = unlock(dst), unlock(src)
+	t := src.Type()
+	if c.shallow[t] {
+		dst.Set(src)
+		return
+	}
+	if c.cloneMethods {
+		if res, ok := callClone(src); ok {
+			if t.Kind() == reflect.Ptr && !src.IsNil() {
+				c.seen[visit{unsafe.Pointer(src.Pointer()), t, 0}] = res
+			}
+			dst.Set(res)
+			return
+		}
+	}
+
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			return
+		}
+		key := visit{unsafe.Pointer(src.Pointer()), t, 0}
+		if p, ok := c.seen[key]; ok {
+			dst.Set(p)
+			return
+		}
+		p := reflect.New(t.Elem())
+		c.seen[key] = p
+		c.copy(p.Elem(), src.Elem())
+		dst.Set(p)
+	case reflect.Interface:
+		if src.IsNil() {
+			return
+		}
+		e := src.Elem()
+		n := reflect.New(e.Type()).Elem()
+		c.copy(n, addressable(e))
+		dst.Set(n)
+	case reflect.Slice:
+		if src.IsNil() {
+			return
+		}
+		key := visit{unsafe.Pointer(src.Pointer()), t, src.Len()}
+		if s, ok := c.seen[key]; ok {
+			dst.Set(s)
+			return
+		}
+		s := reflect.MakeSlice(t, src.Len(), src.Cap())
+		c.seen[key] = s
+		for i := 0; i < src.Len(); i++ {
+			c.copy(s.Index(i), src.Index(i))
+		}
+		dst.Set(s)
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			c.copy(dst.Index(i), src.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < src.NumField(); i++ {
+			c.copy(dst.Field(i), src.Field(i))
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			return
+		}
+		key := visit{unsafe.Pointer(src.Pointer()), t, 0}
+		if m, ok := c.seen[key]; ok {
+			dst.Set(m)
+			return
+		}
+		m := reflect.MakeMapWithSize(t, src.Len())
+		c.seen[key] = m
+		iter := src.MapRange()
+		for iter.Next() {
+			k := reflect.New(t.Key()).Elem()
+			c.copy(k, addressable(iter.Key()))
+			v := reflect.New(t.Elem()).Elem()
+			c.copy(v, addressable(iter.Value()))
+			m.SetMapIndex(k, v)
+		}
+		dst.Set(m)
+	default:
+		// 基础类型直接赋值，chan、func 和 unsafe.Pointer 在副本中共享
+		dst.Set(src)
+	}
+}
+
+// unlock 借助 unsafe 去掉通过未导出字段得到的值的只读标记，v 必须可寻址
+func unlock(v reflect.Value) reflect.Value {
+	if v.CanInterface() || !v.CanAddr() {
+		return v
+	}
+	return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+}
+
+// addressable 返回一个可寻址的 v 的副本
+// map 的键值和 interface 中的值不可寻址，拷贝后才能读取其中的未导出字段
+func addressable(v reflect.Value) reflect.Value {
+	if v.CanAddr() {
+		return v
+	}
+	a := reflect.New(v.Type()).Elem()
+	a.Set(v)
+	return a
+}
+
+// callClone 调用 v 的 Clone 方法
+func callClone(v reflect.Value) (reflect.Value, bool) {
+	t := v.Type()
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return reflect.Value{}, false
+		}
+	}
+	if m := v.MethodByName("Clone"); m.IsValid() && returns(m.Type(), t) {
+		return m.Call(nil)[0], true
+	}
+	if t.Kind() != reflect.Ptr && v.CanAddr() {
+		if m := v.Addr().MethodByName("Clone"); m.IsValid() && returns(m.Type(), reflect.PtrTo(t)) {
+			if res := m.Call(nil)[0]; !res.IsNil() {
+				return res.Elem(), true
+			}
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// returns 报告函数类型 ft 是否为 func() t
+func returns(ft, t reflect.Type) bool {
+	return ft.NumIn() == 0 && ft.NumOut() == 1 && ft.Out(0) == t
+}
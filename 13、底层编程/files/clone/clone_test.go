@@ -0,0 +1,179 @@
+package clone_test
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+	"testing/quick"
+	"time"
+
+	"gostudy/13、底层编程/files/clone"
+	"gostudy/13、底层编程/files/equal"
+)
+
+type record struct {
+	Name    string
+	Scores  []float64
+	Tags    map[string][]int
+	Next    *record
+	Data    [3]byte
+	private int
+	Any     interface{}
+}
+
+// sample 只包含 testing/quick 能够生成的字段
+type sample struct {
+	Name   string
+	Scores []float64
+	Tags   map[string][]int
+	Next   *sample
+	Data   [3]byte
+}
+
+// 性质测试：对任意值，副本与原值深度相等
+func TestDeepEqualsOriginal(t *testing.T) {
+	f := func(v sample, m map[int]string, s [][]string, p *int, n int) bool {
+		r := record{Name: v.Name, Scores: v.Scores, Tags: v.Tags, private: n, Any: v}
+		for _, x := range []interface{}{v, &v, r, &r, m, s, p} {
+			if !equal.Equal(x, clone.Deep(x)) {
+				t.Logf("Deep(%v) differs: %v", x, equal.Explain(x, clone.Deep(x)))
+				return false
+			}
+		}
+		return true
+	}
+	cfg := &quick.Config{Rand: rand.New(rand.NewSource(1))}
+	if err := quick.Check(f, cfg); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestDeep(t *testing.T) {
+	one := 1
+
+	type CyclePtr *CyclePtr
+	var cyclePtr CyclePtr
+	cyclePtr = &cyclePtr
+
+	type CycleSlice []CycleSlice
+	var cycleSlice = make(CycleSlice, 1)
+	cycleSlice[0] = cycleSlice
+
+	type link struct {
+		value string
+		tail  *link
+	}
+	a, b := &link{value: "a"}, &link{value: "b"}
+	a.tail, b.tail = b, a
+
+	for _, x := range []interface{}{
+		1, "foo", 3.5, complex(1, 2), true,
+		[]string{"foo"}, []string{}, []string(nil),
+		map[string][]int{"foo": {1, 2, 3}}, map[string]int(nil),
+		&one, [...]int{1, 2, 3},
+		cyclePtr, cycleSlice, a,
+		record{Name: "x", private: 42, Any: &record{Name: "y", private: 7}},
+		struct{ x interface{} }{struct{ y []int }{[]int{1}}},
+		map[[2]int]*link{{1, 2}: a},
+	} {
+		if y := clone.Deep(x); !equal.Equal(x, y) {
+			t.Errorf("Deep(%v) = %v, differences: %v", x, y, equal.Explain(x, y))
+		}
+	}
+}
+
+func TestDeepIsIndependent(t *testing.T) {
+	orig := &record{Name: "a", Scores: []float64{1}, Tags: map[string][]int{"k": {1}}, private: 1}
+	c := clone.Deep(orig).(*record)
+	c.Name = "b"
+	c.Scores[0] = 2
+	c.Tags["k"][0] = 2
+	c.Tags["new"] = nil
+	c.private = 2
+	want := &record{Name: "a", Scores: []float64{1}, Tags: map[string][]int{"k": {1}}, private: 1}
+	equal.Assert(t, orig, want)
+}
+
+func TestDeepPreservesAliasing(t *testing.T) {
+	shared := &record{Name: "shared"}
+	tags := map[string][]int{"k": {1}}
+	scores := []float64{1, 2}
+	x := []*record{
+		{Name: "a", Next: shared, Tags: tags, Scores: scores},
+		{Name: "b", Next: shared, Tags: tags, Scores: scores},
+	}
+	y := clone.Deep(x).([]*record)
+	if y[0].Next != y[1].Next || y[0].Next == shared {
+		t.Error("shared pointer was not preserved")
+	}
+	y[0].Tags["k2"] = nil
+	if _, ok := y[1].Tags["k2"]; !ok || len(tags) != 1 {
+		t.Error("shared map was not preserved")
+	}
+	y[0].Scores[0] = 9
+	if y[1].Scores[0] != 9 || scores[0] != 1 {
+		t.Error("shared slice was not preserved")
+	}
+
+	// 环
+	a := &record{Name: "a"}
+	a.Next = &record{Name: "b", Next: a}
+	c := clone.Deep(a).(*record)
+	if c == a || c.Next.Next != c {
+		t.Error("cycle was not preserved")
+	}
+}
+
+type counter struct {
+	n      int
+	clones *int
+}
+
+func (c *counter) Clone() *counter {
+	*c.clones++
+	return &counter{n: -c.n, clones: c.clones}
+}
+
+func TestOptions(t *testing.T) {
+	type state struct {
+		Created time.Time
+		Owner   *record
+		Counter *counter
+	}
+	var clones int
+	owner := &record{Name: "owner"}
+	x := state{time.Now(), owner, &counter{n: 1, clones: &clones}}
+
+	y := clone.DeepWith(x, clone.Shallow(owner)).(state)
+	if y.Owner != owner {
+		t.Error("Shallow: Owner was copied")
+	}
+	if y.Counter == x.Counter || y.Counter.n != 1 || clones != 0 {
+		t.Errorf("Clone called without CloneMethods: %+v, %d clones", y.Counter, clones)
+	}
+
+	y = clone.DeepWith(x, clone.CloneMethods).(state)
+	if y.Owner == owner || y.Counter.n != -1 || clones != 1 {
+		t.Errorf("CloneMethods: %+v, %d clones", y.Counter, clones)
+	}
+}
+
+func TestNil(t *testing.T) {
+	if got := clone.Deep(nil); got != nil {
+		t.Errorf("Deep(nil) = %v", got)
+	}
+	var p *record
+	if got := clone.Deep(p); !reflect.DeepEqual(got, p) {
+		t.Errorf("Deep((*record)(nil)) = %v", got)
+	}
+}
+
+func Example() {
+	balances := map[string]int{"alice": 200, "bob": 100}
+	snapshot := clone.Deep(balances).(map[string]int)
+	balances["alice"] -= 50
+	fmt.Println(snapshot["alice"], balances["alice"])
+	// Output:
+	// 200 150
+}
@@ -2,16 +2,31 @@
 package equal
 
 import (
+	"fmt"
+	"math"
 	"reflect"
+	"sort"
 	"unsafe"
 )
 
-func equal(x, y reflect.Value, seen map[comparison]bool) bool {
+// walker 保存一次比较的状态
+// diffs 为 nil 时，遇到第一个不同就立即返回；否则记录所有不同之处
+type walker struct {
+	seen  map[comparison]bool
+	o     *options
+	diffs *[]Difference
+}
+
+// equal 就是书中的 equal 函数，原来作为参数传递的 seen 现在保存在 w 中
+func (w *walker) equal(x, y reflect.Value, path string) bool {
 	if !x.IsValid() || !y.IsValid() {
-		return x.IsValid() == y.IsValid()
+		if x.IsValid() == y.IsValid() {
+			return true
+		}
+		return w.differ(path, x, y, "invalid value")
 	}
 	if x.Type() != y.Type() {
-		return false
+		return w.differ(path, x, y, "different types")
 	}
 
 	// 循环检查
@@ -22,74 +37,222 @@ func equal(x, y reflect.Value, seen map[comparison]bool) bool {
 			return true // 相同的引用
 		}
 		c := comparison{xptr, yptr, x.Type()}
-		if seen[c] {
+		if w.seen[c] {
 			return true // 已经检查过
 		}
-		seen[c] = true
+		w.seen[c] = true
+	}
+
+	// 自定义比较
+	if eq, ok := w.o.comparers[x.Type()]; ok {
+		if xv, yv := accessible(x), accessible(y); xv.IsValid() && yv.IsValid() {
+			return eq.Call([]reflect.Value{xv, yv})[0].Bool() ||
+				w.differ(path, x, y, "custom comparer")
+		}
 	}
 
+	var eq bool
 	switch x.Kind() {
 	case reflect.Bool:
-		return x.Bool() == y.Bool()
+		eq = x.Bool() == y.Bool()
 	case reflect.String:
-		return x.String() == y.String()
+		eq = x.String() == y.String()
 	case reflect.Int,
 		reflect.Int8, reflect.Int16,
 		reflect.Int32, reflect.Int64:
-		return x.Int() == y.Int()
+		eq = x.Int() == y.Int()
 	case reflect.Uint,
 		reflect.Uint8, reflect.Uint16,
 		reflect.Uint32, reflect.Uint64, reflect.Uintptr:
-		return x.Uint() == y.Uint()
+		eq = x.Uint() == y.Uint()
 	case reflect.Float32, reflect.Float64:
-		return x.Float() == y.Float()
+		eq = w.o.floatEqual(x.Float(), y.Float())
 	case reflect.Complex64, reflect.Complex128:
-		return x.Complex() == y.Complex()
+		xc, yc := x.Complex(), y.Complex()
+		eq = w.o.floatEqual(real(xc), real(yc)) && w.o.floatEqual(imag(xc), imag(yc))
 	case reflect.Chan, reflect.UnsafePointer, reflect.Func:
-		return x.Pointer() == y.Pointer()
-	case reflect.Ptr, reflect.Interface:
-		return equal(x.Elem(), y.Elem(), seen)
+		eq = x.Pointer() == y.Pointer()
+	case reflect.Ptr:
+		if x.IsNil() != y.IsNil() {
+			return w.differ(path, x, y, "nil pointer")
+		}
+		return w.equal(x.Elem(), y.Elem(), w.sub("(*%s)", path))
+	case reflect.Interface:
+		if x.IsNil() != y.IsNil() {
+			return w.differ(path, x, y, "nil interface")
+		}
+		return w.equal(x.Elem(), y.Elem(), path)
 	case reflect.Array, reflect.Slice:
-		if x.Len() != y.Len() {
-			return false
+		if x.Kind() == reflect.Slice && !w.o.nilEqualsEmpty && x.IsNil() != y.IsNil() {
+			return w.differ(path, x, y, "nil slice")
 		}
-		for i := 0; i < x.Len(); i++ {
-			if !equal(x.Index(i), y.Index(i), seen) {
+		eq = true
+		n := x.Len()
+		if n != y.Len() {
+			w.differ(path, x, y, fmt.Sprintf("length %d != %d", x.Len(), y.Len()))
+			if w.diffs == nil {
 				return false
 			}
+			eq = false
+			if y.Len() < n {
+				n = y.Len()
+			}
 		}
-		return true
+		if less, ok := w.o.sorters[x.Type().Elem()]; ok && x.Kind() == reflect.Slice {
+			x, y = sorted(x, less), sorted(y, less)
+		}
+		for i := 0; i < n; i++ {
+			if !w.equal(x.Index(i), y.Index(i), w.sub("%s[%d]", path, i)) {
+				if w.diffs == nil {
+					return false
+				}
+				eq = false
+			}
+		}
+		return eq
 	case reflect.Struct:
+		eq = true
+		t := x.Type()
 		for i, n := 0, x.NumField(); i < n; i++ {
-			if !equal(x.Field(i), y.Field(i), seen) {
-				return false
+			if w.o.ignoreField(t, t.Field(i)) {
+				continue
+			}
+			if !w.equal(x.Field(i), y.Field(i), w.sub("%s.%s", path, t.Field(i).Name)) {
+				if w.diffs == nil {
+					return false
+				}
+				eq = false
 			}
 		}
-		return true
+		return eq
 	case reflect.Map:
-		if x.Len() != y.Len() {
+		if !w.o.nilEqualsEmpty && x.IsNil() != y.IsNil() {
+			return w.differ(path, x, y, "nil map")
+		}
+		if x.Len() != y.Len() && w.diffs == nil {
 			return false
 		}
+		if w.diffs != nil {
+			// 尽量使键可以被 render 格式化
+			if a, b := accessible(x), accessible(y); a.IsValid() && b.IsValid() {
+				x, y = a, b
+			}
+		}
+		eq = true
 		for _, k := range x.MapKeys() {
-			if !equal(x.MapIndex(k), y.MapIndex(k), seen) {
-				return false
+			kpath := w.sub("%s[%s]", path, render(k))
+			yv := y.MapIndex(k)
+			if !yv.IsValid() {
+				w.differ(kpath, x.MapIndex(k), yv, "missing key")
+				eq = false
+				continue
+			}
+			if !w.equal(x.MapIndex(k), yv, kpath) {
+				if w.diffs == nil {
+					return false
+				}
+				eq = false
 			}
 		}
-		return true
+		for _, k := range y.MapKeys() {
+			if !x.MapIndex(k).IsValid() {
+				w.differ(w.sub("%s[%s]", path, render(k)), x.MapIndex(k), y.MapIndex(k), "missing key")
+				eq = false
+			}
+		}
+		return eq
+	default:
+		panic("unreachable")
 	}
+	return eq || w.differ(path, x, y, "different values")
+}
 
-	panic("unreachable")
+// sub 构造子元素的路径，只在需要记录不同之处时才进行格式化
+func (w *walker) sub(format string, args ...interface{}) string {
+	if w.diffs == nil {
+		return ""
+	}
+	return fmt.Sprintf(format, args...)
+}
+
+// differ 记录一处不同，并总是返回 false
+func (w *walker) differ(path string, x, y reflect.Value, reason string) bool {
+	if w.diffs != nil {
+		*w.diffs = append(*w.diffs, newDifference(path, x, y, reason))
+	}
+	return false
 }
 
 // Equal 报告 x 与 y 是否深度相等
 // Map 的键总是与 == 比较，而不是深层的
 // （这对于包含 pointer 或 interface 的键很重要）
+// nil 值的 slice（map 类似）和非 nil 值但是空的 slice 视为相等
 func Equal(x, y interface{}) bool {
-	seen := make(map[comparison]bool)
-	return equal(reflect.ValueOf(x), reflect.ValueOf(y), seen)
+	return EqualWith(x, y, NilEqualsEmpty)
+}
+
+// EqualWith 按照 opts 报告 x 与 y 是否深度相等
+// 不带任何选项时，它和 reflect.DeepEqual 一样区分 nil 与空的 slice 和 map
+func EqualWith(x, y interface{}, opts ...Option) bool {
+	w := &walker{seen: make(map[comparison]bool), o: newOptions(opts)}
+	return w.equal(reflect.ValueOf(x), reflect.ValueOf(y), "v")
 }
 
 type comparison struct {
 	x, y unsafe.Pointer
 	t    reflect.Type
 }
+
+func (o *options) floatEqual(x, y float64) bool {
+	if x == y {
+		return true
+	}
+	if !o.hasTolerance {
+		return false
+	}
+	if math.IsNaN(x) || math.IsNaN(y) {
+		return math.IsNaN(x) && math.IsNaN(y)
+	}
+	return math.Abs(x-y) <= o.tolerance
+}
+
+func (o *options) ignoreField(t reflect.Type, f reflect.StructField) bool {
+	if o.ignoreUnexported && f.PkgPath != "" {
+		return true
+	}
+	if len(o.ignoreFields) == 0 {
+		return false
+	}
+	return o.ignoreFields[t.Name()+"."+f.Name] || o.ignoreFields[t.String()+"."+f.Name]
+}
+
+// accessible 返回一个可以调用 Interface 的 v
+// 通过未导出字段得到的值只有在可寻址时才能借助 unsafe 读取，否则返回无效值
+func accessible(v reflect.Value) reflect.Value {
+	if v.CanInterface() {
+		return v
+	}
+	if v.CanAddr() {
+		return reflect.NewAt(v.Type(), unsafe.Pointer(v.UnsafeAddr())).Elem()
+	}
+	return reflect.Value{}
+}
+
+// sorted 返回按 less 排序后的 s 的副本
+func sorted(s, less reflect.Value) reflect.Value {
+	elems := make([]reflect.Value, s.Len())
+	for i := range elems {
+		elems[i] = accessible(s.Index(i))
+		if !elems[i].IsValid() {
+			return s // 无法读取的元素保持原顺序
+		}
+	}
+	sort.SliceStable(elems, func(i, j int) bool {
+		return less.Call([]reflect.Value{elems[i], elems[j]})[0].Bool()
+	})
+	c := reflect.MakeSlice(s.Type(), len(elems), len(elems))
+	for i, e := range elems {
+		c.Index(i).Set(e)
+	}
+	return c
+}
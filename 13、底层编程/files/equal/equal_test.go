@@ -3,7 +3,11 @@ package equal
 import (
 	"bytes"
 	"fmt"
+	"math"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestEqual(t *testing.T) {
@@ -110,3 +114,185 @@ func Example_equalCycle() {
 	fmt.Println(Equal(a, b)) // false
 	fmt.Println(Equal(a, c)) // false
 }
+
+func TestEqualWith(t *testing.T) {
+	type point struct {
+		X, Y float64
+		tag  string
+	}
+	type event struct {
+		Name string
+		At   time.Time
+		Seq  int
+	}
+	now := time.Now()
+	nan := math.NaN()
+	tenth, fifth := 0.1, 0.2
+	approx := tenth + fifth // 0.30000000000000004
+	byValue := func(a, b int) bool { return a < b }
+	sameInstant := func(a, b time.Time) bool { return a.Equal(b) }
+
+	for _, test := range []struct {
+		x, y interface{}
+		opts []Option
+		want bool
+	}{
+		// 默认和 reflect.DeepEqual 一样严格
+		{[]string{}, []string(nil), nil, false},
+		{map[string]int{}, map[string]int(nil), nil, false},
+		{[]string{}, []string(nil), []Option{NilEqualsEmpty}, true},
+		{map[string]int{}, map[string]int(nil), []Option{NilEqualsEmpty}, true},
+		// 浮点数
+		{approx, 0.3, nil, false},
+		{approx, 0.3, []Option{FloatTolerance(1e-9)}, true},
+		{1.0, 1.1, []Option{FloatTolerance(1e-9)}, false},
+		{nan, nan, nil, false},
+		{nan, nan, []Option{FloatTolerance(0)}, true},
+		{nan, 1.0, []Option{FloatTolerance(math.Inf(1))}, false},
+		{complex(approx, 1), complex(0.3, 1), []Option{FloatTolerance(1e-9)}, true},
+		{[]float32{float32(tenth) * 3}, []float32{0.3}, []Option{FloatTolerance(1e-6)}, true},
+		// 字段
+		{point{1, 2, "a"}, point{1, 2, "b"}, nil, false},
+		{point{1, 2, "a"}, point{1, 2, "b"}, []Option{IgnoreUnexported}, true},
+		{point{1, 2, "a"}, point{1, 3, "a"}, []Option{IgnoreFields("point.Y")}, true},
+		{point{1, 2, "a"}, point{1, 3, "a"}, []Option{IgnoreFields("equal.point.Y")}, true},
+		{point{1, 2, "a"}, point{2, 3, "a"}, []Option{IgnoreFields("point.Y")}, false},
+		// 排序
+		{[]int{3, 1, 2}, []int{1, 2, 3}, nil, false},
+		{[]int{3, 1, 2}, []int{1, 2, 3}, []Option{SortSlices(byValue)}, true},
+		{[]int{3, 1, 2}, []int{1, 2, 4}, []Option{SortSlices(byValue)}, false},
+		{[...]int{3, 1}, [...]int{1, 3}, []Option{SortSlices(byValue)}, false}, // 数组不排序
+		// 自定义比较
+		{event{"a", now, 1}, event{"a", now.UTC(), 1}, nil, false},
+		{event{"a", now, 1}, event{"a", now.UTC(), 1}, []Option{Comparer(sameInstant)}, true},
+		{event{"a", now, 1}, event{"a", now.UTC(), 2}, []Option{Comparer(sameInstant)}, false},
+		{
+			[]event{{"b", now, 2}, {"a", now, 1}},
+			[]event{{"a", now.UTC(), 1}, {"b", now.UTC(), 2}},
+			[]Option{Comparer(sameInstant), SortSlices(func(a, b event) bool { return a.Seq < b.Seq })},
+			true,
+		},
+	} {
+		if got := EqualWith(test.x, test.y, test.opts...); got != test.want {
+			t.Errorf("EqualWith(%v, %v, %d opts) = %t", test.x, test.y, len(test.opts), got)
+		}
+	}
+}
+
+func TestEqualWithCycle(t *testing.T) {
+	type node struct {
+		value float64
+		next  *node
+	}
+	tenth, fifth := 0.1, 0.2
+	a, b := &node{value: tenth + fifth}, &node{value: 0.3}
+	a.next, b.next = a, b
+	if EqualWith(a, b) {
+		t.Error("EqualWith without tolerance = true")
+	}
+	if !EqualWith(a, b, FloatTolerance(1e-9)) {
+		t.Error("EqualWith(FloatTolerance) = false")
+	}
+}
+
+func Example_equalWith() {
+	type reading struct {
+		Sensor string
+		Value  float64
+		At     time.Time
+	}
+	tenth, fifth := 0.1, 0.2
+	x := reading{"t1", tenth + fifth, time.Unix(0, 0)}
+	y := reading{"t1", 0.3, time.Unix(60, 0)}
+	fmt.Println(Equal(x, y))                                                                    // false
+	fmt.Println(EqualWith(x, y, FloatTolerance(1e-9)))                                          // false
+	fmt.Println(EqualWith(x, y, FloatTolerance(1e-9), IgnoreFields("reading.At")))              // true
+	fmt.Println(EqualWith([]int(nil), []int{}), EqualWith([]int(nil), []int{}, NilEqualsEmpty)) // false true
+}
+
+func TestExplain(t *testing.T) {
+	type item struct {
+		Name  string
+		Count int
+		tags  map[string]bool
+	}
+	type order struct {
+		ID    int
+		Items []*item
+	}
+	x := &order{1, []*item{{"apple", 1, nil}, {"pear", 2, map[string]bool{"a": true}}}}
+	y := &order{1, []*item{{"apple", 1, nil}, {"plum", 3, map[string]bool{"b": true}}, {"fig", 1, nil}}}
+
+	var got []string
+	for _, d := range Explain(x, y) {
+		got = append(got, d.Path+": "+d.Reason)
+	}
+	want := []string{
+		"(*v).Items: length 2 != 3",
+		"(*(*v).Items[1]).Name: different values",
+		"(*(*v).Items[1]).Count: different values",
+		`(*(*v).Items[1]).tags["a"]: missing key`,
+		`(*(*v).Items[1]).tags["b"]: missing key`,
+	}
+	if !Equal(got, want) {
+		t.Errorf("Explain paths = %q, want %q", got, want)
+	}
+
+	if diffs := Explain(x, x); diffs != nil {
+		t.Errorf("Explain(x, x) = %v, want nil", diffs)
+	}
+
+	diffs := Explain(1, "1")
+	if len(diffs) != 1 || diffs[0].XKind != reflect.Int || diffs[0].YType != reflect.TypeOf("") {
+		t.Errorf("Explain(1, \"1\") = %v", diffs)
+	}
+}
+
+func TestExplainCycle(t *testing.T) {
+	type link struct {
+		value string
+		tail  *link
+	}
+	a, b, c := &link{value: "a"}, &link{value: "b"}, &link{value: "a"}
+	a.tail, b.tail, c.tail = b, a, c
+
+	diffs := Explain(a, c)
+	if len(diffs) != 1 || diffs[0].Path != "(*(*v).tail).value" {
+		t.Fatalf("Explain(a, c) = %v", diffs)
+	}
+	if diffs[0].X != `"b"` || diffs[0].Y != `"a"` {
+		t.Errorf("values = %s, %s", diffs[0].X, diffs[0].Y)
+	}
+	if diffs := Explain(a, a); diffs != nil {
+		t.Errorf("Explain(a, a) = %v", diffs)
+	}
+}
+
+// recorder 记录 Assert 报告的错误
+type recorder struct {
+	testing.TB
+	helper bool
+	errors []string
+}
+
+func (r *recorder) Helper() { r.helper = true }
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssert(t *testing.T) {
+	r := new(recorder)
+	if !Assert(r, []int{1, 2}, []int{1, 2}) || len(r.errors) != 0 {
+		t.Errorf("Assert on equal values reported %q", r.errors)
+	}
+	if Assert(r, map[string]int{"a": 1}, map[string]int{"a": 2}) {
+		t.Error("Assert on different values = true")
+	}
+	if !r.helper {
+		t.Error("Assert did not call t.Helper")
+	}
+	if len(r.errors) != 1 || !strings.Contains(r.errors[0], `v["a"]: different values: 1 (int) != 2 (int)`) {
+		t.Errorf("Assert reported %q", r.errors)
+	}
+}
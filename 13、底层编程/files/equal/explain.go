@@ -0,0 +1,83 @@
+package equal
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"gostudy/12、反射/files/format"
+)
+
+// Difference 描述 x 与 y 的一处不同
+type Difference struct {
+	Path         string // 从根 v 出发的路径，如 “(*v).items[2].Name”
+	Reason       string
+	XKind, YKind reflect.Kind
+	XType, YType reflect.Type // 值无效时为 nil
+	X, Y         string       // 使用 format.Any 格式化的值
+}
+
+func (d Difference) String() string {
+	return fmt.Sprintf("%s: %s: %s (%s) != %s (%s)",
+		d.Path, d.Reason, d.X, typeName(d.XType), d.Y, typeName(d.YType))
+}
+
+func newDifference(path string, x, y reflect.Value, reason string) Difference {
+	d := Difference{Path: path, Reason: reason, XKind: x.Kind(), YKind: y.Kind(), X: render(x), Y: render(y)}
+	if x.IsValid() {
+		d.XType = x.Type()
+	}
+	if y.IsValid() {
+		d.YType = y.Type()
+	}
+	return d
+}
+
+func typeName(t reflect.Type) string {
+	if t == nil {
+		return "invalid"
+	}
+	return t.String()
+}
+
+// render 使用 format.Any 格式化 v
+// 通过未导出字段得到的值不能调用 Interface，此时交给 fmt 处理
+func render(v reflect.Value) string {
+	if !v.IsValid() {
+		return format.Any(nil)
+	}
+	if a := accessible(v); a.IsValid() {
+		return format.Any(a.Interface())
+	}
+	return fmt.Sprint(v)
+}
+
+// Explain 返回 x 与 y 的所有不同之处，相等时返回 nil
+// 它和 Equal 使用相同的比较规则，同样能处理带有环的数据
+func Explain(x, y interface{}) []Difference {
+	return ExplainWith(x, y, NilEqualsEmpty)
+}
+
+// ExplainWith 按照 opts 返回 x 与 y 的所有不同之处
+func ExplainWith(x, y interface{}, opts ...Option) []Difference {
+	var diffs []Difference
+	w := &walker{seen: make(map[comparison]bool), o: newOptions(opts), diffs: &diffs}
+	w.equal(reflect.ValueOf(x), reflect.ValueOf(y), "v")
+	return diffs
+}
+
+// Assert 在 got 与 want 不相等时，通过 t.Errorf 报告每一处不同
+// 它会调用 t.Helper，因此错误信息中的行号指向调用方
+func Assert(t testing.TB, got, want interface{}) bool {
+	t.Helper()
+	diffs := Explain(got, want)
+	if len(diffs) == 0 {
+		return true
+	}
+	msg := fmt.Sprintf("got != want, %d difference(s):", len(diffs))
+	for _, d := range diffs {
+		msg += "\n\t" + d.String()
+	}
+	t.Errorf("%s", msg)
+	return false
+}
@@ -0,0 +1,85 @@
+package equal
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// Option 配置 EqualWith 的比较方式
+type Option func(*options)
+
+type options struct {
+	tolerance        float64
+	hasTolerance     bool
+	ignoreFields     map[string]bool
+	nilEqualsEmpty   bool
+	ignoreUnexported bool
+	sorters          map[reflect.Type]reflect.Value // 元素类型 -> func(a, b T) bool
+	comparers        map[reflect.Type]reflect.Value // 类型 -> func(a, b T) bool
+}
+
+func newOptions(opts []Option) *options {
+	o := &options{
+		ignoreFields: make(map[string]bool),
+		sorters:      make(map[reflect.Type]reflect.Value),
+		comparers:    make(map[reflect.Type]reflect.Value),
+	}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// FloatTolerance 使差的绝对值不超过 eps 的浮点数（包括复数的实部和虚部）视为相等
+// 同时 NaN 与 NaN 也视为相等
+func FloatTolerance(eps float64) Option {
+	return func(o *options) {
+		o.tolerance = eps
+		o.hasTolerance = true
+	}
+}
+
+// IgnoreFields 忽略给定的结构体字段，字段名形如 “Type.Field”，
+// Type 可以是类型名，也可以是带包名的完整类型，如 “time.Time.wall”
+func IgnoreFields(names ...string) Option {
+	return func(o *options) {
+		for _, name := range names {
+			o.ignoreFields[name] = true
+		}
+	}
+}
+
+// NilEqualsEmpty 使 nil 值的 slice（map 类似）和非 nil 值但是空的 slice 视为相等
+// Equal 总是启用该选项
+func NilEqualsEmpty(o *options) { o.nilEqualsEmpty = true }
+
+// IgnoreUnexported 忽略所有未导出的结构体字段
+func IgnoreUnexported(o *options) { o.ignoreUnexported = true }
+
+// SortSlices 在比较元素类型为 T 的 slice 前，按照 less 对它们的副本排序，
+// less 的类型必须为 func(a, b T) bool，原 slice 不会被修改
+func SortSlices(less interface{}) Option {
+	fn := reflect.ValueOf(less)
+	t := checkFunc(fn, "SortSlices")
+	return func(o *options) { o.sorters[t] = fn }
+}
+
+// Comparer 使用 eq 比较类型为 T 的值，eq 的类型必须为 func(a, b T) bool
+// 例如 Comparer(func(a, b time.Time) bool { return a.Equal(b) })
+func Comparer(eq interface{}) Option {
+	fn := reflect.ValueOf(eq)
+	t := checkFunc(fn, "Comparer")
+	return func(o *options) { o.comparers[t] = fn }
+}
+
+// checkFunc 检查 fn 的类型为 func(a, b T) bool，并返回 T
+func checkFunc(fn reflect.Value, name string) reflect.Type {
+	if fn.Kind() != reflect.Func {
+		panic(fmt.Sprintf("equal.%s: 需要 func(a, b T) bool，得到 %v", name, fn.Kind()))
+	}
+	t := fn.Type()
+	if t.NumIn() != 2 || t.NumOut() != 1 || t.In(0) != t.In(1) || t.Out(0).Kind() != reflect.Bool {
+		panic(fmt.Sprintf("equal.%s: 需要 func(a, b T) bool，得到 %s", name, t))
+	}
+	return t.In(0)
+}